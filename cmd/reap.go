@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal"
+)
+
+var reapCmd = &cobra.Command{
+	Use:   "reap",
+	Short: "Reap lingering kubedock resources in the namespace",
+	// the flags are bound in PreRun, as viper only keeps the last bound flag
+	// for a key, and the server command binds the same keys.
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("kubernetes.namespace", cmd.Flags().Lookup("namespace"))
+		viper.BindPFlag("kubernetes.kubeconfig", cmd.Flags().Lookup("kubeconfig"))
+		viper.BindPFlag("reaper.reapmax", cmd.Flags().Lookup("reapmax"))
+		viper.BindPFlag("verbosity", cmd.Flags().Lookup("verbosity"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		flag.Set("v", viper.GetString("verbosity"))
+		dryrun, _ := cmd.Flags().GetBool("dry-run")
+		all, _ := cmd.Flags().GetBool("all")
+		if err := internal.Reap(os.Stdout, dryrun, all); err != nil {
+			klog.Fatalf("error reaping resources: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reapCmd)
+
+	reapCmd.Flags().Bool("dry-run", false, "List the resources that would be reaped, without deleting them")
+	reapCmd.Flags().Bool("all", false, "Reap all kubedock resources, instead of only the lingering ones (like prune-start)")
+	reapCmd.Flags().StringP("namespace", "n", getContextNamespace(), "Namespace in which resources should be reaped")
+	reapCmd.Flags().DurationP("reapmax", "r", 60*time.Minute, "Reap resources of instances without heartbeat that are older than this time (+15m)")
+	reapCmd.Flags().StringP("verbosity", "v", "1", "Log verbosity level")
+	if home := homeDir(); home != "" {
+		reapCmd.Flags().String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+	} else {
+		reapCmd.Flags().String("kubeconfig", "", "absolute path to the kubeconfig file")
+	}
+}
@@ -44,19 +44,48 @@ func init() {
 	serverCmd.PersistentFlags().String("pull-policy", "ifnotpresent", "Pull policy that should be applied (ifnotpresent,never,always)")
 	serverCmd.PersistentFlags().String("service-account", "default", "Service account that should be used for deployed pods")
 	serverCmd.PersistentFlags().String("image-pull-secrets", "", "Comma separated list of image pull secrets that should be used")
-	serverCmd.PersistentFlags().String("pod-template", "", "Pod file that should be used as the base for creating pods")
+	serverCmd.PersistentFlags().String("pod-template", "", "Pod file, or directory with named pod files, that should be used as the base for creating pods")
+	serverCmd.PersistentFlags().Bool("owner-pod", false, "Make the kubedock pod (POD_NAME env var via the downward api) the owner of created pods")
+	serverCmd.PersistentFlags().String("pod-patch-allow", "", "Comma separated list of pod fields that can be patched with the pod-patch label (e.g. spec.volumes)")
+	serverCmd.PersistentFlags().String("webhook-url", "", "Url of a webhook that can modify or deny pods and services before they are created")
+	serverCmd.PersistentFlags().Duration("webhook-timeout", 10*time.Second, "Max time to wait for the webhook")
+	serverCmd.PersistentFlags().Bool("webhook-fail-open", false, "Ignore webhook failures instead of failing the container")
+	serverCmd.PersistentFlags().String("image-rewrite", "", "Space separated list of image rewrite rules (prefix=replacement or ~regex=replacement)")
+	serverCmd.PersistentFlags().String("image-policy", "", "Yaml or json file with allow, deny and requireDigest image patterns")
+	serverCmd.PersistentFlags().String("image-allow", "", "Comma separated list of allowed image patterns (e.g. docker.io/library/*)")
+	serverCmd.PersistentFlags().String("image-deny", "", "Comma separated list of denied image patterns (e.g. *:latest)")
+	serverCmd.PersistentFlags().String("image-require-digest", "", "Comma separated list of image patterns that should be referenced by digest")
 	serverCmd.PersistentFlags().BoolP("inspector", "i", false, "Enable image inspect to fetch container port config from a registry")
 	serverCmd.PersistentFlags().DurationP("timeout", "t", 1*time.Minute, "Container creating/deletion timeout")
-	serverCmd.PersistentFlags().DurationP("reapmax", "r", 60*time.Minute, "Reap all resources older than this time")
+	serverCmd.PersistentFlags().DurationP("reapmax", "r", 60*time.Minute, "Reap all containers that have been idle for longer than this time")
+	serverCmd.PersistentFlags().Duration("reapmax-exec", 5*time.Minute, "Reap all finished execs that are older than this time")
+	serverCmd.PersistentFlags().Duration("reapmax-network", 60*time.Minute, "Reap all networks without connected containers that are older than this time (0 disables)")
+	serverCmd.PersistentFlags().Duration("reapmax-image", 60*time.Minute, "Reap all image records not used by containers that are older than this time (0 disables)")
+	serverCmd.PersistentFlags().Duration("heartbeat-timeout", 2*time.Minute, "Duration of the heartbeat lease, after which other instances reap the resources of this instance once it stopped (0 disables)")
 	serverCmd.PersistentFlags().String("request-cpu", "", "Default k8s cpu resource request (optionally add ,limit)")
 	serverCmd.PersistentFlags().String("request-memory", "", "Default k8s memory resource request (optionally add ,limit)")
-	serverCmd.PersistentFlags().String("runas-user", "", "Numeric UID to run pods as (defaults to UID in image)")
+	serverCmd.PersistentFlags().String("runas-user", "", "User (uid[:gid] or name[:group]) to run pods as (defaults to user in image)")
+	serverCmd.PersistentFlags().String("network-affinity", "none", "Schedule pods sharing a network on the same node (colocate) or different nodes (spread)")
+	serverCmd.PersistentFlags().Int("max-containers", 0, "Max number of concurrently running containers (0 is unlimited)")
+	serverCmd.PersistentFlags().String("max-cpu", "", "Max total cpu requests of running containers")
+	serverCmd.PersistentFlags().String("max-memory", "", "Max total memory requests of running containers")
+	serverCmd.PersistentFlags().Int("session-max-containers", 0, "Max number of concurrently running containers per session (0 is unlimited)")
+	serverCmd.PersistentFlags().String("session-max-cpu", "", "Max total cpu requests of running containers per session")
+	serverCmd.PersistentFlags().String("session-max-memory", "", "Max total memory requests of running containers per session")
+	serverCmd.PersistentFlags().Duration("queue-max-wait", 5*time.Minute, "Max time a container waits in the start queue when limits are reached")
 	serverCmd.PersistentFlags().Bool("lock", false, "Lock namespace for this instance")
 	serverCmd.PersistentFlags().Duration("lock-timeout", 15*time.Minute, "Max time trying to acquire namespace lock")
 	serverCmd.PersistentFlags().StringP("verbosity", "v", "1", "Log verbosity level")
 	serverCmd.PersistentFlags().BoolP("prune-start", "P", false, "Prune all existing kubedock resources before starting")
 	serverCmd.PersistentFlags().Bool("port-forward", false, "Open port-forwards for all services")
 	serverCmd.PersistentFlags().Bool("reverse-proxy", false, "Reverse proxy all services via 0.0.0.0 on the kubedock host as well")
+	serverCmd.PersistentFlags().String("proxy-listen-addr", "", "Listen address of a socks5 and http connect proxy to reach pods in the namespace (e.g. :1080)")
+	serverCmd.PersistentFlags().String("proxy-mode", "auto", "Connect to pods via the proxy directly or via port-forward streams (auto, direct or port-forward)")
+	serverCmd.PersistentFlags().String("expose", "", "Expose containers outside the cluster via a nodeport, loadbalancer, ingress or route")
+	serverCmd.PersistentFlags().String("expose-domain", "", "Domain used for the host names of containers exposed via an ingress or route")
+	serverCmd.PersistentFlags().String("capture-dir", "", "Directory to record connections proxied by the reverse-proxy, for containers with the capture label")
+	serverCmd.PersistentFlags().String("capture-format", "pcapng", "Format of the recorded connections (pcapng or hexdump)")
+	serverCmd.PersistentFlags().Int("capture-max-size", 10, "Max size of a recorded connection in MB (0 is unlimited)")
 	serverCmd.PersistentFlags().Bool("pre-archive", false, "Enable support for copying single files to containers without starting them")
 
 	viper.BindPFlag("server.listen-addr", serverCmd.PersistentFlags().Lookup("listen-addr"))
@@ -70,18 +99,47 @@ func init() {
 	viper.BindPFlag("kubernetes.service-account", serverCmd.PersistentFlags().Lookup("service-account"))
 	viper.BindPFlag("kubernetes.image-pull-secrets", serverCmd.PersistentFlags().Lookup("image-pull-secrets"))
 	viper.BindPFlag("kubernetes.pod-template", serverCmd.PersistentFlags().Lookup("pod-template"))
+	viper.BindPFlag("kubernetes.owner-pod", serverCmd.PersistentFlags().Lookup("owner-pod"))
+	viper.BindPFlag("kubernetes.pod-patch-allow", serverCmd.PersistentFlags().Lookup("pod-patch-allow"))
 	viper.BindPFlag("kubernetes.timeout", serverCmd.PersistentFlags().Lookup("timeout"))
 	viper.BindPFlag("kubernetes.request-cpu", serverCmd.PersistentFlags().Lookup("request-cpu"))
 	viper.BindPFlag("kubernetes.request-memory", serverCmd.PersistentFlags().Lookup("request-memory"))
 	viper.BindPFlag("kubernetes.runas-user", serverCmd.PersistentFlags().Lookup("runas-user"))
+	viper.BindPFlag("kubernetes.network-affinity", serverCmd.PersistentFlags().Lookup("network-affinity"))
+	viper.BindPFlag("webhook.url", serverCmd.PersistentFlags().Lookup("webhook-url"))
+	viper.BindPFlag("webhook.timeout", serverCmd.PersistentFlags().Lookup("webhook-timeout"))
+	viper.BindPFlag("webhook.fail-open", serverCmd.PersistentFlags().Lookup("webhook-fail-open"))
 	viper.BindPFlag("registry.inspector", serverCmd.PersistentFlags().Lookup("inspector"))
+	viper.BindPFlag("registry.image-rewrite", serverCmd.PersistentFlags().Lookup("image-rewrite"))
+	viper.BindPFlag("registry.image-policy", serverCmd.PersistentFlags().Lookup("image-policy"))
+	viper.BindPFlag("registry.image-allow", serverCmd.PersistentFlags().Lookup("image-allow"))
+	viper.BindPFlag("registry.image-deny", serverCmd.PersistentFlags().Lookup("image-deny"))
+	viper.BindPFlag("registry.image-require-digest", serverCmd.PersistentFlags().Lookup("image-require-digest"))
 	viper.BindPFlag("reaper.reapmax", serverCmd.PersistentFlags().Lookup("reapmax"))
+	viper.BindPFlag("reaper.reapmax-exec", serverCmd.PersistentFlags().Lookup("reapmax-exec"))
+	viper.BindPFlag("reaper.reapmax-network", serverCmd.PersistentFlags().Lookup("reapmax-network"))
+	viper.BindPFlag("reaper.reapmax-image", serverCmd.PersistentFlags().Lookup("reapmax-image"))
+	viper.BindPFlag("reaper.heartbeat-timeout", serverCmd.PersistentFlags().Lookup("heartbeat-timeout"))
+	viper.BindPFlag("queue.max-containers", serverCmd.PersistentFlags().Lookup("max-containers"))
+	viper.BindPFlag("queue.max-cpu", serverCmd.PersistentFlags().Lookup("max-cpu"))
+	viper.BindPFlag("queue.max-memory", serverCmd.PersistentFlags().Lookup("max-memory"))
+	viper.BindPFlag("queue.session-max-containers", serverCmd.PersistentFlags().Lookup("session-max-containers"))
+	viper.BindPFlag("queue.session-max-cpu", serverCmd.PersistentFlags().Lookup("session-max-cpu"))
+	viper.BindPFlag("queue.session-max-memory", serverCmd.PersistentFlags().Lookup("session-max-memory"))
+	viper.BindPFlag("queue.max-wait", serverCmd.PersistentFlags().Lookup("queue-max-wait"))
 	viper.BindPFlag("lock.enabled", serverCmd.PersistentFlags().Lookup("lock"))
 	viper.BindPFlag("lock.timeout", serverCmd.PersistentFlags().Lookup("lock-timeout"))
 	viper.BindPFlag("verbosity", serverCmd.PersistentFlags().Lookup("verbosity"))
 	viper.BindPFlag("prune-start", serverCmd.PersistentFlags().Lookup("prune-start"))
 	viper.BindPFlag("port-forward", serverCmd.PersistentFlags().Lookup("port-forward"))
 	viper.BindPFlag("reverse-proxy", serverCmd.PersistentFlags().Lookup("reverse-proxy"))
+	viper.BindPFlag("proxy.listen-addr", serverCmd.PersistentFlags().Lookup("proxy-listen-addr"))
+	viper.BindPFlag("proxy.mode", serverCmd.PersistentFlags().Lookup("proxy-mode"))
+	viper.BindPFlag("expose.mode", serverCmd.PersistentFlags().Lookup("expose"))
+	viper.BindPFlag("expose.domain", serverCmd.PersistentFlags().Lookup("expose-domain"))
+	viper.BindPFlag("capture.dir", serverCmd.PersistentFlags().Lookup("capture-dir"))
+	viper.BindPFlag("capture.format", serverCmd.PersistentFlags().Lookup("capture-format"))
+	viper.BindPFlag("capture.max-size", serverCmd.PersistentFlags().Lookup("capture-max-size"))
 	viper.BindPFlag("pre-archive", serverCmd.PersistentFlags().Lookup("pre-archive"))
 
 	viper.BindEnv("server.listen-addr", "SERVER_LISTEN_ADDR")
@@ -94,12 +152,41 @@ func init() {
 	viper.BindEnv("kubernetes.service-account", "SERVICE_ACCOUNT")
 	viper.BindEnv("kubernetes.image-pull-secrets", "IMAGE_PULL_SECRETS")
 	viper.BindEnv("kubernetes.pod-template", "POD_TEMPLATE")
+	viper.BindEnv("kubernetes.owner-pod", "K8S_OWNER_POD")
+	viper.BindEnv("kubernetes.pod-patch-allow", "POD_PATCH_ALLOW")
 	viper.BindEnv("kubernetes.timeout", "TIME_OUT")
 	viper.BindEnv("kubernetes.request-cpu", "K8S_REQUEST_CPU")
 	viper.BindEnv("kubernetes.request-memory", "K8S_REQUEST_MEMORY")
 	viper.BindEnv("kubernetes.runas-user", "K8S_RUNAS_USER")
+	viper.BindEnv("kubernetes.network-affinity", "K8S_NETWORK_AFFINITY")
 	viper.BindEnv("kubernetes.timeout", "TIME_OUT")
 	viper.BindEnv("reaper.reapmax", "REAPER_REAPMAX")
+	viper.BindEnv("reaper.reapmax-exec", "REAPER_REAPMAX_EXEC")
+	viper.BindEnv("reaper.reapmax-network", "REAPER_REAPMAX_NETWORK")
+	viper.BindEnv("reaper.reapmax-image", "REAPER_REAPMAX_IMAGE")
+	viper.BindEnv("reaper.heartbeat-timeout", "REAPER_HEARTBEAT_TIMEOUT")
+	viper.BindEnv("registry.image-rewrite", "IMAGE_REWRITE")
+	viper.BindEnv("registry.image-policy", "IMAGE_POLICY")
+	viper.BindEnv("registry.image-allow", "IMAGE_ALLOW")
+	viper.BindEnv("registry.image-deny", "IMAGE_DENY")
+	viper.BindEnv("registry.image-require-digest", "IMAGE_REQUIRE_DIGEST")
+	viper.BindEnv("queue.max-containers", "MAX_CONTAINERS")
+	viper.BindEnv("queue.max-cpu", "MAX_CPU")
+	viper.BindEnv("queue.max-memory", "MAX_MEMORY")
+	viper.BindEnv("queue.session-max-containers", "SESSION_MAX_CONTAINERS")
+	viper.BindEnv("queue.session-max-cpu", "SESSION_MAX_CPU")
+	viper.BindEnv("queue.session-max-memory", "SESSION_MAX_MEMORY")
+	viper.BindEnv("queue.max-wait", "QUEUE_MAX_WAIT")
+	viper.BindEnv("proxy.listen-addr", "PROXY_LISTEN_ADDR")
+	viper.BindEnv("proxy.mode", "PROXY_MODE")
+	viper.BindEnv("expose.mode", "EXPOSE")
+	viper.BindEnv("expose.domain", "EXPOSE_DOMAIN")
+	viper.BindEnv("capture.dir", "CAPTURE_DIR")
+	viper.BindEnv("capture.format", "CAPTURE_FORMAT")
+	viper.BindEnv("capture.max-size", "CAPTURE_MAX_SIZE")
+	viper.BindEnv("webhook.url", "WEBHOOK_URL")
+	viper.BindEnv("webhook.timeout", "WEBHOOK_TIMEOUT")
+	viper.BindEnv("webhook.fail-open", "WEBHOOK_FAIL_OPEN")
 
 	serverCmd.PersistentFlags().Lookup("tls-enable").Hidden = true
 	serverCmd.PersistentFlags().Lookup("tls-key-file").Hidden = true
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"flag"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal"
+	"github.com/joyrex2001/kubedock/internal/tunnel"
+)
+
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel",
+	Short: "Connect to a kubedock instance running inside the cluster",
+	// the flags are bound in PreRun, as viper only keeps the last bound flag
+	// for a key, and the server command binds the same keys.
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("kubernetes.namespace", cmd.Flags().Lookup("namespace"))
+		viper.BindPFlag("kubernetes.kubeconfig", cmd.Flags().Lookup("kubeconfig"))
+		viper.BindPFlag("verbosity", cmd.Flags().Lookup("verbosity"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		flag.Set("v", viper.GetString("verbosity"))
+		pod, _ := cmd.Flags().GetString("pod")
+		selector, _ := cmd.Flags().GetString("selector")
+		port, _ := cmd.Flags().GetInt("remote-port")
+		addr, _ := cmd.Flags().GetString("listen-addr")
+		socket, _ := cmd.Flags().GetString("unix-socket")
+		err := internal.Tunnel(tunnel.Config{
+			Pod:        pod,
+			Selector:   selector,
+			RemotePort: port,
+			ListenAddr: addr,
+			Socket:     socket,
+		})
+		if err != nil {
+			klog.Fatalf("error running tunnel: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelCmd)
+
+	tunnelCmd.Flags().StringP("namespace", "n", getContextNamespace(), "Namespace in which kubedock is running")
+	tunnelCmd.Flags().String("pod", "", "Name of the kubedock pod (instead of using the selector)")
+	tunnelCmd.Flags().String("selector", "app=kubedock", "Label selector to find the kubedock pod")
+	tunnelCmd.Flags().Int("remote-port", 2475, "Port of the kubedock api in the pod")
+	tunnelCmd.Flags().String("listen-addr", "127.0.0.1:2475", "Local address of the kubedock api")
+	tunnelCmd.Flags().String("unix-socket", "", "Local unix socket of the kubedock api (instead of listen-addr)")
+	tunnelCmd.Flags().StringP("verbosity", "v", "1", "Log verbosity level")
+	if home := homeDir(); home != "" {
+		tunnelCmd.Flags().String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+	} else {
+		tunnelCmd.Flags().String("kubeconfig", "", "absolute path to the kubeconfig file")
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"time"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/klog"
 
+	"github.com/joyrex2001/kubedock/internal/config"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 )
 
@@ -65,6 +67,10 @@ func (in *instance) DeleteContainer(tainr *types.Container) error {
 		klog.Errorf("error deleting configmaps: %s", err)
 		ok = false
 	}
+	if err := in.deleteExposed("kubedock.containerid=" + tainr.ShortID); err != nil {
+		klog.Errorf("error deleting exposed resources: %s", err)
+		ok = false
+	}
 	if err := in.deletePods("kubedock.containerid=" + tainr.ShortID); err != nil {
 		klog.Errorf("error deleting pods: %s", err)
 		ok = false
@@ -75,58 +81,81 @@ func (in *instance) DeleteContainer(tainr *types.Container) error {
 	return nil
 }
 
-// DeleteOlderThan will delete all kubedock created resources older
-// than the given keepmax duration.
+// DeleteOlderThan will delete all kubedock created resources that are not
+// orchestrated by this kubedock instance, and of which the instance is no
+// longer alive. If the instance has a heartbeat lease, the resources are
+// deleted once the lease has expired, otherwise they are deleted if they
+// are older than the given keepmax duration. The heartbeat leases are
+// retrieved once, and the leases that were expired at that moment are
+// deleted afterwards, if all resources have been deleted successfully.
 func (in *instance) DeleteOlderThan(keepmax time.Duration) error {
-	if err := in.DeleteContainersOlderThan(keepmax); err != nil {
+	leases := in.getHeartbeatsOrNone()
+	expired := map[string]coordinationv1.Lease{}
+	for id, lease := range leases {
+		if in.isHeartbeatExpired(lease) {
+			expired[id] = lease
+		}
+	}
+	if err := in.DeleteContainersOlderThan(keepmax, leases); err != nil {
 		return err
 	}
-	if err := in.DeleteConfigMapsOlderThan(keepmax); err != nil {
+	if err := in.DeleteConfigMapsOlderThan(keepmax, leases); err != nil {
 		return err
 	}
-	if err := in.DeletePodsOlderThan(keepmax); err != nil {
+	if err := in.DeletePodsOlderThan(keepmax, leases); err != nil {
 		return err
 	}
-	return in.DeleteServicesOlderThan(keepmax)
+	if err := in.DeleteServicesOlderThan(keepmax, leases); err != nil {
+		return err
+	}
+	return in.deleteExpiredHeartbeats(expired)
 }
 
 // DeleteContainersOlderThan will delete containers than are orchestrated
-// by kubedock and are older than the given keepmax duration.
-func (in *instance) DeleteContainersOlderThan(keepmax time.Duration) error {
+// by other kubedock instances that are no longer alive, according to the
+// given heartbeat leases (see DeleteOlderThan).
+func (in *instance) DeleteContainersOlderThan(keepmax time.Duration, leases map[string]coordinationv1.Lease) error {
 	pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), metav1.ListOptions{
-		LabelSelector: "kubedock=true",
+		LabelSelector: in.getForeignSelector(),
 	})
 	if err != nil {
 		return err
 	}
+	ok := true
 	for _, pod := range pods.Items {
-		if in.isOlderThan(pod.ObjectMeta, keepmax) {
+		if in.isOrphaned(pod.ObjectMeta, keepmax, leases) {
 			klog.V(3).Infof("deleting pod: %s", pod.Name)
 			if err := in.deleteServices("kubedock.containerid=" + pod.Name); err != nil {
 				klog.Errorf("error deleting services: %s", err)
+				ok = false
 			}
 			if err := in.deleteConfigMaps("kubedock.containerid=" + pod.Name); err != nil {
 				klog.Errorf("error deleting configmaps: %s", err)
+				ok = false
 			}
 			if err := in.cli.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{}); err != nil {
 				return err
 			}
 		}
 	}
+	if !ok {
+		return fmt.Errorf("failed deleting resources of orphaned containers")
+	}
 	return nil
 }
 
 // DeleteServicesOlderThan will delete services than are orchestrated
-// by kubedock and are older than the given keepmax duration.
-func (in *instance) DeleteServicesOlderThan(keepmax time.Duration) error {
+// by other kubedock instances that are no longer alive, according to the
+// given heartbeat leases (see DeleteOlderThan).
+func (in *instance) DeleteServicesOlderThan(keepmax time.Duration, leases map[string]coordinationv1.Lease) error {
 	svcs, err := in.cli.CoreV1().Services(in.namespace).List(context.Background(), metav1.ListOptions{
-		LabelSelector: "kubedock=true",
+		LabelSelector: in.getForeignSelector(),
 	})
 	if err != nil {
 		return err
 	}
 	for _, svc := range svcs.Items {
-		if in.isOlderThan(svc.ObjectMeta, keepmax) {
+		if in.isOrphaned(svc.ObjectMeta, keepmax, leases) {
 			klog.V(3).Infof("deleting service: %s", svc.Name)
 			if err := in.cli.CoreV1().Services(svc.Namespace).Delete(context.Background(), svc.Name, metav1.DeleteOptions{}); err != nil {
 				return err
@@ -137,16 +166,17 @@ func (in *instance) DeleteServicesOlderThan(keepmax time.Duration) error {
 }
 
 // DeleteConfigMapsOlderThan will delete configmaps than are orchestrated
-// by kubedock and are older than the given keepmax duration.
-func (in *instance) DeleteConfigMapsOlderThan(keepmax time.Duration) error {
+// by other kubedock instances that are no longer alive, according to the
+// given heartbeat leases (see DeleteOlderThan).
+func (in *instance) DeleteConfigMapsOlderThan(keepmax time.Duration, leases map[string]coordinationv1.Lease) error {
 	svcs, err := in.cli.CoreV1().ConfigMaps(in.namespace).List(context.Background(), metav1.ListOptions{
-		LabelSelector: "kubedock=true",
+		LabelSelector: in.getForeignSelector(),
 	})
 	if err != nil {
 		return err
 	}
 	for _, svc := range svcs.Items {
-		if in.isOlderThan(svc.ObjectMeta, keepmax) {
+		if in.isOrphaned(svc.ObjectMeta, keepmax, leases) {
 			klog.V(3).Infof("deleting service: %s", svc.Name)
 			if err := in.cli.CoreV1().ConfigMaps(svc.Namespace).Delete(context.Background(), svc.Name, metav1.DeleteOptions{}); err != nil {
 				return err
@@ -156,17 +186,18 @@ func (in *instance) DeleteConfigMapsOlderThan(keepmax time.Duration) error {
 	return nil
 }
 
-// DeletePodsOlderThan will delete pods than are orchestrated by kubedock
-// and are older than the given keepmax duration.
-func (in *instance) DeletePodsOlderThan(keepmax time.Duration) error {
+// DeletePodsOlderThan will delete pods than are orchestrated by other
+// kubedock instances that are no longer alive, according to the given
+// heartbeat leases (see DeleteOlderThan).
+func (in *instance) DeletePodsOlderThan(keepmax time.Duration, leases map[string]coordinationv1.Lease) error {
 	pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), metav1.ListOptions{
-		LabelSelector: "kubedock=true",
+		LabelSelector: in.getForeignSelector(),
 	})
 	if err != nil {
 		return err
 	}
 	for _, pod := range pods.Items {
-		if in.isOlderThan(pod.ObjectMeta, keepmax) {
+		if in.isOrphaned(pod.ObjectMeta, keepmax, leases) {
 			klog.V(3).Infof("deleting pod: %s", pod.Name)
 			background := metav1.DeletePropagationBackground
 			if err := in.cli.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{
@@ -179,6 +210,52 @@ func (in *instance) DeletePodsOlderThan(keepmax time.Duration) error {
 	return nil
 }
 
+// getForeignSelector will return the label selector that matches all
+// kubedock resources that are not orchestrated by this instance.
+func (in *instance) getForeignSelector() string {
+	return "kubedock=true,kubedock.id!=" + config.InstanceID
+}
+
+// getHeartbeatsOrNone will return the heartbeat leases of all kubedock
+// instances, or no leases if they can't be retrieved; in which case the
+// age of the resources will be used to determine if they are orphaned.
+func (in *instance) getHeartbeatsOrNone() map[string]coordinationv1.Lease {
+	leases, err := in.getHeartbeats()
+	if err != nil {
+		klog.V(2).Infof("error retrieving heartbeats: %s", err)
+		return map[string]coordinationv1.Lease{}
+	}
+	return leases
+}
+
+// isOrphaned will check if given resource metadata belongs to a kubedock
+// instance that is no longer alive. If the instance has a heartbeat lease,
+// it's orphaned if the lease has expired, otherwise it's orphaned if it's
+// older than given keepmax duration.
+func (in *instance) isOrphaned(met metav1.ObjectMeta, keepmax time.Duration, leases map[string]coordinationv1.Lease) bool {
+	_, ok := in.getOrphanReason(met, keepmax, leases)
+	return ok
+}
+
+// getOrphanReason will return the reason why given resource metadata is
+// considered to be orphaned, and false if it's not orphaned (see isOrphaned).
+func (in *instance) getOrphanReason(met metav1.ObjectMeta, keepmax time.Duration, leases map[string]coordinationv1.Lease) (string, bool) {
+	if met.DeletionTimestamp != nil {
+		klog.V(3).Infof("ignoring %v, already in deleting state", met)
+		return "", false
+	}
+	if lease, ok := leases[met.Labels["kubedock.id"]]; ok {
+		if in.isHeartbeatExpired(lease) {
+			return "heartbeat of instance expired", true
+		}
+		return "", false
+	}
+	if in.isOlderThan(met, keepmax) {
+		return fmt.Sprintf("older than %s and instance has no heartbeat", keepmax), true
+	}
+	return "", false
+}
+
 // isOlderThan will check if given resource metadata has an older timestamp
 // compared to given keepmax duration
 func (in *instance) isOlderThan(met metav1.ObjectMeta, keepmax time.Duration) bool {
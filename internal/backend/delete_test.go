@@ -288,7 +288,7 @@ func TestDeleteContainersOlderThan(t *testing.T) {
 	}
 
 	for i, tst := range tests {
-		tst.kub.DeleteContainersOlderThan(100 * time.Millisecond)
+		tst.kub.DeleteContainersOlderThan(100*time.Millisecond, nil)
 		pods, _ := tst.kub.cli.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
 		cnt := len(pods.Items)
 		if cnt != tst.cnt {
@@ -344,7 +344,7 @@ func TestDeletePodsOlderThan(t *testing.T) {
 	}
 
 	for i, tst := range tests {
-		tst.kub.DeletePodsOlderThan(100 * time.Millisecond)
+		tst.kub.DeletePodsOlderThan(100*time.Millisecond, nil)
 		pods, _ := tst.kub.cli.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
 		cnt := len(pods.Items)
 		if cnt != tst.cnt {
@@ -400,7 +400,7 @@ func TestServiceContainersOlderThan(t *testing.T) {
 	}
 
 	for i, tst := range tests {
-		tst.kub.DeleteServicesOlderThan(100 * time.Millisecond)
+		tst.kub.DeleteServicesOlderThan(100*time.Millisecond, nil)
 		svcs, _ := tst.kub.cli.CoreV1().Services("default").List(context.Background(), metav1.ListOptions{})
 		cnt := len(svcs.Items)
 		if cnt != tst.cnt {
@@ -456,7 +456,7 @@ func TestDeleteConfigMapsOlderThan(t *testing.T) {
 	}
 
 	for i, tst := range tests {
-		tst.kub.DeleteConfigMapsOlderThan(100 * time.Millisecond)
+		tst.kub.DeleteConfigMapsOlderThan(100*time.Millisecond, nil)
 		cms, _ := tst.kub.cli.CoreV1().ConfigMaps("default").List(context.Background(), metav1.ListOptions{})
 		cnt := len(cms.Items)
 		if cnt != tst.cnt {
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"regexp"
+	"sort"
 	"sync"
 	"time"
 
@@ -16,9 +17,9 @@ import (
 	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/util/exec"
-	"github.com/joyrex2001/kubedock/internal/util/podtemplate"
 	"github.com/joyrex2001/kubedock/internal/util/portforward"
 	"github.com/joyrex2001/kubedock/internal/util/reverseproxy"
 	"github.com/joyrex2001/kubedock/internal/util/tar"
@@ -65,32 +66,70 @@ func (in *instance) startContainer(tainr *types.Container) (DeployState, error)
 		return DeployFailed, err
 	}
 
-	pod := &corev1.Pod{}
-	if in.podTemplate != "" {
-		pod, err = podtemplate.PodFromFile(in.podTemplate)
-		if err != nil {
-			return DeployFailed, fmt.Errorf("error opening podtemplate: %w", err)
-		}
+	secctx, err := tainr.GetContainerSecurityContext()
+	if err != nil {
+		return DeployFailed, err
+	}
+
+	hostname, subdomain, err := tainr.GetHostname()
+	if err != nil {
+		return DeployFailed, err
+	}
+
+	dnspol, dnscfg, err := tainr.GetDNSConfig()
+	if err != nil {
+		return DeployFailed, err
+	}
+
+	pod, err := in.getPodTemplate(tainr)
+	if err != nil {
+		return DeployFailed, fmt.Errorf("error opening podtemplate: %w", err)
 	}
 
 	pod.ObjectMeta.Name = tainr.GetPodName()
 	pod.ObjectMeta.Namespace = in.namespace
 	pod.ObjectMeta.Labels = in.getLabels(pod.ObjectMeta.Labels, tainr)
 	pod.ObjectMeta.Annotations = in.getAnnotations(pod.ObjectMeta.Annotations, tainr)
-	pod.Spec.Containers = []corev1.Container{{
-		Image:           tainr.Image,
+	pod.Spec.Containers = in.mergeContainers(pod.Spec.Containers, corev1.Container{
+		Image:           in.getImage(tainr.Image),
 		Name:            "main",
 		Command:         tainr.Entrypoint,
 		Args:            tainr.Cmd,
 		Env:             tainr.GetEnvVar(),
+		WorkingDir:      tainr.WorkingDir,
 		Ports:           in.getContainerPorts(tainr),
 		Resources:       reqlimits,
 		ImagePullPolicy: pulpol,
-	}}
+		SecurityContext: secctx,
+	})
 	pod.Spec.ServiceAccountName = tainr.GetServiceAccountName(pod.Spec.ServiceAccountName)
 	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
 
-	seccontext, err := tainr.GetPodSecurityContext(pod.Spec.SecurityContext)
+	if err := in.addScheduling(tainr, pod); err != nil {
+		return DeployFailed, err
+	}
+
+	if err := in.addNetworkAffinity(tainr, pod); err != nil {
+		return DeployFailed, err
+	}
+
+	if hostname != "" {
+		pod.Spec.Hostname = hostname
+	}
+	if subdomain != "" {
+		pod.Spec.Subdomain = subdomain
+	}
+	if dnscfg != nil {
+		pod.Spec.DNSPolicy = dnspol
+		pod.Spec.DNSConfig = dnscfg
+	}
+
+	lookup, err := in.getUserLookup(tainr)
+	if err != nil {
+		return DeployFailed, err
+	}
+
+	seccontext, err := tainr.GetPodSecurityContext(pod.Spec.SecurityContext, lookup)
 	if err != nil {
 		return DeployFailed, err
 	}
@@ -106,10 +145,33 @@ func (in *instance) startContainer(tainr *types.Container) (DeployState, error)
 		}
 	}
 
-	if _, err := in.cli.CoreV1().Pods(in.namespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+	if err := in.addTmpfsVolumes(tainr, pod); err != nil {
+		return DeployFailed, err
+	}
+
+	if err := in.applyPodPatch(tainr, pod); err != nil {
+		return DeployFailed, err
+	}
+
+	if err := in.MapContainerTCPPorts(tainr); err != nil {
 		return DeployFailed, err
 	}
 
+	svcs := in.getServices(tainr)
+	if err := in.callWebhook(tainr, pod, &svcs); err != nil {
+		return DeployFailed, err
+	}
+
+	in.addOwner(pod)
+	created, err := in.cli.CoreV1().Pods(in.namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	if err != nil {
+		return DeployFailed, err
+	}
+
+	if err := in.setConfigMapsOwner(tainr, created); err != nil {
+		klog.Warningf("error setting owner of configmaps: %s", err)
+	}
+
 	if tainr.HasVolumes() {
 		if err := in.copyVolumeFolders(tainr, in.timeOut); err != nil {
 			return DeployFailed, err
@@ -121,12 +183,15 @@ func (in *instance) startContainer(tainr *types.Container) (DeployState, error)
 		return state, err
 	}
 
-	if err := in.MapContainerTCPPorts(tainr); err != nil {
-		return DeployFailed, err
+	if err := in.createServices(svcs, created); err != nil {
+		return state, err
 	}
 
-	if err := in.createServices(tainr); err != nil {
-		return state, err
+	if err := in.exposeContainer(tainr, created); err != nil {
+		if derr := in.DeleteContainer(tainr); derr != nil {
+			klog.Errorf("error rolling back container %s: %s", tainr.ShortID, derr)
+		}
+		return DeployFailed, err
 	}
 
 	return state, nil
@@ -143,25 +208,33 @@ func (in *instance) CreatePortForwards(tainr *types.Container) {
 	}
 }
 
-// portForward will create port-forwards for all mapped ports.
+// portForward will create supervised port-forwards for all mapped ports,
+// which will reconnect if they fail, or if the pod is recreated.
 func (in *instance) portForward(tainr *types.Container, ports map[int]int) error {
 	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
+	resolve := func() (*corev1.Pod, error) {
+		return in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
+	}
 	for src, dst := range ports {
 		if src < 0 {
 			continue
 		}
 		stop := make(chan struct{}, 1)
 		tainr.AddStopChannel(stop)
-		go portforward.ToPod(portforward.Request{
+		go portforward.Supervise(portforward.Request{
 			RestConfig: in.cfg,
 			Pod:        *pod,
 			LocalPort:  src,
 			PodPort:    dst,
 			StopCh:     stop,
-			ReadyCh:    make(chan struct{}, 1),
+			Activity:   tainr.Touch,
+			Resolve:    resolve,
+			OnStatus: func(st portforward.Status) {
+				tainr.SetPortForwardStatus(types.PortForwardStatus(st))
+			},
 		})
 	}
 	return nil
@@ -177,6 +250,11 @@ func (in *instance) CreateReverseProxies(tainr *types.Container) {
 // reverseProxy will create reverse proxies to given container for
 // given ports.
 func (in *instance) reverseProxy(tainr *types.Container, ports map[int]int) {
+	txs, err := in.getToxics(tainr)
+	if err != nil {
+		klog.Errorf("error loading toxics for container %s: %s", tainr.ShortID, err)
+	}
+	tainr.InitToxics(txs)
 	var wg sync.WaitGroup
 	for src, dst := range ports {
 		if src < 0 {
@@ -188,12 +266,25 @@ func (in *instance) reverseProxy(tainr *types.Container, ports map[int]int) {
 			klog.Infof("reverse proxy for %d to %d", src, dst)
 			stop := make(chan struct{}, 1)
 			tainr.AddStopChannel(stop)
+			var capture *reverseproxy.Capture
+			if in.capture != nil && tainr.IsCapturePort(dst) {
+				capture = &reverseproxy.Capture{
+					Dir:     in.capture.Dir,
+					Format:  in.capture.Format,
+					MaxSize: in.capture.MaxSize,
+					Prefix:  fmt.Sprintf("%s-%d", tainr.ShortID, dst),
+				}
+			}
 			err := reverseproxy.Proxy(reverseproxy.Request{
-				LocalPort:  src,
-				RemotePort: dst,
-				RemoteIP:   tainr.HostIP,
-				StopCh:     stop,
-				MaxRetry:   30,
+				LocalPort:     src,
+				RemotePort:    dst,
+				RemoteIP:      tainr.HostIP,
+				StopCh:        stop,
+				MaxRetry:      30,
+				Activity:      tainr.Touch,
+				Toxics:        func() reverseproxy.Toxics { return reverseproxy.Toxics(tainr.GetToxics(dst)) },
+				ToxicsChanged: tainr.ToxicsChanged,
+				Capture:       capture,
 			})
 			if err != nil {
 				klog.Errorf("error setting up reverse-proxy for %d to %d: %s", src, dst, err)
@@ -203,6 +294,25 @@ func (in *instance) reverseProxy(tainr *types.Container, ports map[int]int) {
 	wg.Wait()
 }
 
+// getToxics will return the toxics as configured with the toxics labels of
+// the given container, by container port (where port 0 applies to all
+// ports).
+func (in *instance) getToxics(tainr *types.Container) (map[int]types.Toxics, error) {
+	res := map[int]types.Toxics{}
+	specs, err := tainr.GetToxicsLabels()
+	if err != nil {
+		return res, err
+	}
+	for port, spec := range specs {
+		tx, err := reverseproxy.ParseToxics(spec)
+		if err != nil {
+			return res, fmt.Errorf("invalid toxics %s: %w", spec, err)
+		}
+		res[port] = types.Toxics(tx)
+	}
+	return res, nil
+}
+
 // GetPodIP will return the ip of the given container.
 func (in *instance) GetPodIP(tainr *types.Container) (string, error) {
 	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), tainr.GetPodName(), metav1.GetOptions{})
@@ -213,9 +323,11 @@ func (in *instance) GetPodIP(tainr *types.Container) (string, error) {
 }
 
 // createServices will create k8s service objects for each provided
-// external name, mapped with provided hostports ports.
-func (in *instance) createServices(tainr *types.Container) error {
-	for _, svc := range in.getServices(tainr) {
+// external name, mapped with provided hostports ports. The services will
+// be owned by the given pod.
+func (in *instance) createServices(svcs []corev1.Service, owner *corev1.Pod) error {
+	for _, svc := range svcs {
+		svc.ObjectMeta.OwnerReferences = append(svc.ObjectMeta.OwnerReferences, in.getPodOwnerReference(owner))
 		if _, err := in.cli.CoreV1().Services(in.namespace).Create(context.Background(), &svc, metav1.CreateOptions{}); err != nil {
 			return err
 		}
@@ -224,16 +336,15 @@ func (in *instance) createServices(tainr *types.Container) error {
 }
 
 // getServices will return corev1 services objects for the given
-// container definition.
+// container definition. If the container doesn't have any ports, the
+// services will be headless.
 func (in *instance) getServices(tainr *types.Container) []corev1.Service {
 	svcs := []corev1.Service{}
 	ports := tainr.GetServicePorts()
-	if len(ports) == 0 {
-		// no ports available, can't create a service without ports
-		if len(tainr.NetworkAliases) > 0 {
-			klog.Infof("ignoring network aliases %v, no ports mapped", tainr.NetworkAliases)
-		}
-		return svcs
+	if len(ports) == 0 && len(tainr.NetworkAliases) > 0 {
+		// no ports available, fall back to headless services which will
+		// resolve the alias to the pod ip directly
+		klog.V(2).Infof("no ports mapped, creating headless services for network aliases %v", tainr.NetworkAliases)
 	}
 	valid := regexp.MustCompile("^[a-z]([-a-z0-9]*[a-z0-9])?$")
 	for _, alias := range tainr.NetworkAliases {
@@ -253,6 +364,9 @@ func (in *instance) getServices(tainr *types.Container) []corev1.Service {
 				Ports:    []corev1.ServicePort{},
 			},
 		}
+		if len(ports) == 0 {
+			svc.Spec.ClusterIP = corev1.ClusterIPNone
+		}
 		for src, dst := range ports {
 			svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
 				Name:       fmt.Sprintf("tcp-%d-%d", src, dst),
@@ -345,6 +459,9 @@ func (in *instance) GetContainerStatus(tainr *types.Container) (DeployState, err
 		return DeployFailed, err
 	}
 	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != "main" {
+			continue
+		}
 		term := status.State.Terminated
 		ters := status.LastTerminationState.Terminated
 		if (ters != nil && ters.Reason == "Completed") || (term != nil && term.Reason == "Completed") {
@@ -392,21 +509,22 @@ func (in *instance) waitInitContainerRunning(tainr *types.Container, name string
 
 // addVolumes will add an init-container "setup" and creates volumes and
 // volume mounts in both the init container and "main" container in order
-// to copy data before the container is started. If files are inclueded,
-// rather than folders, it will create a configmap, and mounts the files
-// from this created configmap.
+// to copy data before the container is started. The setup container will
+// be the first init container, and volumes from the pod template are kept.
+// If files are inclueded, rather than folders, it will create a configmap,
+// and mounts the files from this created configmap.
 func (in *instance) addVolumes(tainr *types.Container, pod *corev1.Pod) error {
 	pulpol, err := tainr.GetImagePullPolicy()
 	if err != nil {
 		return err
 	}
 
-	pod.Spec.InitContainers = []corev1.Container{{
+	setup := corev1.Container{
 		Name:            "setup",
-		Image:           in.initImage,
+		Image:           in.getImage(in.initImage),
 		ImagePullPolicy: pulpol,
 		Command:         []string{"sh", "-c", "while [ ! -f /tmp/done ]; do sleep 0.1 ; done"},
-	}}
+	}
 
 	volumes := []corev1.Volume{}
 	mounts := []corev1.VolumeMount{}
@@ -464,9 +582,183 @@ func (in *instance) addVolumes(tainr *types.Container, pod *corev1.Pod) error {
 		}
 	}
 
-	pod.Spec.Volumes = volumes
-	pod.Spec.Containers[0].VolumeMounts = mounts
-	pod.Spec.InitContainers[0].VolumeMounts = mounts
+	setup.VolumeMounts = mounts
+	pod.Spec.InitContainers = append([]corev1.Container{setup}, pod.Spec.InitContainers...)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, volumes...)
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, mounts...)
+
+	return nil
+}
+
+// getPodTemplate will return the pod that should be used as the base for
+// the given container. This is either the template selected with the pod
+// template label, a template matching the image, or the default template.
+// The image rewrite rules are applied to the containers of the template.
+func (in *instance) getPodTemplate(tainr *types.Container) (*corev1.Pod, error) {
+	if in.podTemplates == nil {
+		if name := tainr.Labels[types.LabelPodTemplate]; name != "" {
+			return nil, fmt.Errorf("pod template %s not found", name)
+		}
+		return &corev1.Pod{}, nil
+	}
+	pod, err := in.podTemplates.Get(tainr.Labels[types.LabelPodTemplate], tainr.Image)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[i].Image = in.getImage(pod.Spec.InitContainers[i].Image)
+	}
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Image = in.getImage(pod.Spec.Containers[i].Image)
+	}
+	return pod, nil
+}
+
+// addScheduling will add the node selector, tolerations, priority class and
+// runtime class of the container to the given pod. Settings that were
+// already present (e.g. via the pod template) are used as a base.
+func (in *instance) addScheduling(tainr *types.Container, pod *corev1.Pod) error {
+	sel, err := tainr.GetNodeSelector(pod.Spec.NodeSelector)
+	if err != nil {
+		return err
+	}
+	pod.Spec.NodeSelector = sel
+
+	tols, err := tainr.GetTolerations()
+	if err != nil {
+		return err
+	}
+	pod.Spec.Tolerations = append(pod.Spec.Tolerations, tols...)
+
+	pc, err := tainr.GetPriorityClassName(pod.Spec.PriorityClassName)
+	if err != nil {
+		return err
+	}
+	pod.Spec.PriorityClassName = pc
+
+	rc, err := tainr.GetRuntimeClassName(pod.Spec.RuntimeClassName)
+	if err != nil {
+		return err
+	}
+	pod.Spec.RuntimeClassName = rc
+
+	return nil
+}
+
+// addNetworkAffinity will add a preferred pod affinity (colocate) or
+// anti-affinity (spread) for pods that share any of the user defined
+// networks the container is connected to, if network affinity is
+// configured. The pod is labeled with these networks, so other pods can
+// match on them. Pre-defined networks (e.g. bridge) are ignored, as all
+// containers are connected to these by default.
+func (in *instance) addNetworkAffinity(tainr *types.Container, pod *corev1.Pod) error {
+	mode, err := tainr.GetNetworkAffinity()
+	if err != nil {
+		return err
+	}
+	if mode == types.NetworkAffinityNone {
+		return nil
+	}
+
+	ids, err := in.getUserNetworks(tainr)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	terms := []corev1.WeightedPodAffinityTerm{}
+	for _, id := range ids {
+		key := in.getNetworkLabel(id)
+		if pod.ObjectMeta.Labels == nil {
+			pod.ObjectMeta.Labels = map[string]string{}
+		}
+		pod.ObjectMeta.Labels[key] = "true"
+		terms = append(terms, corev1.WeightedPodAffinityTerm{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{key: "true"}},
+				TopologyKey:   corev1.LabelHostname,
+			},
+		})
+	}
+
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if mode == types.NetworkAffinityColocate {
+		if pod.Spec.Affinity.PodAffinity == nil {
+			pod.Spec.Affinity.PodAffinity = &corev1.PodAffinity{}
+		}
+		aff := pod.Spec.Affinity.PodAffinity
+		aff.PreferredDuringSchedulingIgnoredDuringExecution = append(aff.PreferredDuringSchedulingIgnoredDuringExecution, terms...)
+	}
+	if mode == types.NetworkAffinitySpread {
+		if pod.Spec.Affinity.PodAntiAffinity == nil {
+			pod.Spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		aff := pod.Spec.Affinity.PodAntiAffinity
+		aff.PreferredDuringSchedulingIgnoredDuringExecution = append(aff.PreferredDuringSchedulingIgnoredDuringExecution, terms...)
+	}
+
+	return nil
+}
+
+// getUserNetworks will return the sorted ids of the networks the container
+// is connected to, excluding the pre-defined networks.
+func (in *instance) getUserNetworks(tainr *types.Container) ([]string, error) {
+	db, err := model.New()
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for id := range tainr.Networks {
+		if netw, err := db.GetNetwork(id); err == nil && netw.IsPredefined() {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// getNetworkLabel will return the pod label that is used to identify pods
+// that are connected to the given network.
+func (in *instance) getNetworkLabel(id string) string {
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return "kubedock.network." + id
+}
+
+// addTmpfsVolumes will add memory backed emptyDir volumes for all tmpfs
+// mounts and the shared memory of the container, and mounts these in the
+// "main" container.
+func (in *instance) addTmpfsVolumes(tainr *types.Container, pod *corev1.Pod) error {
+	tmpfs, err := tainr.GetTmpfsMounts()
+	if err != nil {
+		return err
+	}
+
+	dsts := []string{}
+	for dst := range tmpfs {
+		dsts = append(dsts, dst)
+	}
+	sort.Strings(dsts)
+
+	for _, dst := range dsts {
+		id := "tmpfs-" + in.fileID(dst)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: id,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{
+				Medium:    corev1.StorageMediumMemory,
+				SizeLimit: tmpfs[dst],
+			}},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts,
+			corev1.VolumeMount{Name: id, MountPath: dst})
+	}
 
 	return nil
 }
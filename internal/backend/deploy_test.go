@@ -1,9 +1,12 @@
 package backend
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -11,7 +14,10 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
 
+	"github.com/joyrex2001/kubedock/internal/model"
 	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/util/image"
+	"github.com/joyrex2001/kubedock/internal/util/podtemplate"
 )
 
 var tarSingle = []byte{
@@ -335,7 +341,7 @@ func TestWaitReadyState(t *testing.T) {
 					},
 					Status: corev1.PodStatus{
 						ContainerStatuses: []corev1.ContainerStatus{
-							{RestartCount: 1},
+							{Name: "main", RestartCount: 1},
 						},
 					},
 				}),
@@ -355,7 +361,7 @@ func TestWaitReadyState(t *testing.T) {
 					},
 					Status: corev1.PodStatus{
 						ContainerStatuses: []corev1.ContainerStatus{
-							{LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+							{Name: "main", LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
 						},
 					},
 				}),
@@ -501,6 +507,131 @@ func TestAddVolumes(t *testing.T) {
 	}
 }
 
+func TestAddTmpfsVolumes(t *testing.T) {
+	tests := []struct {
+		in    *types.Container
+		count int
+		err   bool
+	}{
+		{in: &types.Container{}, count: 0},
+		{in: &types.Container{ShmSize: 1073741824}, count: 1},
+		{in: &types.Container{ShmSize: 1073741824, Tmpfs: map[string]string{"/run": "size=64m", "/tmp": ""}}, count: 3},
+		{in: &types.Container{Tmpfs: map[string]string{"/run": "size=lots"}}, err: true},
+	}
+
+	for i, tst := range tests {
+		pod := &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Volumes:    []corev1.Volume{{Name: "existing"}},
+				Containers: []corev1.Container{{}},
+			},
+		}
+		kub := &instance{}
+		err := kub.addTmpfsVolumes(tst.in, pod)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if count := len(pod.Spec.Volumes) - 1; count != tst.count {
+			t.Errorf("failed test %d - expected %d volumes, but got %d", i, tst.count, count)
+		}
+		if count := len(pod.Spec.Containers[0].VolumeMounts); count != tst.count {
+			t.Errorf("failed test %d - expected %d mounts, but got %d", i, tst.count, count)
+		}
+		for _, vol := range pod.Spec.Volumes[1:] {
+			if vol.EmptyDir == nil || vol.EmptyDir.Medium != corev1.StorageMediumMemory {
+				t.Errorf("failed test %d - expected memory backed emptyDir for %s", i, vol.Name)
+			}
+		}
+	}
+}
+
+func TestAddNetworkAffinity(t *testing.T) {
+	db, err := model.New()
+	if err != nil {
+		t.Fatalf("unexpected error instantiating database: %s", err)
+	}
+	bridge, err := db.GetNetworkByName("bridge")
+	if err != nil {
+		t.Fatalf("unexpected error getting bridge network: %s", err)
+	}
+	netw := "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		in       *types.Container
+		labels   map[string]string
+		affinity int
+		anti     int
+		err      bool
+	}{
+		{in: &types.Container{}},
+		{
+			in: &types.Container{Networks: map[string]interface{}{netw: nil}},
+		},
+		{
+			in:       &types.Container{Networks: map[string]interface{}{netw: nil}, Labels: map[string]string{types.LabelNetworkAffinity: "colocate"}},
+			labels:   map[string]string{"kubedock.network.0123456789ab": "true"},
+			affinity: 1,
+		},
+		{
+			in:     &types.Container{Networks: map[string]interface{}{netw: nil, "fedcba": nil}, Labels: map[string]string{types.LabelNetworkAffinity: "Spread"}},
+			labels: map[string]string{"kubedock.network.0123456789ab": "true", "kubedock.network.fedcba": "true"},
+			anti:   2,
+		},
+		{
+			in: &types.Container{Labels: map[string]string{types.LabelNetworkAffinity: "colocate"}},
+		},
+		{
+			in:       &types.Container{Networks: map[string]interface{}{bridge.ID: nil, netw: nil}, Labels: map[string]string{types.LabelNetworkAffinity: "colocate"}},
+			labels:   map[string]string{"kubedock.network.0123456789ab": "true"},
+			affinity: 1,
+		},
+		{
+			in: &types.Container{Networks: map[string]interface{}{bridge.ID: nil}, Labels: map[string]string{types.LabelNetworkAffinity: "spread"}},
+		},
+		{
+			in:  &types.Container{Labels: map[string]string{types.LabelNetworkAffinity: "together"}},
+			err: true,
+		},
+	}
+
+	for i, tst := range tests {
+		pod := &corev1.Pod{}
+		kub := &instance{}
+		err := kub.addNetworkAffinity(tst.in, pod)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if len(pod.ObjectMeta.Labels) > 0 || len(tst.labels) > 0 {
+			if !reflect.DeepEqual(pod.ObjectMeta.Labels, tst.labels) {
+				t.Errorf("failed test %d - expected labels %v, but got %v", i, tst.labels, pod.ObjectMeta.Labels)
+			}
+		}
+		affinity, anti := 0, 0
+		if aff := pod.Spec.Affinity; aff != nil {
+			if aff.PodAffinity != nil {
+				affinity = len(aff.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+			}
+			if aff.PodAntiAffinity != nil {
+				anti = len(aff.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+			}
+		}
+		if affinity != tst.affinity || anti != tst.anti {
+			t.Errorf("failed test %d - expected %d/%d affinity terms, but got %d/%d", i, tst.affinity, tst.anti, affinity, anti)
+		}
+	}
+}
+
 func TestContainerPorts(t *testing.T) {
 	tests := []struct {
 		in    *types.Container
@@ -563,6 +694,9 @@ func TestGetServices(t *testing.T) {
 		{in: &types.Container{NetworkAliases: []string{"tb303", "tr909"}, ExposedPorts: map[string]interface{}{"100/tcp": 1}, HostPorts: map[int]int{200: 200}}, svcs: 2, ports: 2},
 		{in: &types.Container{NetworkAliases: []string{"tb303_"}, ExposedPorts: map[string]interface{}{"100/tcp": 1}}, svcs: 0, ports: 0},
 		{in: &types.Container{NetworkAliases: []string{"303"}, ExposedPorts: map[string]interface{}{"100/tcp": 1}}, svcs: 0, ports: 0},
+		{in: &types.Container{NetworkAliases: []string{"tb303"}}, svcs: 1, ports: 0},
+		{in: &types.Container{NetworkAliases: []string{"tb303", "tr909"}}, svcs: 2, ports: 0},
+		{in: &types.Container{NetworkAliases: []string{"tb303_"}}, svcs: 0, ports: 0},
 	}
 	for i, tst := range tests {
 		kub := &instance{}
@@ -574,6 +708,12 @@ func TestGetServices(t *testing.T) {
 		if count > 0 && tst.ports > 0 && len(res[0].Spec.Ports) != tst.ports {
 			t.Errorf("failed test %d - expected %d ports, but got %d", i, tst.ports, len(res[0].Spec.Ports))
 		}
+		for _, svc := range res {
+			headless := svc.Spec.ClusterIP == corev1.ClusterIPNone
+			if headless != (tst.ports == 0) {
+				t.Errorf("failed test %d - expected headless to be %t, but got %t", i, tst.ports == 0, headless)
+			}
+		}
 	}
 
 	kub := &instance{}
@@ -617,3 +757,80 @@ func TestGetAnnotations(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPodTemplateImages(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pod.yaml")
+	tmpl := `
+apiVersion: v1
+kind: Pod
+spec:
+  initContainers:
+  - name: init
+    image: busybox
+  containers:
+  - name: logger
+    image: quay.io/fluentbit/fluent-bit
+`
+	if err := os.WriteFile(file, []byte(tmpl), 0644); err != nil {
+		t.Fatalf("unexpected error writing template: %s", err)
+	}
+	tpls, err := podtemplate.Load(file)
+	if err != nil {
+		t.Fatalf("unexpected error loading template: %s", err)
+	}
+	rw, err := image.NewRewriter([]string{"docker.io/=mirror.corp/dockerhub/", `~^quay\.io/(.*)$=mirror.corp/quay/$1`})
+	if err != nil {
+		t.Fatalf("unexpected error creating rewriter: %s", err)
+	}
+	kub := &instance{podTemplates: tpls, imageRewriter: rw, initImage: "alpine:3"}
+	pod, err := kub.getPodTemplate(&types.Container{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	kub.addVolumes(&types.Container{Binds: []string{".:/remote:rw"}}, pod)
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{in: pod.Spec.InitContainers[0].Image, out: "mirror.corp/dockerhub/library/alpine:3"},
+		{in: pod.Spec.InitContainers[1].Image, out: "mirror.corp/dockerhub/library/busybox:latest"},
+		{in: pod.Spec.Containers[0].Image, out: "mirror.corp/quay/fluentbit/fluent-bit:latest"},
+	}
+	for i, tst := range tests {
+		if tst.in != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, tst.in)
+		}
+	}
+}
+
+func TestGetToxics(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		out    map[int]types.Toxics
+		err    bool
+	}{
+		{labels: map[string]string{}, out: map[int]types.Toxics{}},
+		{
+			labels: map[string]string{types.LabelToxics: "latency=100ms", types.LabelToxics + ".5432": "bandwidth=64"},
+			out: map[int]types.Toxics{
+				0:    {Latency: 100 * time.Millisecond},
+				5432: {Bandwidth: 64},
+			},
+		},
+		{labels: map[string]string{types.LabelToxics + ".http": "latency=100ms"}, err: true},
+		{labels: map[string]string{types.LabelToxics: "latency=slow"}, err: true},
+	}
+	for i, tst := range tests {
+		kub := &instance{}
+		res, err := kub.getToxics(&types.Container{Labels: tst.labels})
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if !tst.err && !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/joyrex2001/kubedock/internal/util/portforward"
+)
+
+// dialTimeout is the max time to wait for a direct connection to a pod.
+const dialTimeout = 10 * time.Second
+
+// DialPod will open a tcp connection to the given port of a pod in the
+// namespace. The host is either the ip or name of the pod, or the name of a
+// service (e.g. a network alias), in which case the port is mapped to the
+// target port of the service. Only pods and services that are created by
+// kubedock (labeled kubedock=true) can be dialed. If direct is set, the ip of the pod is dialed
+// directly (which requires kubedock to run inside the cluster), otherwise
+// a port-forward stream is used.
+func (in *instance) DialPod(host string, port int, direct bool) (net.Conn, error) {
+	pod, port, err := in.resolvePod(host, port)
+	if err != nil {
+		return nil, err
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil, fmt.Errorf("pod %s is not running", pod.Name)
+	}
+	if direct {
+		return net.DialTimeout("tcp", net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)), dialTimeout)
+	}
+	return portforward.Dial(in.cfg, *pod, port)
+}
+
+// resolvePod will return the pod and the pod port for the given host and
+// port (see DialPod).
+func (in *instance) resolvePod(host string, port int) (*corev1.Pod, int, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: "kubedock=true",
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, pod := range pods.Items {
+			if pod.Status.PodIP == ip.String() {
+				return &pod, port, nil
+			}
+		}
+		return nil, 0, fmt.Errorf("no kubedock pod with ip %s in namespace %s", host, in.namespace)
+	}
+
+	name := in.getShortHostname(host)
+	if svc, err := in.cli.CoreV1().Services(in.namespace).Get(context.Background(), name, metav1.GetOptions{}); err == nil && in.isManaged(svc.ObjectMeta) {
+		return in.resolveServicePod(svc, port)
+	}
+
+	pod, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil || !in.isManaged(pod.ObjectMeta) {
+		return nil, 0, fmt.Errorf("no kubedock service or pod %s in namespace %s", name, in.namespace)
+	}
+	return pod, port, nil
+}
+
+// isManaged will return true if the given resource is created by kubedock.
+func (in *instance) isManaged(met metav1.ObjectMeta) bool {
+	return met.Labels["kubedock"] == "true"
+}
+
+// resolveServicePod will return a running pod that is selected by given
+// service, and the target port of the given service port.
+func (in *instance) resolveServicePod(svc *corev1.Service, port int) (*corev1.Pod, int, error) {
+	if len(svc.Spec.Selector) == 0 {
+		return nil, 0, fmt.Errorf("service %s has no pod selector", svc.Name)
+	}
+	for _, sp := range svc.Spec.Ports {
+		if int(sp.Port) == port && sp.TargetPort.IntVal != 0 {
+			port = int(sp.TargetPort.IntVal)
+			break
+		}
+	}
+	pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning && in.isManaged(pod.ObjectMeta) {
+			return &pod, port, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("no running pod for service %s", svc.Name)
+}
+
+// getShortHostname will return the name of the service or pod for given
+// host, which is either a plain name, or a fully qualified service name in
+// the namespace (e.g. name.namespace.svc.cluster.local).
+func (in *instance) getShortHostname(host string) string {
+	parts := strings.SplitN(host, ".", 3)
+	if len(parts) > 1 && parts[1] == in.namespace {
+		return parts[0]
+	}
+	return host
+}
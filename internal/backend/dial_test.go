@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolvePod(t *testing.T) {
+	pod := func(name, ip string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"kubedock": "true", "kubedock.containerid": name},
+			},
+			Status: corev1.PodStatus{PodIP: ip, Phase: phase},
+		}
+	}
+	kub := &instance{
+		namespace: "default",
+		cli: fake.NewSimpleClientset(
+			pod("tb303", "10.0.0.1", corev1.PodRunning),
+			pod("rc752", "10.0.0.2", corev1.PodPending),
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: "default"},
+				Status:     corev1.PodStatus{PodIP: "10.0.0.4", Phase: corev1.PodRunning},
+			},
+			&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "kubernetes", Namespace: "default"},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"kubedock.containerid": "tb303"},
+				},
+			},
+			&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "f1spirit", Namespace: "default", Labels: map[string]string{"kubedock": "true"}},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"kubedock.containerid": "tb303"},
+					Ports:    []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+				},
+			},
+			&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default", Labels: map[string]string{"kubedock": "true"}},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"kubedock.containerid": "rc752"},
+				},
+			},
+		),
+	}
+
+	tests := []struct {
+		host string
+		port int
+		pod  string
+		out  int
+		err  bool
+	}{
+		{host: "10.0.0.1", port: 80, pod: "tb303", out: 80},
+		{host: "10.0.0.2", port: 80, pod: "rc752", out: 80},
+		{host: "10.0.0.3", port: 80, err: true},
+		{host: "tb303", port: 80, pod: "tb303", out: 80},
+		{host: "f1spirit", port: 80, pod: "tb303", out: 8080},
+		{host: "f1spirit", port: 443, pod: "tb303", out: 443},
+		{host: "f1spirit.default.svc.cluster.local", port: 80, pod: "tb303", out: 8080},
+		{host: "f1spirit.other.svc.cluster.local", port: 80, err: true},
+		{host: "pending", port: 80, err: true},
+		{host: "unknown", port: 80, err: true},
+		{host: "10.0.0.4", port: 80, err: true},
+		{host: "unmanaged", port: 80, err: true},
+		{host: "kubernetes", port: 443, err: true},
+	}
+
+	for i, tst := range tests {
+		pod, port, err := kub.resolvePod(tst.host, tst.port)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+			continue
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if pod.Name != tst.pod || port != tst.out {
+			t.Errorf("failed test %d - expected %s:%d, but got %s:%d", i, tst.pod, tst.out, pod.Name, port)
+		}
+	}
+}
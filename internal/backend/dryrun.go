@@ -0,0 +1,112 @@
+package backend
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Candidate is a resource that would be deleted when reaping or pruning.
+type Candidate struct {
+	// Kind is the type of resource (e.g. pod, service, configmap or lease).
+	Kind string `json:"kind"`
+	// Name is the name, or id, of the resource.
+	Name string `json:"name"`
+	// Instance is the id of the kubedock instance that owns the resource.
+	Instance string `json:"instance"`
+	// Created is the creation time of the resource.
+	Created time.Time `json:"created"`
+	// Age is the age of the resource at the time of the dry-run.
+	Age string `json:"age"`
+	// Reason is the reason why the resource would be deleted.
+	Reason string `json:"reason"`
+}
+
+// NewCandidate will return a Candidate for given resource details.
+func NewCandidate(kind, name, instance string, created time.Time, reason string) Candidate {
+	return Candidate{
+		Kind:     kind,
+		Name:     name,
+		Instance: instance,
+		Created:  created,
+		Age:      time.Since(created).Round(time.Second).String(),
+		Reason:   reason,
+	}
+}
+
+// DeleteAllDryRun will return all resources that would be deleted by
+// DeleteAll, without actually deleting them.
+func (in *instance) DeleteAllDryRun() ([]Candidate, error) {
+	return in.getCandidates("kubedock=true", func(met metav1.ObjectMeta) (string, bool) {
+		return "prune all kubedock resources", true
+	})
+}
+
+// DeleteOlderThanDryRun will return all resources that would be deleted by
+// DeleteOlderThan, without actually deleting them.
+func (in *instance) DeleteOlderThanDryRun(keepmax time.Duration) ([]Candidate, error) {
+	leases := in.getHeartbeatsOrNone()
+	res, err := in.getCandidates(in.getForeignSelector(), func(met metav1.ObjectMeta) (string, bool) {
+		return in.getOrphanReason(met, keepmax, leases)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(leases))
+	for id := range leases {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if lease := leases[id]; in.isHeartbeatExpired(lease) {
+			res = append(res, NewCandidate("lease", lease.Name, id, lease.CreationTimestamp.Time, "heartbeat expired"))
+		}
+	}
+	return res, nil
+}
+
+// getCandidates will return all pods, services and configmaps that match
+// the given label selector, and for which the given reason function
+// returns true, together with the reason for deletion.
+func (in *instance) getCandidates(selector string, reason func(metav1.ObjectMeta) (string, bool)) ([]Candidate, error) {
+	type resource struct {
+		kind string
+		met  metav1.ObjectMeta
+	}
+	opts := metav1.ListOptions{LabelSelector: selector}
+	rscs := []resource{}
+
+	pods, err := in.cli.CoreV1().Pods(in.namespace).List(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		rscs = append(rscs, resource{"pod", pod.ObjectMeta})
+	}
+
+	svcs, err := in.cli.CoreV1().Services(in.namespace).List(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range svcs.Items {
+		rscs = append(rscs, resource{"service", svc.ObjectMeta})
+	}
+
+	cms, err := in.cli.CoreV1().ConfigMaps(in.namespace).List(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, cm := range cms.Items {
+		rscs = append(rscs, resource{"configmap", cm.ObjectMeta})
+	}
+
+	res := []Candidate{}
+	for _, rsc := range rscs {
+		if msg, ok := reason(rsc.met); ok {
+			res = append(res, NewCandidate(rsc.kind, rsc.met.Name, rsc.met.Labels["kubedock.id"], rsc.met.CreationTimestamp.Time, msg))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+func TestDeleteOlderThanDryRun(t *testing.T) {
+	secs := int32(60)
+	renew := metav1.NewMicroTime(time.Now().Add(-5 * time.Minute))
+	meta := func(name, id string, created time.Time) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{"kubedock": "true", "kubedock.id": id},
+		}
+	}
+
+	now := time.Now()
+	cli := fake.NewSimpleClientset(
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kubedock-crashed",
+				Namespace: "default",
+				Labels:    map[string]string{"kubedock.heartbeat": "true", "kubedock.id": "crashed"},
+			},
+			Spec: coordinationv1.LeaseSpec{LeaseDurationSeconds: &secs, RenewTime: &renew},
+		},
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kubedock-abandoned",
+				Namespace: "default",
+				Labels:    map[string]string{"kubedock.heartbeat": "true", "kubedock.id": "abandoned"},
+			},
+			Spec: coordinationv1.LeaseSpec{LeaseDurationSeconds: &secs, RenewTime: &renew},
+		},
+		&corev1.Pod{ObjectMeta: meta("crashed-new", "crashed", now)},
+		&corev1.Pod{ObjectMeta: meta("unknown-new", "unknown", now)},
+		&corev1.Pod{ObjectMeta: meta("self-old", config.InstanceID, now.Add(-24*time.Hour))},
+		&corev1.Service{ObjectMeta: meta("unknown-old", "unknown", now.Add(-24*time.Hour))},
+		&corev1.ConfigMap{ObjectMeta: meta("unknown-old", "unknown", now.Add(-24*time.Hour))},
+	)
+	kub := &instance{namespace: "default", cli: cli}
+
+	res, err := kub.DeleteOlderThanDryRun(time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exp := map[string]string{
+		"pod/crashed-new":          "crashed",
+		"service/unknown-old":      "unknown",
+		"configmap/unknown-old":    "unknown",
+		"lease/kubedock-crashed":   "crashed",
+		"lease/kubedock-abandoned": "abandoned",
+	}
+	if len(res) != len(exp) {
+		t.Errorf("expected %d candidates, but got %d: %v", len(exp), len(res), res)
+	}
+	leases := []string{}
+	for _, c := range res {
+		if c.Kind == "lease" {
+			leases = append(leases, c.Name)
+		}
+		id, ok := exp[c.Kind+"/"+c.Name]
+		if !ok {
+			t.Errorf("unexpected candidate %s/%s", c.Kind, c.Name)
+			continue
+		}
+		if c.Instance != id {
+			t.Errorf("expected instance %s for %s/%s, but got %s", id, c.Kind, c.Name, c.Instance)
+		}
+		if c.Reason == "" || c.Age == "" {
+			t.Errorf("expected reason and age for %s/%s, but got %v", c.Kind, c.Name, c)
+		}
+	}
+
+	if !reflect.DeepEqual(leases, []string{"kubedock-abandoned", "kubedock-crashed"}) {
+		t.Errorf("expected leases in order of instance, but got %v", leases)
+	}
+
+	pods, _ := cli.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	if len(pods.Items) != 3 {
+		t.Errorf("expected no pods to be deleted, but got %d remaining", len(pods.Items))
+	}
+}
+
+func TestDeleteAllDryRun(t *testing.T) {
+	cli := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "tb303", Namespace: "default", Labels: map[string]string{"kubedock": "true", "kubedock.id": config.InstanceID}}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "tb303", Namespace: "default", Labels: map[string]string{"kubedock": "true", "kubedock.id": "z80"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "rc752", Namespace: "default"}},
+	)
+	kub := &instance{namespace: "default", cli: cli}
+
+	res, err := kub.DeleteAllDryRun()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(res) != 2 {
+		t.Errorf("expected 2 candidates, but got %d: %v", len(res), res)
+	}
+	pods, _ := cli.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	if len(pods.Items) != 2 {
+		t.Errorf("expected no pods to be deleted, but got %d remaining", len(pods.Items))
+	}
+}
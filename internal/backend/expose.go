@@ -0,0 +1,344 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+const (
+	// ExposeNone will not expose containers outside the cluster.
+	ExposeNone = ""
+	// ExposeNodePort will expose containers via a NodePort service.
+	ExposeNodePort = "nodeport"
+	// ExposeLoadBalancer will expose containers via a LoadBalancer service.
+	ExposeLoadBalancer = "loadbalancer"
+	// ExposeIngress will expose containers via an Ingress (http only).
+	ExposeIngress = "ingress"
+	// ExposeRoute will expose containers via an OpenShift Route (http only).
+	ExposeRoute = "route"
+)
+
+// routeResource is the resource of OpenShift routes.
+var routeResource = schema.GroupVersionResource{Group: "route.openshift.io", Version: "v1", Resource: "routes"}
+
+// ValidateExpose will return an error if the given expose mode is not
+// supported, or if the mode requires a domain that is not given.
+func ValidateExpose(mode, domain string) error {
+	switch mode {
+	case ExposeNone, ExposeNodePort, ExposeLoadBalancer, ExposeRoute:
+		return nil
+	case ExposeIngress:
+		if domain == "" {
+			return fmt.Errorf("expose mode ingress requires a domain")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid expose mode %s (nodeport, loadbalancer, ingress or route)", mode)
+}
+
+// exposeContainer will make the ports of given container reachable from
+// outside the cluster with the configured expose mode, and waits until the
+// external address is known. The external addresses are stored in the
+// ExternalPorts of the container. The created resources will be owned by
+// the given pod.
+func (in *instance) exposeContainer(tainr *types.Container, owner *corev1.Pod) error {
+	ports := in.getExposePorts(tainr)
+	if in.expose == ExposeNone || len(ports) == 0 {
+		return nil
+	}
+
+	svc := in.getExposeService(tainr, ports, owner)
+	svc, err := in.cli.CoreV1().Services(in.namespace).Create(context.Background(), svc, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	var ext map[int]types.ExternalPort
+	switch in.expose {
+	case ExposeNodePort:
+		ext, err = in.getNodePortAddresses(svc, owner)
+	case ExposeLoadBalancer:
+		ext, err = in.waitLoadBalancerAddresses(svc)
+	case ExposeIngress:
+		ext, err = in.createIngress(tainr, svc, ports, owner)
+	case ExposeRoute:
+		ext, err = in.createRoutes(tainr, svc, ports, owner)
+	}
+	if err != nil {
+		return fmt.Errorf("error exposing container via %s: %w", in.expose, err)
+	}
+	for port, addr := range ext {
+		klog.Infof("exposed port %d of container %s on %s:%d", port, tainr.ShortID, addr.Host, addr.Port)
+	}
+	tainr.ExternalPorts = ext
+	return nil
+}
+
+// getExposePorts will return the container ports that should be exposed,
+// in ascending order.
+func (in *instance) getExposePorts(tainr *types.Container) []int {
+	done := map[int]bool{}
+	ports := []int{}
+	for _, dst := range tainr.GetServicePorts() {
+		if !done[dst] {
+			ports = append(ports, dst)
+			done[dst] = true
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// getExposeName will return the name of the resources that are created to
+// expose given container.
+func (in *instance) getExposeName(tainr *types.Container) string {
+	return "kubedock-" + tainr.ShortID
+}
+
+// getExposeService will return the service that is used to expose given
+// ports of the container. For nodeport and loadbalancer, the service itself
+// is exposed, otherwise it's the backend for the ingress or routes.
+func (in *instance) getExposeService(tainr *types.Container, ports []int, owner *corev1.Pod) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       in.namespace,
+			Name:            in.getExposeName(tainr),
+			Labels:          in.getLabels(nil, tainr),
+			Annotations:     in.getAnnotations(nil, tainr),
+			OwnerReferences: []metav1.OwnerReference{in.getPodOwnerReference(owner)},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: in.getPodMatchLabels(tainr),
+			Type:     corev1.ServiceTypeClusterIP,
+		},
+	}
+	switch in.expose {
+	case ExposeNodePort:
+		svc.Spec.Type = corev1.ServiceTypeNodePort
+	case ExposeLoadBalancer:
+		svc.Spec.Type = corev1.ServiceTypeLoadBalancer
+	}
+	for _, port := range ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+			Name:       fmt.Sprintf("tcp-%d", port),
+			Protocol:   corev1.ProtocolTCP,
+			Port:       int32(port),
+			TargetPort: intstr.FromInt(port),
+		})
+	}
+	return svc
+}
+
+// getNodePortAddresses will return the node ports of given service, on the
+// address of the node the given pod is running on.
+func (in *instance) getNodePortAddresses(svc *corev1.Service, pod *corev1.Pod) (map[int]types.ExternalPort, error) {
+	host, err := in.getNodeAddress(pod)
+	if err != nil {
+		return nil, err
+	}
+	res := map[int]types.ExternalPort{}
+	for _, sp := range svc.Spec.Ports {
+		if sp.NodePort == 0 {
+			return nil, fmt.Errorf("no node port allocated for port %d", sp.Port)
+		}
+		res[int(sp.Port)] = types.ExternalPort{Host: host, Port: int(sp.NodePort)}
+	}
+	return res, nil
+}
+
+// getNodeAddress will return the external ip of the node given pod is
+// running on, or the internal ip if the node has no external ip.
+func (in *instance) getNodeAddress(pod *corev1.Pod) (string, error) {
+	name := pod.Spec.NodeName
+	if name == "" {
+		cur, err := in.cli.CoreV1().Pods(in.namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		name = cur.Spec.NodeName
+	}
+	node, err := in.cli.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	addr := ""
+	for _, a := range node.Status.Addresses {
+		if a.Type == corev1.NodeExternalIP {
+			return a.Address, nil
+		}
+		if a.Type == corev1.NodeInternalIP && addr == "" {
+			addr = a.Address
+		}
+	}
+	if addr == "" {
+		return "", fmt.Errorf("no address found for node %s", name)
+	}
+	return addr, nil
+}
+
+// waitLoadBalancerAddresses will wait until the load balancer of given
+// service has an external address, and returns the service ports on that
+// address.
+func (in *instance) waitLoadBalancerAddresses(svc *corev1.Service) (map[int]types.ExternalPort, error) {
+	for max := 0; max < in.timeOut; max++ {
+		cur, err := in.cli.CoreV1().Services(in.namespace).Get(context.Background(), svc.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, lb := range cur.Status.LoadBalancer.Ingress {
+			host := lb.IP
+			if host == "" {
+				host = lb.Hostname
+			}
+			if host == "" {
+				continue
+			}
+			res := map[int]types.ExternalPort{}
+			for _, sp := range cur.Spec.Ports {
+				res[int(sp.Port)] = types.ExternalPort{Host: host, Port: int(sp.Port)}
+			}
+			return res, nil
+		}
+		time.Sleep(time.Second)
+	}
+	return nil, fmt.Errorf("timeout waiting for load balancer address of service %s", svc.Name)
+}
+
+// getExposeHost will return the host name for given port of the container,
+// or an empty string if no domain is configured.
+func (in *instance) getExposeHost(tainr *types.Container, port int) string {
+	if in.exposeDomain == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d.%s", in.getExposeName(tainr), port, in.exposeDomain)
+}
+
+// createIngress will create an ingress with a host for each given port of
+// the container, and returns these hosts on the http port.
+func (in *instance) createIngress(tainr *types.Container, svc *corev1.Service, ports []int, owner *corev1.Pod) (map[int]types.ExternalPort, error) {
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       in.namespace,
+			Name:            in.getExposeName(tainr),
+			Labels:          in.getLabels(nil, tainr),
+			Annotations:     in.getAnnotations(nil, tainr),
+			OwnerReferences: []metav1.OwnerReference{in.getPodOwnerReference(owner)},
+		},
+	}
+	res := map[int]types.ExternalPort{}
+	pathType := networkingv1.PathTypePrefix
+	for _, port := range ports {
+		host := in.getExposeHost(tainr, port)
+		ing.Spec.Rules = append(ing.Spec.Rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/",
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{
+							Service: &networkingv1.IngressServiceBackend{
+								Name: svc.Name,
+								Port: networkingv1.ServiceBackendPort{Number: int32(port)},
+							},
+						},
+					}},
+				},
+			},
+		})
+		res[port] = types.ExternalPort{Host: host, Port: 80}
+	}
+	if _, err := in.cli.NetworkingV1().Ingresses(in.namespace).Create(context.Background(), ing, metav1.CreateOptions{}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// createRoutes will create an OpenShift route for each given port of the
+// container, and returns the hosts of the routes on the http port. If no
+// domain is configured, the hosts are generated by OpenShift.
+func (in *instance) createRoutes(tainr *types.Container, svc *corev1.Service, ports []int, owner *corev1.Pod) (map[int]types.ExternalPort, error) {
+	if in.dyn == nil {
+		return nil, fmt.Errorf("no dynamic client configured")
+	}
+	routes := in.dyn.Resource(routeResource).Namespace(in.namespace)
+	res := map[int]types.ExternalPort{}
+	for _, port := range ports {
+		spec := map[string]interface{}{
+			"to":   map[string]interface{}{"kind": "Service", "name": svc.Name},
+			"port": map[string]interface{}{"targetPort": fmt.Sprintf("tcp-%d", port)},
+		}
+		if host := in.getExposeHost(tainr, port); host != "" {
+			spec["host"] = host
+		}
+		route := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "route.openshift.io/v1",
+			"kind":       "Route",
+			"spec":       spec,
+		}}
+		route.SetName(fmt.Sprintf("%s-%d", svc.Name, port))
+		route.SetNamespace(in.namespace)
+		route.SetLabels(in.getLabels(nil, tainr))
+		route.SetOwnerReferences([]metav1.OwnerReference{in.getPodOwnerReference(owner)})
+		created, err := routes.Create(context.Background(), route, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		host, _, _ := unstructured.NestedString(created.Object, "spec", "host")
+		if host == "" {
+			return nil, fmt.Errorf("no host assigned to route %s", created.GetName())
+		}
+		res[port] = types.ExternalPort{Host: host, Port: 80}
+	}
+	return res, nil
+}
+
+// deleteExposed will delete the ingresses or routes, depending on the
+// configured expose mode, which match the given label selector. These are
+// owned by the pod as well, but are deleted explicitly to make sure they
+// are gone when the container is started again.
+func (in *instance) deleteExposed(selector string) error {
+	switch in.expose {
+	case ExposeIngress:
+		ings, err := in.cli.NetworkingV1().Ingresses(in.namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return err
+		}
+		for _, ing := range ings.Items {
+			if err := in.cli.NetworkingV1().Ingresses(ing.Namespace).Delete(context.Background(), ing.Name, metav1.DeleteOptions{}); err != nil {
+				return err
+			}
+		}
+	case ExposeRoute:
+		if in.dyn == nil {
+			return nil
+		}
+		routes := in.dyn.Resource(routeResource).Namespace(in.namespace)
+		list, err := routes.List(context.Background(), metav1.ListOptions{
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return err
+		}
+		for _, route := range list.Items {
+			if err := routes.Delete(context.Background(), route.GetName(), metav1.DeleteOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestValidateExpose(t *testing.T) {
+	tests := []struct {
+		mode   string
+		domain string
+		err    bool
+	}{
+		{mode: ExposeNone},
+		{mode: ExposeNodePort},
+		{mode: ExposeLoadBalancer},
+		{mode: ExposeRoute},
+		{mode: ExposeIngress, err: true},
+		{mode: ExposeIngress, domain: "apps.example.com"},
+		{mode: "hostport", err: true},
+	}
+	for i, tst := range tests {
+		err := ValidateExpose(tst.mode, tst.domain)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded instead", i)
+		}
+	}
+}
+
+func TestExposeContainer(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			{Type: corev1.NodeExternalIP, Address: "192.168.1.1"},
+		}},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "f1spirit", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+	}
+	newClient := func() *fake.Clientset {
+		cli := fake.NewSimpleClientset(node, pod)
+		cli.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			svc := action.(k8stesting.CreateAction).GetObject().(*corev1.Service)
+			for i := range svc.Spec.Ports {
+				if svc.Spec.Type == corev1.ServiceTypeNodePort {
+					svc.Spec.Ports[i].NodePort = 30000 + svc.Spec.Ports[i].Port
+				}
+			}
+			if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+				svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}}
+			}
+			return false, nil, nil
+		})
+		return cli
+	}
+	newDynamic := func() *dynfake.FakeDynamicClient {
+		return dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{routeResource: "RouteList"})
+	}
+
+	tests := []struct {
+		kub *instance
+		in  *types.Container
+		out map[int]types.ExternalPort
+		err bool
+	}{
+		{
+			kub: &instance{namespace: "default", cli: newClient()},
+			in:  &types.Container{ShortID: "tb303", ExposedPorts: map[string]interface{}{"303/tcp": 0}},
+		},
+		{
+			kub: &instance{namespace: "default", cli: newClient(), expose: ExposeNodePort},
+			in:  &types.Container{ShortID: "tb303"},
+		},
+		{
+			kub: &instance{namespace: "default", cli: newClient(), expose: ExposeNodePort},
+			in:  &types.Container{ShortID: "tb303", ExposedPorts: map[string]interface{}{"303/tcp": 0}, HostPorts: map[int]int{8080: 80}},
+			out: map[int]types.ExternalPort{
+				80:  {Host: "192.168.1.1", Port: 30080},
+				303: {Host: "192.168.1.1", Port: 30303},
+			},
+		},
+		{
+			kub: &instance{namespace: "default", cli: newClient(), expose: ExposeLoadBalancer, timeOut: 1},
+			in:  &types.Container{ShortID: "tb303", ExposedPorts: map[string]interface{}{"303/tcp": 0}},
+			out: map[int]types.ExternalPort{303: {Host: "lb.example.com", Port: 303}},
+		},
+		{
+			kub: &instance{namespace: "default", cli: fake.NewSimpleClientset(), expose: ExposeLoadBalancer, timeOut: 1},
+			in:  &types.Container{ShortID: "tb303", ExposedPorts: map[string]interface{}{"303/tcp": 0}},
+			err: true,
+		},
+		{
+			kub: &instance{namespace: "default", cli: newClient(), expose: ExposeIngress, exposeDomain: "apps.example.com"},
+			in:  &types.Container{ShortID: "tb303", ExposedPorts: map[string]interface{}{"303/tcp": 0}},
+			out: map[int]types.ExternalPort{303: {Host: "kubedock-tb303-303.apps.example.com", Port: 80}},
+		},
+		{
+			kub: &instance{namespace: "default", cli: newClient(), dyn: newDynamic(), expose: ExposeRoute, exposeDomain: "apps.example.com"},
+			in:  &types.Container{ShortID: "tb303", ExposedPorts: map[string]interface{}{"303/tcp": 0}},
+			out: map[int]types.ExternalPort{303: {Host: "kubedock-tb303-303.apps.example.com", Port: 80}},
+		},
+		{
+			kub: &instance{namespace: "default", cli: newClient(), expose: ExposeRoute},
+			in:  &types.Container{ShortID: "tb303", ExposedPorts: map[string]interface{}{"303/tcp": 0}},
+			err: true,
+		},
+	}
+
+	for i, tst := range tests {
+		err := tst.kub.exposeContainer(tst.in, pod)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded instead", i)
+		}
+		if !reflect.DeepEqual(tst.in.ExternalPorts, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, tst.in.ExternalPorts)
+		}
+	}
+}
+
+func TestDeleteExposed(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "f1spirit", Namespace: "default"},
+	}
+	newDynamic := func() *dynfake.FakeDynamicClient {
+		return dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{routeResource: "RouteList"})
+	}
+	tests := []struct {
+		kub *instance
+	}{
+		{kub: &instance{namespace: "default", cli: fake.NewSimpleClientset(pod), expose: ExposeIngress, exposeDomain: "apps.example.com"}},
+		{kub: &instance{namespace: "default", cli: fake.NewSimpleClientset(pod), dyn: newDynamic(), expose: ExposeRoute, exposeDomain: "apps.example.com"}},
+	}
+	for i, tst := range tests {
+		tainr := &types.Container{ShortID: "tb303", ExposedPorts: map[string]interface{}{"303/tcp": 0}}
+		if err := tst.kub.exposeContainer(tainr, pod); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err := tst.kub.exposeContainer(tainr, pod); err == nil {
+			t.Errorf("failed test %d - expected error, but succeeded instead", i)
+		}
+		if err := tst.kub.DeleteContainer(tainr); err != nil {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+		if err := tst.kub.exposeContainer(tainr, pod); err != nil {
+			t.Errorf("failed test %d - unexpected error after delete %s", i, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+// heartbeatLabel is the label that is set on all heartbeat leases.
+const heartbeatLabel = "kubedock.heartbeat"
+
+// UpdateHeartbeat will create or renew the heartbeat lease of this kubedock
+// instance, which will expire after the given duration if not renewed.
+func (in *instance) UpdateHeartbeat(duration time.Duration) error {
+	leases := in.cli.CoordinationV1().Leases(in.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	secs := int32(duration.Seconds())
+
+	lease, err := leases.Get(context.Background(), in.getHeartbeatName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		labels := map[string]string{heartbeatLabel: "true"}
+		for k, v := range config.DefaultLabels {
+			labels[k] = v
+		}
+		id := config.InstanceID
+		owners := []metav1.OwnerReference{}
+		if in.owner != nil {
+			owners = append(owners, *in.owner)
+		}
+		_, err = leases.Create(context.Background(), &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            in.getHeartbeatName(),
+				Namespace:       in.namespace,
+				Labels:          labels,
+				OwnerReferences: owners,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &id,
+				LeaseDurationSeconds: &secs,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.LeaseDurationSeconds = &secs
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(context.Background(), lease, metav1.UpdateOptions{})
+	return err
+}
+
+// DeleteHeartbeat will delete the heartbeat lease of this kubedock instance.
+func (in *instance) DeleteHeartbeat() error {
+	err := in.cli.CoordinationV1().Leases(in.namespace).Delete(context.Background(), in.getHeartbeatName(), metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// getHeartbeatName will return the name of the heartbeat lease of this
+// kubedock instance.
+func (in *instance) getHeartbeatName() string {
+	return "kubedock-" + config.InstanceID
+}
+
+// getHeartbeats will return the heartbeat leases of all kubedock instances
+// in the namespace, indexed by kubedock instance id.
+func (in *instance) getHeartbeats() (map[string]coordinationv1.Lease, error) {
+	leases, err := in.cli.CoordinationV1().Leases(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: heartbeatLabel + "=true",
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]coordinationv1.Lease{}
+	for _, lease := range leases.Items {
+		if id := lease.ObjectMeta.Labels["kubedock.id"]; id != "" {
+			res[id] = lease
+		}
+	}
+	return res, nil
+}
+
+// isHeartbeatExpired will return true if the given heartbeat lease has not
+// been renewed within its lease duration.
+func (in *instance) isHeartbeatExpired(lease coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expires := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expires)
+}
+
+// deleteExpiredHeartbeats will delete the given heartbeat leases that are
+// expired.
+func (in *instance) deleteExpiredHeartbeats(leases map[string]coordinationv1.Lease) error {
+	for id, lease := range leases {
+		if !in.isHeartbeatExpired(lease) {
+			continue
+		}
+		klog.V(3).Infof("deleting expired heartbeat of instance %s", id)
+		err := in.cli.CoordinationV1().Leases(lease.Namespace).Delete(context.Background(), lease.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+)
+
+func TestUpdateHeartbeat(t *testing.T) {
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset()}
+	for i := 0; i < 2; i++ {
+		if err := kub.UpdateHeartbeat(time.Minute); err != nil {
+			t.Fatalf("failed test %d - unexpected error: %s", i, err)
+		}
+		leases, err := kub.getHeartbeats()
+		if err != nil {
+			t.Fatalf("failed test %d - unexpected error: %s", i, err)
+		}
+		lease, ok := leases[config.InstanceID]
+		if len(leases) != 1 || !ok {
+			t.Fatalf("failed test %d - expected heartbeat of this instance, but got %v", i, leases)
+		}
+		if kub.isHeartbeatExpired(lease) {
+			t.Errorf("failed test %d - expected heartbeat not to be expired", i)
+		}
+	}
+	if err := kub.DeleteHeartbeat(); err != nil {
+		t.Errorf("unexpected error deleting heartbeat: %s", err)
+	}
+	if err := kub.DeleteHeartbeat(); err != nil {
+		t.Errorf("unexpected error deleting heartbeat twice: %s", err)
+	}
+	if leases, _ := kub.getHeartbeats(); len(leases) != 0 {
+		t.Errorf("expected no heartbeats, but got %d", len(leases))
+	}
+}
+
+func TestDeleteOlderThanHeartbeat(t *testing.T) {
+	lease := func(id string, renewed time.Time) *coordinationv1.Lease {
+		secs := int32(60)
+		renew := metav1.NewMicroTime(renewed)
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kubedock-" + id,
+				Namespace: "default",
+				Labels:    map[string]string{"kubedock.heartbeat": "true", "kubedock.id": id},
+			},
+			Spec: coordinationv1.LeaseSpec{LeaseDurationSeconds: &secs, RenewTime: &renew},
+		}
+	}
+	pod := func(name, id string, created time.Time) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{"kubedock": "true", "kubedock.id": id},
+		}}
+	}
+
+	now := time.Now()
+	cli := fake.NewSimpleClientset(
+		lease("alive", now),
+		lease("crashed", now.Add(-5*time.Minute)),
+		pod("alive-old", "alive", now.Add(-24*time.Hour)),
+		pod("crashed-new", "crashed", now),
+		pod("unknown-new", "unknown", now),
+		pod("unknown-old", "unknown", now.Add(-24*time.Hour)),
+		pod("self-old", config.InstanceID, now.Add(-24*time.Hour)),
+	)
+	lists := 0
+	cli.PrependReactor("list", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lists++
+		return false, nil, nil
+	})
+	kub := &instance{namespace: "default", cli: cli}
+	if err := kub.DeleteOlderThan(time.Hour); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lists != 1 {
+		t.Errorf("expected heartbeats to be listed once, but got %d", lists)
+	}
+
+	for name, exists := range map[string]bool{
+		"alive-old":   true,
+		"crashed-new": false,
+		"unknown-new": true,
+		"unknown-old": false,
+		"self-old":    true,
+	} {
+		_, err := cli.CoreV1().Pods("default").Get(context.Background(), name, metav1.GetOptions{})
+		if (err == nil) != exists {
+			t.Errorf("expected pod %s to exist %t, but got %t", name, exists, err == nil)
+		}
+	}
+
+	leases, err := kub.getHeartbeats()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := leases["crashed"]; ok || len(leases) != 1 {
+		t.Errorf("expected only the alive heartbeat, but got %v", leases)
+	}
+}
+
+func TestDeleteOlderThanHeartbeatFailed(t *testing.T) {
+	secs := int32(60)
+	renew := metav1.NewMicroTime(time.Now().Add(-5 * time.Minute))
+	cli := fake.NewSimpleClientset(
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kubedock-crashed",
+				Namespace: "default",
+				Labels:    map[string]string{"kubedock.heartbeat": "true", "kubedock.id": "crashed"},
+			},
+			Spec: coordinationv1.LeaseSpec{LeaseDurationSeconds: &secs, RenewTime: &renew},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              "crashed-new",
+			Namespace:         "default",
+			CreationTimestamp: metav1.Now(),
+			Labels:            map[string]string{"kubedock": "true", "kubedock.id": "crashed"},
+		}},
+	)
+	cli.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("forbidden")
+	})
+	kub := &instance{namespace: "default", cli: cli}
+	if err := kub.DeleteOlderThan(time.Hour); err == nil {
+		t.Errorf("expected error, but succeeded without error")
+	}
+	leases, err := kub.getHeartbeats()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := leases["crashed"]; !ok {
+		t.Errorf("expected expired heartbeat to be kept while its resources are not reaped")
+	}
+}
@@ -1,15 +1,44 @@
 package backend
 
 import (
+	"fmt"
+
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/util/image"
 )
 
 // GetImageExposedPorts will inspect the image in the registry and return the
 // configured exposed ports from the image, or will return an error if failed.
 func (in *instance) GetImageExposedPorts(img string) (map[string]struct{}, error) {
-	cfg, err := image.InspectConfig("docker://" + img)
+	cfg, err := image.InspectConfig("docker://" + in.getImage(img))
 	if err != nil {
 		return nil, err
 	}
 	return cfg.Config.ExposedPorts, nil
 }
+
+// getUserLookup will return a UserLookup that resolves user and group names
+// as defined in the image of given container. If the container doesn't
+// run as a named user, it will return nil.
+func (in *instance) getUserLookup(tainr *types.Container) (types.UserLookup, error) {
+	if !tainr.HasNamedUser() {
+		return nil, nil
+	}
+	accts, err := image.InspectAccounts("docker://" + in.getImage(tainr.Image))
+	if err != nil {
+		return nil, fmt.Errorf("error resolving user in image %s: %w", tainr.Image, err)
+	}
+	return accts, nil
+}
+
+// getImage will return the image name that should be used to pull or
+// inspect given image, after applying the configured rewrite rules.
+func (in *instance) getImage(img string) string {
+	res := in.imageRewriter.Rewrite(img)
+	if res != img {
+		klog.V(2).Infof("rewriting image %s to %s", img, res)
+	}
+	return res
+}
@@ -3,25 +3,38 @@ package backend
 import (
 	"io"
 	"io/fs"
+	"net"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/util/image"
+	"github.com/joyrex2001/kubedock/internal/util/podtemplate"
+	"github.com/joyrex2001/kubedock/internal/util/reverseproxy"
 )
 
 // Backend is the interface to orchestrate and manage kubernetes objects.
 type Backend interface {
 	StartContainer(*types.Container) (DeployState, error)
+	ValidateContainer(*types.Container) error
 	GetContainerStatus(*types.Container) (DeployState, error)
 	CreatePortForwards(*types.Container)
 	CreateReverseProxies(*types.Container)
 	GetPodIP(*types.Container) (string, error)
+	DialPod(string, int, bool) (net.Conn, error)
 	DeleteAll() error
 	DeleteWithKubedockID(string) error
 	DeleteContainer(*types.Container) error
 	DeleteOlderThan(time.Duration) error
+	DeleteAllDryRun() ([]Candidate, error)
+	DeleteOlderThanDryRun(time.Duration) ([]Candidate, error)
+	UpdateHeartbeat(time.Duration) error
+	DeleteHeartbeat() error
 	WatchDeleteContainer(*types.Container) (chan struct{}, error)
 	CopyFromContainer(*types.Container, string, io.Writer) error
 	CopyToContainer(*types.Container, io.Reader, string) error
@@ -29,13 +42,24 @@ type Backend interface {
 	ExecContainer(*types.Container, *types.Exec, io.Reader, io.Writer) (int, error)
 	GetLogs(*types.Container, bool, int, chan struct{}, io.Writer) error
 	GetImageExposedPorts(string) (map[string]struct{}, error)
+	GetResourceQuotas() ([]corev1.ResourceQuota, error)
 }
 
 // instance is the internal representation of the Backend object.
 type instance struct {
 	cli              kubernetes.Interface
+	dyn              dynamic.Interface
 	cfg              *rest.Config
-	podTemplate      string
+	podTemplates     *podtemplate.Templates
+	podPatchAllow    []string
+	webhookURL       string
+	webhookTimeout   time.Duration
+	webhookFailOpen  bool
+	imageRewriter    *image.Rewriter
+	owner            *metav1.OwnerReference
+	capture          *reverseproxy.Capture
+	expose           string
+	exposeDomain     string
 	initImage        string
 	imagePullSecrets []string
 	namespace        string
@@ -46,6 +70,9 @@ type instance struct {
 type Config struct {
 	// Client is the kubernetes clientset
 	Client kubernetes.Interface
+	// DynamicClient is the optional kubernetes dynamic client, which is
+	// required to expose containers via OpenShift routes
+	DynamicClient dynamic.Interface
 	// RestConfig is the kubernetes config
 	RestConfig *rest.Config
 	// Namespace is the namespace in which all actions are performed
@@ -58,20 +85,58 @@ type Config struct {
 	// TimeOut is the max amount of time to wait until a container started
 	// or deleted.
 	TimeOut time.Duration
-	// PodTemplate refers to an optional file containig a pod resource that
-	// should be used as the base for creating pod resources.
-	PodTemplate string
+	// PodTemplates contains the optional (named) pod templates that should
+	// be used as the base for creating pod resources.
+	PodTemplates *podtemplate.Templates
+	// PodPatchAllow is the list of pod fields (e.g. spec.volumes) that are
+	// allowed to be modified with a pod patch label.
+	PodPatchAllow []string
+	// WebhookURL is the optional url of a webhook that is called before a
+	// pod is created, and can modify or deny the pod and its services.
+	WebhookURL string
+	// WebhookTimeout is the maximum amount of time to wait for the webhook.
+	WebhookTimeout time.Duration
+	// WebhookFailOpen will ignore webhook failures if set, rather than
+	// failing the deployment of the container.
+	WebhookFailOpen bool
+	// ImageRewriter is used to rewrite image names (e.g. to use a mirror)
+	// before they are pulled or inspected.
+	ImageRewriter *image.Rewriter
+	// Owner is an optional owner reference (e.g. to the kubedock pod) that
+	// is added to all created pods, so they are garbage collected when the
+	// owner is removed.
+	Owner *metav1.OwnerReference
+	// Capture is the optional configuration to record the connections that
+	// are proxied by the reverse-proxy, for containers that have the
+	// capture label set.
+	Capture *reverseproxy.Capture
+	// Expose is the mode used to make the containers reachable from outside
+	// the cluster (nodeport, loadbalancer, ingress or route), if set.
+	Expose string
+	// ExposeDomain is the domain used to create the host names of exposed
+	// containers when using ingresses or routes.
+	ExposeDomain string
 }
 
 // New will return an Backend instance.
 func New(cfg Config) Backend {
 	return &instance{
 		cli:              cfg.Client,
+		dyn:              cfg.DynamicClient,
 		cfg:              cfg.RestConfig,
 		initImage:        cfg.InitImage,
 		namespace:        cfg.Namespace,
 		imagePullSecrets: cfg.ImagePullSecrets,
-		podTemplate:      cfg.PodTemplate,
+		podTemplates:     cfg.PodTemplates,
+		podPatchAllow:    cfg.PodPatchAllow,
+		webhookURL:       cfg.WebhookURL,
+		webhookTimeout:   cfg.WebhookTimeout,
+		webhookFailOpen:  cfg.WebhookFailOpen,
+		imageRewriter:    cfg.ImageRewriter,
+		owner:            cfg.Owner,
+		capture:          cfg.Capture,
+		expose:           cfg.Expose,
+		exposeDomain:     cfg.ExposeDomain,
 		timeOut:          int(cfg.TimeOut.Seconds()),
 	}
 }
@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// getPodOwnerReference will return an owner reference to the given pod.
+func (in *instance) getPodOwnerReference(pod *corev1.Pod) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.ObjectMeta.Name,
+		UID:        pod.ObjectMeta.UID,
+	}
+}
+
+// addOwner will add the configured owner (the kubedock pod itself) as an
+// owner reference to the given pod, so the pod is garbage collected when
+// kubedock is removed.
+func (in *instance) addOwner(pod *corev1.Pod) {
+	if in.owner == nil {
+		return
+	}
+	pod.ObjectMeta.OwnerReferences = append(pod.ObjectMeta.OwnerReferences, *in.owner)
+}
+
+// setConfigMapsOwner will add an owner reference to the given pod to all
+// configmaps that were created for the given container, so they are
+// garbage collected when the pod is removed.
+func (in *instance) setConfigMapsOwner(tainr *types.Container, pod *corev1.Pod) error {
+	cms, err := in.cli.CoreV1().ConfigMaps(in.namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "kubedock.containerid=" + tainr.ShortID,
+	})
+	if err != nil {
+		return err
+	}
+	for _, cm := range cms.Items {
+		cm.ObjectMeta.OwnerReferences = append(cm.ObjectMeta.OwnerReferences, in.getPodOwnerReference(pod))
+		if _, err := in.cli.CoreV1().ConfigMaps(in.namespace).Update(context.Background(), &cm, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		klog.V(3).Infof("added owner %s to configmap %s", pod.Name, cm.Name)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestAddOwner(t *testing.T) {
+	owner := &metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "kubedock", UID: "303"}
+	tests := []struct {
+		kub    *instance
+		owners int
+	}{
+		{kub: &instance{}, owners: 0},
+		{kub: &instance{owner: owner}, owners: 1},
+	}
+	for i, tst := range tests {
+		pod := &corev1.Pod{}
+		tst.kub.addOwner(pod)
+		if len(pod.OwnerReferences) != tst.owners {
+			t.Errorf("failed test %d - expected %d owners, but got %d", i, tst.owners, len(pod.OwnerReferences))
+		}
+		if tst.owners > 0 && pod.OwnerReferences[0].UID != owner.UID {
+			t.Errorf("failed test %d - unexpected owner %v", i, pod.OwnerReferences[0])
+		}
+	}
+}
+
+func TestOwnedResources(t *testing.T) {
+	cm := func(name, id string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"kubedock.containerid": id},
+		}}
+	}
+	cli := fake.NewSimpleClientset(cm("tb303-vf", "tb303"), cm("tb303-pf", "tb303"), cm("sh101-vf", "sh101"))
+	kub := &instance{namespace: "default", cli: cli}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "tb303", UID: "6502"}}
+
+	if err := kub.setConfigMapsOwner(&types.Container{ShortID: "tb303"}, pod); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, owned := range map[string]bool{"tb303-vf": true, "tb303-pf": true, "sh101-vf": false} {
+		res, err := cli.CoreV1().ConfigMaps("default").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if (len(res.OwnerReferences) == 1 && res.OwnerReferences[0].UID == "6502") != owned {
+			t.Errorf("expected configmap %s owned %t, but got %v", name, owned, res.OwnerReferences)
+		}
+	}
+
+	svcs := []corev1.Service{{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}}}
+	if err := kub.createServices(svcs, pod); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	svc, err := cli.CoreV1().Services("default").Get(context.Background(), "db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(svc.OwnerReferences) != 1 || svc.OwnerReferences[0].Kind != "Pod" || svc.OwnerReferences[0].Name != "tb303" {
+		t.Errorf("expected service owned by pod tb303, but got %v", svc.OwnerReferences)
+	}
+}
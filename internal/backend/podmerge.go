@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// mergeContainers will merge the given "main" container with the containers
+// that are defined in the pod template. If the template contains a container
+// named "main", it will be used as an overlay for the main container. All
+// other template containers are kept as sidecars. The main container will
+// always be the first container in the returned list.
+func (in *instance) mergeContainers(tmpl []corev1.Container, main corev1.Container) []corev1.Container {
+	containers := []corev1.Container{main}
+	for _, c := range tmpl {
+		if c.Name == main.Name {
+			containers[0] = in.mergeContainer(c, main)
+			continue
+		}
+		containers = append(containers, c)
+	}
+	return containers
+}
+
+// mergeContainer will merge the given container into the given template
+// container. Settings that are derived from the container request take
+// precedence over settings in the template. Environment variables, ports,
+// resources, volume mounts and the security context are merged.
+func (in *instance) mergeContainer(tmpl, main corev1.Container) corev1.Container {
+	res := *tmpl.DeepCopy()
+	res.Name = main.Name
+	res.Image = main.Image
+	res.ImagePullPolicy = main.ImagePullPolicy
+	if len(main.Command) > 0 {
+		res.Command = main.Command
+	}
+	if len(main.Args) > 0 {
+		res.Args = main.Args
+	}
+	if main.WorkingDir != "" {
+		res.WorkingDir = main.WorkingDir
+	}
+	res.Ports = in.mergePorts(res.Ports, main.Ports)
+	res.Env = in.mergeEnv(res.Env, main.Env)
+	res.Resources = in.mergeResources(res.Resources, main.Resources)
+	res.VolumeMounts = append(res.VolumeMounts, main.VolumeMounts...)
+	res.SecurityContext = in.mergeSecurityContext(res.SecurityContext, main.SecurityContext)
+	return res
+}
+
+// mergeEnv will merge the given environment variables, variables in env
+// will replace variables with the same name in base.
+func (in *instance) mergeEnv(base, env []corev1.EnvVar) []corev1.EnvVar {
+	res := []corev1.EnvVar{}
+	names := map[string]bool{}
+	for _, e := range env {
+		names[e.Name] = true
+	}
+	for _, e := range base {
+		if !names[e.Name] {
+			res = append(res, e)
+		}
+	}
+	return append(res, env...)
+}
+
+// mergePorts will merge the given container ports, ports in ports will
+// replace ports in base with the same container port and protocol.
+func (in *instance) mergePorts(base, ports []corev1.ContainerPort) []corev1.ContainerPort {
+	var res []corev1.ContainerPort
+	key := func(p corev1.ContainerPort) string {
+		proto := p.Protocol
+		if proto == "" {
+			proto = corev1.ProtocolTCP
+		}
+		return fmt.Sprintf("%d/%s", p.ContainerPort, proto)
+	}
+	keys := map[string]bool{}
+	for _, p := range ports {
+		keys[key(p)] = true
+	}
+	for _, p := range base {
+		if !keys[key(p)] {
+			res = append(res, p)
+		}
+	}
+	return append(res, ports...)
+}
+
+// mergeResources will merge the given resource requirements, requests and
+// limits in res will replace the ones in base.
+func (in *instance) mergeResources(base, res corev1.ResourceRequirements) corev1.ResourceRequirements {
+	merge := func(base, res corev1.ResourceList) corev1.ResourceList {
+		if len(base) == 0 {
+			return res
+		}
+		rl := corev1.ResourceList{}
+		for k, v := range base {
+			rl[k] = v
+		}
+		for k, v := range res {
+			rl[k] = v
+		}
+		return rl
+	}
+	return corev1.ResourceRequirements{
+		Requests: merge(base.Requests, res.Requests),
+		Limits:   merge(base.Limits, res.Limits),
+		Claims:   append(base.Claims, res.Claims...),
+	}
+}
+
+// mergeSecurityContext will merge the given security contexts, settings in
+// sc will replace the settings in base. Capabilities are combined.
+func (in *instance) mergeSecurityContext(base, sc *corev1.SecurityContext) *corev1.SecurityContext {
+	if base == nil {
+		return sc
+	}
+	if sc == nil {
+		return base
+	}
+	res := base.DeepCopy()
+	if sc.Capabilities != nil {
+		if res.Capabilities == nil {
+			res.Capabilities = &corev1.Capabilities{}
+		}
+		res.Capabilities.Add = append(res.Capabilities.Add, sc.Capabilities.Add...)
+		res.Capabilities.Drop = append(res.Capabilities.Drop, sc.Capabilities.Drop...)
+	}
+	if sc.Privileged != nil {
+		res.Privileged = sc.Privileged
+	}
+	if sc.SELinuxOptions != nil {
+		res.SELinuxOptions = sc.SELinuxOptions
+	}
+	if sc.WindowsOptions != nil {
+		res.WindowsOptions = sc.WindowsOptions
+	}
+	if sc.RunAsUser != nil {
+		res.RunAsUser = sc.RunAsUser
+	}
+	if sc.RunAsGroup != nil {
+		res.RunAsGroup = sc.RunAsGroup
+	}
+	if sc.RunAsNonRoot != nil {
+		res.RunAsNonRoot = sc.RunAsNonRoot
+	}
+	if sc.ReadOnlyRootFilesystem != nil {
+		res.ReadOnlyRootFilesystem = sc.ReadOnlyRootFilesystem
+	}
+	if sc.AllowPrivilegeEscalation != nil {
+		res.AllowPrivilegeEscalation = sc.AllowPrivilegeEscalation
+	}
+	if sc.ProcMount != nil {
+		res.ProcMount = sc.ProcMount
+	}
+	if sc.SeccompProfile != nil {
+		res.SeccompProfile = sc.SeccompProfile
+	}
+	return res
+}
@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMergeContainers(t *testing.T) {
+	yes := true
+	no := false
+	uid := int64(1000)
+	main := corev1.Container{
+		Name:    "main",
+		Image:   "alpine:latest",
+		Command: []string{"sh"},
+		Env:     []corev1.EnvVar{{Name: "A", Value: "docker"}},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			Privileged:   &yes,
+			Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}},
+		},
+	}
+	tests := []struct {
+		tmpl []corev1.Container
+		out  []corev1.Container
+	}{
+		{tmpl: nil, out: []corev1.Container{main}},
+		{
+			tmpl: []corev1.Container{{Name: "proxy", Image: "envoy"}},
+			out:  []corev1.Container{main, {Name: "proxy", Image: "envoy"}},
+		},
+		{
+			tmpl: []corev1.Container{
+				{Name: "logger", Image: "fluentbit"},
+				{
+					Name:       "main",
+					Image:      "ignored",
+					Command:    []string{"ignored"},
+					Args:       []string{"template"},
+					WorkingDir: "/data",
+					Env:        []corev1.EnvVar{{Name: "A", Value: "template"}, {Name: "B", Value: "template"}},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("500m"),
+							corev1.ResourceMemory: resource.MustParse("1Gi"),
+						},
+					},
+					VolumeMounts: []corev1.VolumeMount{{Name: "certs", MountPath: "/certs"}},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged:   &no,
+						RunAsUser:    &uid,
+						Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+					},
+				},
+			},
+			out: []corev1.Container{
+				{
+					Name:       "main",
+					Image:      "alpine:latest",
+					Command:    []string{"sh"},
+					Args:       []string{"template"},
+					WorkingDir: "/data",
+					Env:        []corev1.EnvVar{{Name: "B", Value: "template"}, {Name: "A", Value: "docker"}},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("1"),
+							corev1.ResourceMemory: resource.MustParse("1Gi"),
+						},
+					},
+					VolumeMounts: []corev1.VolumeMount{{Name: "certs", MountPath: "/certs"}},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: &yes,
+						RunAsUser:  &uid,
+						Capabilities: &corev1.Capabilities{
+							Add:  []corev1.Capability{"NET_ADMIN"},
+							Drop: []corev1.Capability{"ALL"},
+						},
+					},
+				},
+				{Name: "logger", Image: "fluentbit"},
+			},
+		},
+	}
+	for i, tst := range tests {
+		kub := &instance{}
+		res := kub.mergeContainers(tst.tmpl, main)
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestMergePorts(t *testing.T) {
+	tests := []struct {
+		base  []corev1.ContainerPort
+		ports []corev1.ContainerPort
+		out   []corev1.ContainerPort
+	}{
+		{base: nil, ports: nil, out: nil},
+		{
+			base:  []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9090}},
+			ports: []corev1.ContainerPort{{ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+			out:   []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9090}, {ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+		},
+		{
+			base:  []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}, {ContainerPort: 53, Protocol: corev1.ProtocolUDP}},
+			ports: []corev1.ContainerPort{{ContainerPort: 8080, Protocol: corev1.ProtocolTCP}, {ContainerPort: 53, Protocol: corev1.ProtocolTCP}},
+			out: []corev1.ContainerPort{
+				{ContainerPort: 53, Protocol: corev1.ProtocolUDP},
+				{ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+				{ContainerPort: 53, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+	for i, tst := range tests {
+		kub := &instance{}
+		res := kub.mergePorts(tst.base, tst.ports)
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestMergeSecurityContext(t *testing.T) {
+	yes := true
+	tests := []struct {
+		base *corev1.SecurityContext
+		sc   *corev1.SecurityContext
+		out  *corev1.SecurityContext
+	}{
+		{base: nil, sc: nil, out: nil},
+		{base: &corev1.SecurityContext{Privileged: &yes}, sc: nil, out: &corev1.SecurityContext{Privileged: &yes}},
+		{base: nil, sc: &corev1.SecurityContext{Privileged: &yes}, out: &corev1.SecurityContext{Privileged: &yes}},
+		{
+			base: &corev1.SecurityContext{ReadOnlyRootFilesystem: &yes},
+			sc:   &corev1.SecurityContext{AllowPrivilegeEscalation: &yes},
+			out:  &corev1.SecurityContext{ReadOnlyRootFilesystem: &yes, AllowPrivilegeEscalation: &yes},
+		},
+	}
+	for i, tst := range tests {
+		kub := &instance{}
+		res := kub.mergeSecurityContext(tst.base, tst.sc)
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// validatePodPatch will check the syntax of the patch that is specified on
+// the container, and if it only modifies fields that are allowed to be
+// patched. The patch itself is applied when the pod is created.
+func (in *instance) validatePodPatch(tainr *types.Container) error {
+	typ, patch, err := tainr.GetPodPatch()
+	if err != nil || patch == nil {
+		return err
+	}
+	if typ == apitypes.JSONPatchType {
+		if err := in.checkJSONPatchSyntax(patch); err != nil {
+			return fmt.Errorf("invalid pod patch: %w", err)
+		}
+	}
+	return in.checkPodPatch(typ, patch)
+}
+
+// checkJSONPatchSyntax will check if all operations in the given json patch
+// are valid, without applying them.
+func (in *instance) checkJSONPatchSyntax(patch []byte) error {
+	p, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return err
+	}
+	for _, op := range p {
+		if _, err := op.Path(); err != nil {
+			return err
+		}
+		switch op.Kind() {
+		case "add", "replace", "test":
+			if _, err := op.ValueInterface(); err != nil {
+				return err
+			}
+		case "move", "copy":
+			if _, err := op.From(); err != nil {
+				return err
+			}
+		case "remove":
+		default:
+			return fmt.Errorf("unsupported operation %s", op.Kind())
+		}
+	}
+	return nil
+}
+
+// applyPodPatch will apply the patch that is specified on the container to
+// the given pod. It will return an error if the patch is invalid, or if it
+// modifies fields that are not allowed to be patched.
+func (in *instance) applyPodPatch(tainr *types.Container, pod *corev1.Pod) error {
+	typ, patch, err := tainr.GetPodPatch()
+	if err != nil || patch == nil {
+		return err
+	}
+
+	if err := in.checkPodPatch(typ, patch); err != nil {
+		return err
+	}
+
+	orig, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+
+	var res []byte
+	switch typ {
+	case apitypes.StrategicMergePatchType:
+		res, err = strategicpatch.StrategicMergePatch(orig, patch, corev1.Pod{})
+	case apitypes.JSONPatchType:
+		var p jsonpatch.Patch
+		p, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			res, err = p.Apply(orig)
+		}
+	default:
+		err = fmt.Errorf("unsupported patch type %s", typ)
+	}
+	if err != nil {
+		return fmt.Errorf("error applying pod patch: %w", err)
+	}
+
+	patched := corev1.Pod{}
+	if err := json.Unmarshal(res, &patched); err != nil {
+		return fmt.Errorf("error applying pod patch: %w", err)
+	}
+	*pod = patched
+	return nil
+}
+
+// checkPodPatch will check if all fields that are modified by the given
+// patch are allowed to be patched. A field is allowed if the field, or any
+// of its parents, is in the configured allow list (e.g. spec.volumes). If
+// the allow list contains *, all fields are allowed.
+func (in *instance) checkPodPatch(typ apitypes.PatchType, patch []byte) error {
+	paths, err := in.getPatchPaths(typ, patch)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if !in.isPatchAllowed(path) {
+			if path == "" {
+				return fmt.Errorf("pod patch is not allowed to modify the whole pod")
+			}
+			return fmt.Errorf("pod patch is not allowed to modify %s", path)
+		}
+	}
+	return nil
+}
+
+// isPatchAllowed will return true if the given field path is allowed to
+// be patched. The empty path (the whole pod) is only allowed with *.
+func (in *instance) isPatchAllowed(path string) bool {
+	for _, allow := range in.podPatchAllow {
+		if allow == "*" || (path != "" && (path == allow || strings.HasPrefix(path, allow+"."))) {
+			return true
+		}
+	}
+	return false
+}
+
+// getPatchPaths will return the (dotted) paths of the fields that are
+// modified by the given patch. List indices are omitted from the path, and
+// an empty path refers to the whole pod.
+func (in *instance) getPatchPaths(typ apitypes.PatchType, patch []byte) ([]string, error) {
+	switch typ {
+	case apitypes.StrategicMergePatchType:
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(patch, &obj); err != nil {
+			return nil, err
+		}
+		meta, err := strategicpatch.NewPatchMetaFromStruct(corev1.Pod{})
+		if err != nil {
+			return nil, err
+		}
+		return in.getObjectPaths("", obj, meta), nil
+	case apitypes.JSONPatchType:
+		ops := []map[string]interface{}{}
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, err
+		}
+		paths := []string{}
+		for _, op := range ops {
+			for _, key := range []string{"path", "from"} {
+				if p, ok := op[key].(string); ok {
+					paths = append(paths, in.getPointerPath(p))
+				}
+			}
+		}
+		return paths, nil
+	}
+	return nil, fmt.Errorf("unsupported patch type %s", typ)
+}
+
+// getObjectPaths will return the paths to all leaf fields in the given
+// strategic merge patch object. Patch directives ($patch, $retainKeys,
+// etc.) apply to their parent (where a directive at the root applies to the
+// whole pod), except for directives that refer to a specific field (e.g.
+// $setElementOrder/containers). Lists that are merged by a merge key (e.g.
+// containers by name) are descended into, so the fields of the elements
+// are returned (e.g. spec.containers.volumeMounts). Other lists are
+// replaced as a whole, and are returned as a single field.
+func (in *instance) getObjectPaths(parent string, obj map[string]interface{}, meta strategicpatch.LookupPatchMeta) []string {
+	join := func(key string) string {
+		if parent == "" {
+			return key
+		}
+		return parent + "." + key
+	}
+	paths := []string{}
+	for key, val := range obj {
+		if strings.HasPrefix(key, "$") {
+			if _, field, ok := strings.Cut(key, "/"); ok {
+				paths = append(paths, join(field))
+			} else {
+				paths = append(paths, parent)
+			}
+			continue
+		}
+		switch v := val.(type) {
+		case map[string]interface{}:
+			if len(v) == 0 {
+				paths = append(paths, join(key))
+				continue
+			}
+			var sub strategicpatch.LookupPatchMeta
+			if meta != nil {
+				if sm, _, err := meta.LookupPatchMetadataForStruct(key); err == nil {
+					sub = sm
+				}
+			}
+			paths = append(paths, in.getObjectPaths(join(key), v, sub)...)
+		case []interface{}:
+			paths = append(paths, in.getListPaths(join(key), key, v, meta)...)
+		default:
+			paths = append(paths, join(key))
+		}
+	}
+	return paths
+}
+
+// getListPaths will return the paths to all leaf fields in the elements of
+// the given list, if the list is merged by a merge key. The merge key
+// itself only identifies the element, and is not returned. If the list is
+// not merged by a merge key, or an element only contains the merge key, the
+// path of the list itself is returned.
+func (in *instance) getListPaths(path, key string, list []interface{}, meta strategicpatch.LookupPatchMeta) []string {
+	if meta == nil {
+		return []string{path}
+	}
+	sub, pm, err := meta.LookupPatchMetadataForSlice(key)
+	if err != nil || pm.GetPatchMergeKey() == "" {
+		return []string{path}
+	}
+	mkey := pm.GetPatchMergeKey()
+	paths := []string{}
+	for _, item := range list {
+		elem, ok := item.(map[string]interface{})
+		if !ok {
+			return []string{path}
+		}
+		fields := map[string]interface{}{}
+		for k, v := range elem {
+			if k != mkey {
+				fields[k] = v
+			}
+		}
+		if len(fields) == 0 {
+			paths = append(paths, path)
+			continue
+		}
+		paths = append(paths, in.getObjectPaths(path, fields, sub)...)
+	}
+	if len(paths) == 0 {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// getPointerPath will convert a json pointer (/spec/containers/0/env) to a
+// dotted path without list indices (spec.containers.env).
+func (in *instance) getPointerPath(pointer string) string {
+	index := regexp.MustCompile(`^([0-9]+|-)$`)
+	parts := []string{}
+	for _, p := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if index.MatchString(p) {
+			continue
+		}
+		p = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, ".")
+}
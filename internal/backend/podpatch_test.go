@@ -0,0 +1,157 @@
+package backend
+
+import (
+	"encoding/base64"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestApplyPodPatch(t *testing.T) {
+	tests := []struct {
+		allow []string
+		patch string
+		grace *int64
+		vols  int
+		err   bool
+	}{
+		{allow: []string{}, patch: ""},
+		{allow: []string{}, patch: `{"spec":{"terminationGracePeriodSeconds":5}}`, err: true},
+		{allow: []string{"spec.terminationGracePeriodSeconds"}, patch: `{"spec":{"terminationGracePeriodSeconds":5}}`, grace: makeInt64(5)},
+		{allow: []string{"*"}, patch: `{"spec":{"terminationGracePeriodSeconds":5}}`, grace: makeInt64(5)},
+		{
+			allow: []string{"spec.volumes"},
+			patch: base64.StdEncoding.EncodeToString([]byte(`{"spec":{"volumes":[{"name":"fixture","hostPath":{"path":"/data"}}]}}`)),
+			vols:  2,
+		},
+		{
+			allow: []string{"spec.volumes", "spec.containers.volumeMounts"},
+			patch: `[{"op":"add","path":"/spec/volumes/-","value":{"name":"fixture","emptyDir":{}}},{"op":"add","path":"/spec/containers/0/volumeMounts","value":[{"name":"fixture","mountPath":"/fixture"}]}]`,
+			vols:  2,
+		},
+		{
+			allow: []string{"spec.volumes"},
+			patch: `[{"op":"add","path":"/spec/containers/0/volumeMounts","value":[]}]`,
+			err:   true,
+		},
+		{allow: []string{"spec.volumes"}, patch: `{"spec":{"volumes":[{"name":"fixture","$patch":"delete"}]}}`, vols: 1},
+		{allow: []string{"spec.terminationGracePeriodSeconds"}, patch: `{"$patch":"replace","spec":{"terminationGracePeriodSeconds":5}}`, err: true},
+		{allow: []string{"spec.terminationGracePeriodSeconds"}, patch: `{"$retainKeys":["spec"],"spec":{"terminationGracePeriodSeconds":5}}`, err: true},
+		{allow: []string{"spec.terminationGracePeriodSeconds"}, patch: `[{"op":"replace","path":"","value":{}}]`, err: true},
+		{
+			allow: []string{"spec.containers.volumeMounts"},
+			patch: `{"spec":{"containers":[{"name":"main","volumeMounts":[{"name":"existing","mountPath":"/data"}]}]}}`,
+		},
+		{allow: []string{"spec.containers.volumeMounts"}, patch: `{"spec":{"containers":[{"name":"main","image":"evil"}]}}`, err: true},
+		{allow: []string{"spec.containers.volumeMounts"}, patch: `{"spec":{"containers":[{"name":"main","$patch":"delete"}]}}`, err: true},
+		{allow: []string{"*"}, patch: `[{"op":"remove","path":"/spec/notexisting"}]`, err: true},
+		{allow: []string{"*"}, patch: `not json`, err: true},
+		{allow: []string{"*"}, patch: `"string"`, err: true},
+	}
+	for i, tst := range tests {
+		pod := &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "main"}},
+				Volumes:    []corev1.Volume{{Name: "existing"}},
+			},
+		}
+		kub := &instance{podPatchAllow: tst.allow}
+		tainr := &types.Container{Labels: map[string]string{types.LabelPodPatch: tst.patch}}
+		err := kub.applyPodPatch(tainr, pod)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if tst.grace != nil && (pod.Spec.TerminationGracePeriodSeconds == nil || *pod.Spec.TerminationGracePeriodSeconds != *tst.grace) {
+			t.Errorf("failed test %d - expected grace period %d, but got %v", i, *tst.grace, pod.Spec.TerminationGracePeriodSeconds)
+		}
+		vols := tst.vols
+		if vols == 0 {
+			vols = 1
+		}
+		if len(pod.Spec.Volumes) != vols {
+			t.Errorf("failed test %d - expected %d volumes, but got %d", i, vols, len(pod.Spec.Volumes))
+		}
+	}
+}
+
+func TestValidatePodPatch(t *testing.T) {
+	tests := []struct {
+		allow []string
+		patch string
+		err   bool
+	}{
+		{allow: []string{}, patch: ""},
+		{allow: []string{"spec.volumes"}, patch: `[{"op":"add","path":"/spec/volumes/-","value":{"name":"fixture","emptyDir":{}}}]`},
+		{allow: []string{"spec.volumes"}, patch: `[{"op":"add","path":"/spec/containers/0/volumeMounts/-","value":{}}]`, err: true},
+		{allow: []string{"*"}, patch: `[{"op":"move"}]`, err: true},
+		{allow: []string{"*"}, patch: `{"$patch":"replace","spec":{}}`},
+	}
+	for i, tst := range tests {
+		kub := &instance{podPatchAllow: tst.allow}
+		tainr := &types.Container{Labels: map[string]string{types.LabelPodPatch: tst.patch}}
+		err := kub.validatePodPatch(tainr)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+	}
+}
+
+func TestGetPatchPaths(t *testing.T) {
+	kub := &instance{}
+	tests := []struct {
+		patch string
+		out   []string
+	}{
+		{patch: `{"spec":{"terminationGracePeriodSeconds":5}}`, out: []string{"spec.terminationGracePeriodSeconds"}},
+		{patch: `{"$patch":"replace","spec":{"hostname":"x"}}`, out: []string{"", "spec.hostname"}},
+		{patch: `{"spec":{"containers":[{"name":"main","env":[{"name":"A","value":"b"}]}]}}`, out: []string{"spec.containers.env.value"}},
+		{patch: `{"spec":{"containers":[{"name":"main"}]}}`, out: []string{"spec.containers"}},
+		{patch: `{"spec":{"containers":[{"name":"main","args":["x"]}]}}`, out: []string{"spec.containers.args"}},
+		{patch: `{"metadata":{"labels":{"app":"x"}}}`, out: []string{"metadata.labels.app"}},
+	}
+	for i, tst := range tests {
+		res, err := kub.getPatchPaths(apitypes.StrategicMergePatchType, []byte(tst.patch))
+		if err != nil {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		sort.Strings(res)
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetPointerPath(t *testing.T) {
+	kub := &instance{}
+	tests := []struct {
+		pointer string
+		out     string
+	}{
+		{pointer: "/spec/containers/0/env/-", out: "spec.containers.env"},
+		{pointer: "/metadata/labels/app.kubernetes.io~1name", out: "metadata.labels.app.kubernetes.io/name"},
+		{pointer: "/spec", out: "spec"},
+	}
+	for i, tst := range tests {
+		if res := kub.getPointerPath(tst.pointer); res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+	}
+}
+
+func makeInt64(i int64) *int64 {
+	return &i
+}
@@ -0,0 +1,234 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// PodSecurityEnforceLabel is the namespace label that configures the pod
+// security level that is enforced by the pod security admission.
+const PodSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+const (
+	podSecurityPrivileged = "privileged"
+	podSecurityBaseline   = "baseline"
+	podSecurityRestricted = "restricted"
+)
+
+// baselineCapabilities are the capabilities that are allowed to be added
+// in the baseline pod security level.
+var baselineCapabilities = map[corev1.Capability]bool{
+	"AUDIT_WRITE":      true,
+	"CHOWN":            true,
+	"DAC_OVERRIDE":     true,
+	"FOWNER":           true,
+	"FSETID":           true,
+	"KILL":             true,
+	"MKNOD":            true,
+	"NET_BIND_SERVICE": true,
+	"SETFCAP":          true,
+	"SETGID":           true,
+	"SETPCAP":          true,
+	"SETUID":           true,
+	"SYS_CHROOT":       true,
+}
+
+// restrictedCapabilities are the capabilities that are allowed to be added
+// in the restricted pod security level.
+var restrictedCapabilities = map[corev1.Capability]bool{
+	"NET_BIND_SERVICE": true,
+}
+
+// safeSysctls are the sysctls that are allowed in the baseline pod security
+// level.
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":              true,
+	"net.ipv4.ip_local_port_range":        true,
+	"net.ipv4.ip_local_reserved_ports":    true,
+	"net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.tcp_syncookies":             true,
+	"net.ipv4.ping_group_range":           true,
+	"net.ipv4.tcp_keepalive_time":         true,
+	"net.ipv4.tcp_fin_timeout":            true,
+	"net.ipv4.tcp_keepalive_intvl":        true,
+	"net.ipv4.tcp_keepalive_probes":       true,
+}
+
+// validatePodSecurity will check if the security settings of the given
+// container would be rejected by the pod security level that is enforced on
+// the configured namespace.
+func (in *instance) validatePodSecurity(tainr *types.Container) error {
+	sc, err := tainr.GetContainerSecurityContext()
+	if err != nil {
+		return err
+	}
+	sysctls, err := tainr.GetSysctls()
+	if err != nil {
+		return err
+	}
+	tpl, err := in.getPodTemplate(tainr)
+	if err != nil {
+		return err
+	}
+	return in.checkPodSecurity(in.getPodSecurityLevel(), in.getSecurityPod(tainr, tpl, sc, sysctls))
+}
+
+// getSecurityPod will return the pod, as far as it can be determined before
+// deploying, that is used to check the pod security level. This is the pod
+// template with the security context of the container, and the pod patch
+// applied. If the pod patch can not be applied to this partial pod, or if the
+// user is not numeric, these are left to the cluster.
+func (in *instance) getSecurityPod(tainr *types.Container, tpl *corev1.Pod, sc *corev1.SecurityContext, sysctls []corev1.Sysctl) *corev1.Pod {
+	pod := tpl.DeepCopy()
+	pod.Spec.Containers = in.mergeContainers(pod.Spec.Containers, corev1.Container{
+		Name:            "main",
+		SecurityContext: sc,
+	})
+	if pod.Spec.SecurityContext == nil {
+		pod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	pod.Spec.SecurityContext.Sysctls = append(pod.Spec.SecurityContext.Sysctls, sysctls...)
+	if usr, _, _ := strings.Cut(tainr.Labels[types.LabelRunasUser], ":"); usr != "" {
+		if uid, err := strconv.ParseInt(usr, 10, 64); err == nil {
+			pod.Spec.SecurityContext.RunAsUser = &uid
+		}
+	}
+	patched := pod.DeepCopy()
+	if err := in.applyPodPatch(tainr, patched); err != nil {
+		klog.V(3).Infof("pod patch not applied for pod security check: %s", err)
+		return pod
+	}
+	return patched
+}
+
+// getPodSecurityLevel will return the pod security level that is enforced
+// on the configured namespace. If this could not be determined, it will
+// return the privileged level, leaving the verdict to the cluster.
+func (in *instance) getPodSecurityLevel() string {
+	ns, err := in.cli.CoreV1().Namespaces().Get(context.Background(), in.namespace, metav1.GetOptions{})
+	if err != nil {
+		klog.V(3).Infof("unable to determine pod security level of namespace %s: %s", in.namespace, err)
+		return podSecurityPrivileged
+	}
+	level := strings.ToLower(ns.ObjectMeta.Labels[PodSecurityEnforceLabel])
+	if level == "" {
+		return podSecurityPrivileged
+	}
+	return level
+}
+
+// checkPodSecurity will check the containers and security context of given
+// pod against the given pod security level, and will return an error
+// describing the first violation. The security context, capabilities,
+// privilege escalation, seccomp, run as non-root and sysctls controls are
+// checked; controls on host namespaces, host ports and volume types are
+// left to the cluster.
+func (in *instance) checkPodSecurity(level string, pod *corev1.Pod) error {
+	if level != podSecurityBaseline && level != podSecurityRestricted {
+		return nil
+	}
+	psc := pod.Spec.SecurityContext
+	if psc == nil {
+		psc = &corev1.PodSecurityContext{}
+	}
+	if level == podSecurityRestricted && psc.RunAsUser != nil && *psc.RunAsUser == 0 {
+		return in.podSecurityError(level, "running as root")
+	}
+	if psc.SeccompProfile != nil && psc.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+		return in.podSecurityError(level, "unconfined seccomp profile")
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		if err := in.checkContainerSecurity(level, psc, c); err != nil {
+			return err
+		}
+	}
+	for _, s := range psc.Sysctls {
+		if !safeSysctls[s.Name] {
+			return in.podSecurityError(level, "sysctl "+s.Name)
+		}
+	}
+	return nil
+}
+
+// checkContainerSecurity will check the security context of given container
+// against the given pod security level, settings that are not set on the
+// container are taken from the given pod security context.
+func (in *instance) checkContainerSecurity(level string, psc *corev1.PodSecurityContext, c corev1.Container) error {
+	sc := c.SecurityContext
+	if sc == nil {
+		sc = &corev1.SecurityContext{}
+	}
+	if sc.Privileged != nil && *sc.Privileged {
+		return in.podSecurityError(level, "privileged containers")
+	}
+	caps := baselineCapabilities
+	if level == podSecurityRestricted {
+		caps = restrictedCapabilities
+	}
+	if sc.Capabilities != nil {
+		for _, c := range sc.Capabilities.Add {
+			if !caps[c] {
+				return in.podSecurityError(level, "adding capability "+string(c))
+			}
+		}
+	}
+	seccomp := sc.SeccompProfile
+	if seccomp == nil {
+		seccomp = psc.SeccompProfile
+	}
+	if seccomp != nil && seccomp.Type == corev1.SeccompProfileTypeUnconfined {
+		return in.podSecurityError(level, "unconfined seccomp profile")
+	}
+	if level != podSecurityRestricted {
+		return nil
+	}
+	if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+		return in.podSecurityError(level, "privilege escalation (no-new-privileges is required)")
+	}
+	if !in.dropsAllCapabilities(sc) {
+		return in.podSecurityError(level, "not dropping all capabilities (cap-drop ALL is required)")
+	}
+	if seccomp == nil || (seccomp.Type != corev1.SeccompProfileTypeRuntimeDefault && seccomp.Type != corev1.SeccompProfileTypeLocalhost) {
+		return in.podSecurityError(level, "a missing seccomp profile (runtime/default or localhost is required)")
+	}
+	nonroot := sc.RunAsNonRoot
+	if nonroot == nil {
+		nonroot = psc.RunAsNonRoot
+	}
+	if nonroot == nil || !*nonroot {
+		return in.podSecurityError(level, "not enforcing run as non-root (runAsNonRoot is required)")
+	}
+	if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+		return in.podSecurityError(level, "running as root")
+	}
+	return nil
+}
+
+// dropsAllCapabilities will return true if given security context drops all
+// capabilities.
+func (in *instance) dropsAllCapabilities(sc *corev1.SecurityContext) bool {
+	if sc.Capabilities == nil {
+		return false
+	}
+	for _, c := range sc.Capabilities.Drop {
+		if strings.ToUpper(string(c)) == "ALL" {
+			return true
+		}
+	}
+	return false
+}
+
+// podSecurityError will return an error describing that given violation is
+// not allowed by the given pod security level.
+func (in *instance) podSecurityError(level, violation string) error {
+	return fmt.Errorf("%s is not allowed by the %s pod security level of namespace %s", violation, level, in.namespace)
+}
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestValidatePodSecurity(t *testing.T) {
+	namespace := func(level string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+		if level != "" {
+			ns.ObjectMeta.Labels = map[string]string{PodSecurityEnforceLabel: level}
+		}
+		return ns
+	}
+	restricted := func(mod func(*types.Container)) *types.Container {
+		tainr := &types.Container{
+			CapDrop:     []string{"ALL"},
+			SecurityOpt: []string{"no-new-privileges", "seccomp=runtime/default"},
+			Labels:      map[string]string{types.LabelPodPatch: `{"spec":{"securityContext":{"runAsNonRoot":true}}}`},
+		}
+		if mod != nil {
+			mod(tainr)
+		}
+		return tainr
+	}
+	tests := []struct {
+		level string
+		in    *types.Container
+		err   bool
+	}{
+		{level: "", in: &types.Container{Privileged: true}, err: false},
+		{level: "privileged", in: &types.Container{Privileged: true}, err: false},
+		{level: "baseline", in: &types.Container{Privileged: true}, err: true},
+		{level: "baseline", in: &types.Container{CapAdd: []string{"CHOWN"}}, err: false},
+		{level: "baseline", in: &types.Container{CapAdd: []string{"NET_ADMIN"}}, err: true},
+		{level: "restricted", in: &types.Container{CapAdd: []string{"CHOWN"}}, err: true},
+		{level: "restricted", in: &types.Container{CapAdd: []string{"NET_BIND_SERVICE"}, CapDrop: []string{"ALL"}}, err: true},
+		{level: "restricted", in: restricted(nil), err: false},
+		{level: "restricted", in: restricted(func(tainr *types.Container) { tainr.CapDrop = nil }), err: true},
+		{level: "restricted", in: restricted(func(tainr *types.Container) { tainr.SecurityOpt = tainr.SecurityOpt[1:] }), err: true},
+		{level: "restricted", in: restricted(func(tainr *types.Container) { tainr.SecurityOpt = tainr.SecurityOpt[:1] }), err: true},
+		{level: "restricted", in: restricted(func(tainr *types.Container) { tainr.SecurityOpt[1] = "seccomp=localhost/profile.json" }), err: false},
+		{level: "restricted", in: restricted(func(tainr *types.Container) { delete(tainr.Labels, types.LabelPodPatch) }), err: true},
+		{level: "restricted", in: restricted(func(tainr *types.Container) { tainr.Labels[types.LabelRunasUser] = "0" }), err: true},
+		{level: "restricted", in: restricted(func(tainr *types.Container) { tainr.Labels[types.LabelRunasUser] = "1000:1000" }), err: false},
+		{level: "baseline", in: &types.Container{Labels: map[string]string{types.LabelPodPatch: `{"spec":{"securityContext":{"seccompProfile":{"type":"Unconfined"}}}}`}}, err: true},
+		{level: "baseline", in: &types.Container{SecurityOpt: []string{"seccomp=unconfined"}}, err: true},
+		{level: "baseline", in: &types.Container{SecurityOpt: []string{"no-new-privileges=false"}}, err: false},
+		{level: "restricted", in: &types.Container{SecurityOpt: []string{"no-new-privileges=false"}}, err: true},
+		{level: "baseline", in: &types.Container{Sysctls: map[string]string{"net.ipv4.tcp_syncookies": "1"}}, err: false},
+		{level: "baseline", in: &types.Container{Sysctls: map[string]string{"net.core.somaxconn": "1024"}}, err: true},
+	}
+	for i, tst := range tests {
+		kub := &instance{
+			namespace:     "default",
+			cli:           fake.NewSimpleClientset(namespace(tst.level)),
+			podPatchAllow: []string{"spec.securityContext"},
+		}
+		err := kub.validatePodSecurity(tst.in)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+	}
+
+	kub := &instance{namespace: "default", cli: fake.NewSimpleClientset()}
+	if err := kub.validatePodSecurity(&types.Container{Privileged: true}); err != nil {
+		t.Errorf("unexpected error when namespace is unknown: %s", err)
+	}
+}
@@ -0,0 +1,18 @@
+package backend
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetResourceQuotas will return the resource quotas that are configured in
+// the namespace.
+func (in *instance) GetResourceQuotas() ([]corev1.ResourceQuota, error) {
+	quotas, err := in.cli.CoreV1().ResourceQuotas(in.namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return quotas.Items, nil
+}
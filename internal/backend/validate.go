@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// ValidateContainer will check if the given container can be deployed in
+// the configured namespace. It will return an error if the container has
+// invalid settings, or if the security settings of the container would be
+// rejected by the pod security level that is enforced on the namespace.
+func (in *instance) ValidateContainer(tainr *types.Container) error {
+	if _, err := tainr.GetContainerSecurityContext(); err != nil {
+		return err
+	}
+	if _, err := tainr.GetSupplementalGroups(); err != nil {
+		return err
+	}
+	if _, err := tainr.GetSysctls(); err != nil {
+		return err
+	}
+	if _, err := tainr.GetTmpfsMounts(); err != nil {
+		return err
+	}
+	if _, _, err := tainr.GetHostname(); err != nil {
+		return err
+	}
+	if _, _, err := tainr.GetDNSConfig(); err != nil {
+		return err
+	}
+	if err := in.validateScheduling(tainr); err != nil {
+		return err
+	}
+	if _, err := tainr.GetNetworkAffinity(); err != nil {
+		return err
+	}
+	if _, err := tainr.GetTTL(0); err != nil {
+		return err
+	}
+	if _, err := in.getToxics(tainr); err != nil {
+		return err
+	}
+	if _, err := tainr.GetCapturePorts(); err != nil {
+		return err
+	}
+	if _, err := in.getPodTemplate(tainr); err != nil {
+		return err
+	}
+	if err := in.validatePodPatch(tainr); err != nil {
+		return err
+	}
+	return in.validatePodSecurity(tainr)
+}
+
+// validateScheduling will check the node selector, tolerations, priority
+// class and runtime class that are specified on the container.
+func (in *instance) validateScheduling(tainr *types.Container) error {
+	if _, err := tainr.GetNodeSelector(nil); err != nil {
+		return err
+	}
+	if _, err := tainr.GetTolerations(); err != nil {
+		return err
+	}
+	if _, err := tainr.GetPriorityClassName(""); err != nil {
+		return err
+	}
+	if _, err := tainr.GetRuntimeClassName(nil); err != nil {
+		return err
+	}
+	return nil
+}
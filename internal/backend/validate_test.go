@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestValidateContainer(t *testing.T) {
+	tests := []struct {
+		in  *types.Container
+		err bool
+	}{
+		{in: &types.Container{}, err: false},
+		{in: &types.Container{SecurityOpt: []string{"seccomp=/tmp/profile.json"}}, err: true},
+		{in: &types.Container{GroupAdd: []string{"wheel"}}, err: true},
+		{in: &types.Container{Tmpfs: map[string]string{"/run": "size=lots"}}, err: true},
+		{in: &types.Container{Hostname: "db_1"}, err: true},
+		{in: &types.Container{DNS: []string{"dns.google"}}, err: true},
+		{in: &types.Container{Platform: "linux/arm64"}, err: false},
+		{in: &types.Container{Labels: map[string]string{types.LabelPodTemplate: "kafka"}}, err: true},
+		{in: &types.Container{Labels: map[string]string{types.LabelTolerations: "dedicated:Sometimes"}}, err: true},
+		{in: &types.Container{Labels: map[string]string{types.LabelNodeSelector: "disktype"}}, err: true},
+		{in: &types.Container{Labels: map[string]string{types.LabelPriorityClass: "High!"}}, err: true},
+		{in: &types.Container{Labels: map[string]string{types.LabelRuntimeClass: "g_visor"}}, err: true},
+		{in: &types.Container{Labels: map[string]string{types.LabelNodeSelector: "disktype=ssd", types.LabelPriorityClass: "high"}}, err: false},
+	}
+	for i, tst := range tests {
+		kub := &instance{namespace: "default", cli: fake.NewSimpleClientset()}
+		err := kub.ValidateContainer(tst.in)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+	}
+}
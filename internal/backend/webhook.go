@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// webhookContainer is the summary of the container that is sent to the
+// webhook.
+type webhookContainer struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Image          string            `json:"image"`
+	Labels         map[string]string `json:"labels"`
+	NetworkAliases []string          `json:"networkAliases"`
+}
+
+// webhookRequest is the request that is sent to the webhook before the
+// pod and services are created.
+type webhookRequest struct {
+	Container webhookContainer `json:"container"`
+	Pod       *corev1.Pod      `json:"pod"`
+	Services  []corev1.Service `json:"services"`
+}
+
+// webhookResponse is the response of the webhook. If the request is
+// allowed, the optional patch (a json patch, either as a json array or
+// base64 encoded) is applied to the request (e.g. /pod/metadata/labels).
+type webhookResponse struct {
+	Allowed bool            `json:"allowed"`
+	Reason  string          `json:"reason"`
+	Patch   json.RawMessage `json:"patch"`
+}
+
+// callWebhook will send the given pod and services to the configured
+// webhook, and will update them with the patch that is returned by the
+// webhook. If the webhook denies the container, an error with the given
+// reason is returned. If the webhook fails, it will return an error,
+// unless the webhook is configured to fail open.
+func (in *instance) callWebhook(tainr *types.Container, pod *corev1.Pod, svcs *[]corev1.Service) error {
+	if in.webhookURL == "" {
+		return nil
+	}
+
+	req := &webhookRequest{
+		Container: webhookContainer{
+			ID:             tainr.ID,
+			Name:           tainr.Name,
+			Image:          tainr.Image,
+			Labels:         tainr.Labels,
+			NetworkAliases: tainr.NetworkAliases,
+		},
+		Pod:      pod,
+		Services: *svcs,
+	}
+
+	res, err := in.postWebhook(req)
+	if err != nil {
+		if in.webhookFailOpen {
+			klog.Warningf("ignoring failed webhook for container %s: %s", tainr.ShortID, err)
+			return nil
+		}
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+
+	if !res.Allowed {
+		if res.Reason == "" {
+			res.Reason = "no reason given"
+		}
+		return fmt.Errorf("container denied by webhook: %s", res.Reason)
+	}
+
+	if err := in.applyWebhookPatch(req, res.Patch); err != nil {
+		if in.webhookFailOpen {
+			klog.Warningf("ignoring invalid webhook patch for container %s: %s", tainr.ShortID, err)
+			return nil
+		}
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+
+	*pod = *req.Pod
+	*svcs = req.Services
+	return nil
+}
+
+// postWebhook will post the given request to the webhook and returns the
+// parsed response.
+func (in *instance) postWebhook(req *webhookRequest) (*webhookResponse, error) {
+	dat, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), in.webhookTimeout)
+	defer cancel()
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, in.webhookURL, bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+
+	hres, err := http.DefaultClient.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer hres.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(hres.Body, 10*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if hres.StatusCode < 200 || hres.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d: %s", hres.StatusCode, bytes.TrimSpace(body))
+	}
+
+	res := &webhookResponse{}
+	if err := json.Unmarshal(body, res); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return res, nil
+}
+
+// applyWebhookPatch will apply the given json patch to the given request.
+func (in *instance) applyWebhookPatch(req *webhookRequest, patch json.RawMessage) error {
+	patch = bytes.TrimSpace(patch)
+	if len(patch) == 0 || string(patch) == "null" {
+		return nil
+	}
+
+	var enc string
+	if err := json.Unmarshal(patch, &enc); err == nil {
+		dat, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return fmt.Errorf("invalid patch: %w", err)
+		}
+		patch = dat
+	}
+
+	p, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return fmt.Errorf("invalid patch: %w", err)
+	}
+
+	orig, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	dat, err := p.Apply(orig)
+	if err != nil {
+		return fmt.Errorf("error applying patch: %w", err)
+	}
+
+	res := &webhookRequest{}
+	if err := json.Unmarshal(dat, res); err != nil {
+		return fmt.Errorf("error applying patch: %w", err)
+	}
+	if res.Pod == nil {
+		return fmt.Errorf("error applying patch: pod was removed")
+	}
+	req.Pod = res.Pod
+	req.Services = res.Services
+	return nil
+}
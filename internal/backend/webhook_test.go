@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestCallWebhook(t *testing.T) {
+	tests := []struct {
+		status   int
+		response string
+		sleep    time.Duration
+		failOpen bool
+		label    string
+		services int
+		err      bool
+	}{
+		{status: 200, response: `{"allowed":true}`, services: 1},
+		{status: 200, response: `{"allowed":false,"reason":"not today"}`, err: true},
+		{status: 200, response: `{"allowed":false,"reason":"not today"}`, failOpen: true, err: true},
+		{
+			status:   200,
+			response: `{"allowed":true,"patch":[{"op":"add","path":"/pod/metadata/labels/cost-center","value":"ci"}]}`,
+			label:    "ci",
+			services: 1,
+		},
+		{
+			status:   200,
+			response: `{"allowed":true,"patch":"W3sib3AiOiJhZGQiLCJwYXRoIjoiL3BvZC9tZXRhZGF0YS9sYWJlbHMvY29zdC1jZW50ZXIiLCJ2YWx1ZSI6ImNpIn1d"}`,
+			label:    "ci",
+			services: 1,
+		},
+		{
+			status:   200,
+			response: `{"allowed":true,"patch":[{"op":"remove","path":"/services/0"}]}`,
+			services: 0,
+		},
+		{status: 200, response: `{"allowed":true,"patch":[{"op":"remove","path":"/pod"}]}`, err: true},
+		{status: 500, response: `oops`, err: true},
+		{status: 500, response: `oops`, failOpen: true, services: 1},
+		{status: 200, response: `not json`, err: true},
+		{status: 200, response: `{"allowed":true}`, sleep: 200 * time.Millisecond, err: true},
+		{status: 200, response: `{"allowed":true}`, sleep: 200 * time.Millisecond, failOpen: true, services: 1},
+	}
+
+	for i, tst := range tests {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := &webhookRequest{}
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Container.Image != "alpine" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			time.Sleep(tst.sleep)
+			w.WriteHeader(tst.status)
+			w.Write([]byte(tst.response))
+		}))
+
+		kub := &instance{
+			webhookURL:      svr.URL,
+			webhookTimeout:  100 * time.Millisecond,
+			webhookFailOpen: tst.failOpen,
+		}
+		tainr := &types.Container{Image: "alpine"}
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "tb303", Labels: map[string]string{"kubedock": "true"}}}
+		svcs := []corev1.Service{{ObjectMeta: metav1.ObjectMeta{Name: "tb303"}}}
+
+		err := kub.callWebhook(tainr, pod, &svcs)
+		svr.Close()
+
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if pod.ObjectMeta.Name != "tb303" || pod.ObjectMeta.Labels["kubedock"] != "true" {
+			t.Errorf("failed test %d - pod was unexpectedly modified", i)
+		}
+		if label := pod.ObjectMeta.Labels["cost-center"]; label != tst.label {
+			t.Errorf("failed test %d - expected label %s, but got %s", i, tst.label, label)
+		}
+		if len(svcs) != tst.services {
+			t.Errorf("failed test %d - expected %d services, but got %d", i, tst.services, len(svcs))
+		}
+	}
+
+	kub := &instance{}
+	svcs := []corev1.Service{}
+	if err := kub.callWebhook(&types.Container{}, &corev1.Pod{}, &svcs); err != nil {
+		t.Errorf("unexpected error when webhook is not configured: %s", err)
+	}
+}
@@ -14,6 +14,7 @@ type Events interface {
 	Subscribe() (<-chan Message, string)
 	Unsubscribe(string)
 	Publish(string, string, string)
+	PublishWithAttributes(string, string, string, map[string]string)
 }
 
 // instance is the internal representation of the Events object.
@@ -35,7 +36,13 @@ func New() Events {
 
 // Publish will publish an event for given resource id and type for given action.
 func (e *instance) Publish(id, typ, action string) {
-	msg := Message{ID: id, Type: typ, Action: action}
+	e.PublishWithAttributes(id, typ, action, nil)
+}
+
+// PublishWithAttributes will publish an event for given resource id and type
+// for given action, with additional attributes describing the event.
+func (e *instance) PublishWithAttributes(id, typ, action string, attrs map[string]string) {
+	msg := Message{ID: id, Type: typ, Action: action, Attributes: attrs}
 	msg.Time = time.Now().Unix()
 	msg.TimeNano = time.Now().UnixNano()
 	for _, ob := range e.observers {
@@ -7,6 +7,8 @@ type Message struct {
 	Action   string
 	Time     int64
 	TimeNano int64
+	// Attributes contains optional details of the event
+	Attributes map[string]string
 }
 
 const (
@@ -22,8 +24,13 @@ const (
 	Start = "start"
 	// Die defines the event action die (container)
 	Die = "die"
+	// Destroy defines the event action destroy (container)
+	Destroy = "destroy"
 	// Detach defines the event action detach (container)
 	Detach = "detach"
 	// Pull defines the event action image (container)
 	Pull = "pull"
+	// Queue defines the event action queue (container), which is published
+	// with the position in the start queue as attribute
+	Queue = "queue"
 )
@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"strings"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/spf13/viper"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/leaderelection"
@@ -19,8 +21,13 @@ import (
 
 	"github.com/joyrex2001/kubedock/internal/backend"
 	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/model/types"
 	"github.com/joyrex2001/kubedock/internal/reaper"
 	"github.com/joyrex2001/kubedock/internal/server"
+	"github.com/joyrex2001/kubedock/internal/util/connectproxy"
+	"github.com/joyrex2001/kubedock/internal/util/image"
+	"github.com/joyrex2001/kubedock/internal/util/podtemplate"
+	"github.com/joyrex2001/kubedock/internal/util/reverseproxy"
 )
 
 // Main is the main entry point for starting this service.
@@ -37,19 +44,29 @@ func Main() {
 		klog.Fatalf("error instantiating kubernetes client: %s", err)
 	}
 
-	kub, err := getBackend(cfg, cli)
+	podtmpls, err := getPodTemplates()
+	if err != nil {
+		klog.Fatalf("error loading pod templates: %s", err)
+	}
+
+	imgpol, err := getImagePolicy()
+	if err != nil {
+		klog.Fatalf("error loading image policy: %s", err)
+	}
+
+	kub, err := getBackend(cfg, cli, podtmpls)
 	if err != nil {
 		klog.Fatalf("error instantiating backend: %s", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	exitHandler(kub, cancel)
+	exitHandler(kub, podtmpls, cancel)
 
 	// check if this instance requires locking of the namespace, if not
 	// just start the show...
 	if !viper.GetBool("lock.enabled") {
-		run(ctx, kub)
+		run(ctx, kub, imgpol)
 		return
 	}
 
@@ -75,7 +92,7 @@ func Main() {
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
 				ready <- struct{}{}
-				run(ctx, kub)
+				run(ctx, kub, imgpol)
 			},
 			OnStoppedLeading: func() {
 				klog.V(3).Infof("lost lock on namespace %s", viper.GetString("kubernetes.namespace"))
@@ -88,12 +105,13 @@ func Main() {
 }
 
 // getBackend will instantiate a the kubedock kubernetes object.
-func getBackend(cfg *rest.Config, cli kubernetes.Interface) (backend.Backend, error) {
+func getBackend(cfg *rest.Config, cli kubernetes.Interface, podtmpls *podtemplate.Templates) (backend.Backend, error) {
 	ns := viper.GetString("kubernetes.namespace")
 	initimg := viper.GetString("kubernetes.initimage")
 	timeout := viper.GetDuration("kubernetes.timeout")
-	podtmpl := viper.GetString("kubernetes.pod-template")
 	imgpsr := strings.ReplaceAll(viper.GetString("kubernetes.image-pull-secrets"), " ", "")
+	ppallowr := strings.ReplaceAll(viper.GetString("kubernetes.pod-patch-allow"), " ", "")
+	imgrwr := strings.Fields(viper.GetString("registry.image-rewrite"))
 
 	optlog := ""
 	imgps := []string{}
@@ -104,32 +122,206 @@ func getBackend(cfg *rest.Config, cli kubernetes.Interface) (backend.Backend, er
 
 	klog.Infof("kubernetes config: namespace=%s, initimage=%s, ready timeout=%s%s", ns, initimg, timeout, optlog)
 
+	var imgrw *image.Rewriter
+	if len(imgrwr) > 0 {
+		var err error
+		imgrw, err = image.NewRewriter(imgrwr)
+		if err != nil {
+			return nil, err
+		}
+		klog.Infof("image rewrite rules: %s", strings.Join(imgrwr, " "))
+	}
+
+	webhook := viper.GetString("webhook.url")
+	webhookto := viper.GetDuration("webhook.timeout")
+	webhookfo := viper.GetBool("webhook.fail-open")
+	if webhook != "" {
+		klog.Infof("webhook: url=%s, timeout=%s, fail open=%t", webhook, webhookto, webhookfo)
+	}
+
+	var owner *metav1.OwnerReference
+	if viper.GetBool("kubernetes.owner-pod") {
+		var err error
+		owner, err = getOwner(cli, ns)
+		if err != nil {
+			return nil, fmt.Errorf("error discovering kubedock pod: %w", err)
+		}
+		klog.Infof("created pods are owned by pod %s", owner.Name)
+	}
+
+	capture, err := getCapture()
+	if err != nil {
+		return nil, err
+	}
+
+	expose := viper.GetString("expose.mode")
+	exposedom := viper.GetString("expose.domain")
+	if err := backend.ValidateExpose(expose, exposedom); err != nil {
+		return nil, err
+	}
+	var dyn dynamic.Interface
+	if expose != backend.ExposeNone {
+		klog.Infof("exposing containers via %s", expose)
+		dyn, err = dynamic.NewForConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if netaff := viper.GetString("kubernetes.network-affinity"); netaff != "" {
+		if err := types.ValidateNetworkAffinity(netaff); err != nil {
+			return nil, err
+		}
+	}
+
+	ppallow := []string{}
+	if ppallowr != "" {
+		ppallow = strings.Split(ppallowr, ",")
+		klog.Infof("pod patches allowed for: %s", ppallowr)
+	}
+
 	kub := backend.New(backend.Config{
 		Client:           cli,
+		DynamicClient:    dyn,
 		RestConfig:       cfg,
 		Namespace:        ns,
 		InitImage:        initimg,
 		ImagePullSecrets: imgps,
-		PodTemplate:      podtmpl,
+		PodTemplates:     podtmpls,
+		PodPatchAllow:    ppallow,
+		WebhookURL:       webhook,
+		WebhookTimeout:   webhookto,
+		WebhookFailOpen:  webhookfo,
+		ImageRewriter:    imgrw,
+		Owner:            owner,
+		Capture:          capture,
+		Expose:           expose,
+		ExposeDomain:     exposedom,
 		TimeOut:          timeout,
 	})
 	return kub, nil
 }
 
+// getPodTemplates will load the configured pod templates, and starts
+// watching them for changes. If no pod templates are configured, it will
+// return nil.
+func getPodTemplates() (*podtemplate.Templates, error) {
+	path := viper.GetString("kubernetes.pod-template")
+	if path == "" {
+		return nil, nil
+	}
+	podtmpls, err := podtemplate.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	podtmpls.Watch(30 * time.Second)
+	klog.Infof("pod templates: %s", strings.Join(podtmpls.Names(), ", "))
+	return podtmpls, nil
+}
+
+// getImagePolicy will return the image policy as configured with the
+// image-policy file, and the image-allow, image-deny and image-require-digest
+// arguments.
+func getImagePolicy() (*image.Policy, error) {
+	pol := &image.Policy{}
+	if file := viper.GetString("registry.image-policy"); file != "" {
+		var err error
+		pol, err = image.LoadPolicy(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	split := func(key string) []string {
+		val := strings.ReplaceAll(viper.GetString(key), " ", "")
+		if val == "" {
+			return nil
+		}
+		return strings.Split(val, ",")
+	}
+	pol.Add(split("registry.image-allow"), split("registry.image-deny"), split("registry.image-require-digest"))
+	if !pol.IsEmpty() {
+		klog.Infof("image policy: allow=%v, deny=%v, require digest=%v", pol.Allow, pol.Deny, pol.RequireDigest)
+	}
+	return pol, nil
+}
+
+// getCapture will return the configuration to record the connections that
+// are proxied by the reverse-proxy, or nil if no capture dir is configured.
+func getCapture() (*reverseproxy.Capture, error) {
+	dir := viper.GetString("capture.dir")
+	if dir == "" {
+		return nil, nil
+	}
+	format := viper.GetString("capture.format")
+	if format != reverseproxy.CaptureFormatPcapng && format != reverseproxy.CaptureFormatHexdump {
+		return nil, fmt.Errorf("invalid capture format %s (pcapng or hexdump)", format)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating capture dir: %w", err)
+	}
+	maxsize := viper.GetInt64("capture.max-size")
+	klog.Infof("capture: dir=%s, format=%s, max size=%dMB", dir, format, maxsize)
+	return &reverseproxy.Capture{
+		Dir:     dir,
+		Format:  format,
+		MaxSize: maxsize * 1024 * 1024,
+	}, nil
+}
+
+// getOwner will return an owner reference to the pod kubedock is running
+// in, which is discovered via the POD_NAME, and optionally POD_UID and
+// POD_NAMESPACE, environment variables (set via the downward api). As owner
+// references can't cross namespaces, the pod is always retrieved from the
+// given namespace, and its uid should match POD_UID if set.
+func getOwner(cli kubernetes.Interface, ns string) (*metav1.OwnerReference, error) {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		return nil, fmt.Errorf("POD_NAME is not set")
+	}
+	if pns := os.Getenv("POD_NAMESPACE"); pns != "" && pns != ns {
+		return nil, fmt.Errorf("kubedock pod is running in namespace %s instead of %s", pns, ns)
+	}
+	pod, err := cli.CoreV1().Pods(ns).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("kubedock pod %s not found in namespace %s: %w", name, ns, err)
+	}
+	if uid := os.Getenv("POD_UID"); uid != "" && uid != string(pod.ObjectMeta.UID) {
+		return nil, fmt.Errorf("kubedock pod %s in namespace %s has uid %s instead of %s", name, ns, pod.ObjectMeta.UID, uid)
+	}
+	return &metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       name,
+		UID:        pod.ObjectMeta.UID,
+	}, nil
+}
+
 // run will start all components, based the settings initiated by cmd.
-func run(ctx context.Context, kub backend.Backend) {
+func run(ctx context.Context, kub backend.Backend, imgpol *image.Policy) {
 	reapmax := viper.GetDuration("reaper.reapmax")
+	execmax := viper.GetDuration("reaper.reapmax-exec")
+	netwmax := viper.GetDuration("reaper.reapmax-network")
+	imgmax := viper.GetDuration("reaper.reapmax-image")
 	rpr, err := reaper.New(reaper.Config{
-		KeepMax: reapmax,
-		Backend: kub,
+		KeepMax:    reapmax,
+		ExecMax:    execmax,
+		NetworkMax: netwmax,
+		ImageMax:   imgmax,
+		Backend:    kub,
 	})
 	if err != nil {
 		klog.Fatalf("error instantiating reaper: %s", err)
 	}
 
-	klog.Infof("reaper started with max container age %s", reapmax)
+	klog.Infof("reaper started with max container idle time %s, max exec age %s, max unused network age %s, max unused image age %s", reapmax, execmax, netwmax, imgmax)
 	rpr.Start()
 
+	heartbeat(ctx, kub, viper.GetDuration("reaper.heartbeat-timeout"))
+
+	if err := proxy(ctx, kub, viper.GetString("proxy.listen-addr"), viper.GetString("proxy.mode")); err != nil {
+		klog.Fatalf("error starting proxy: %s", err)
+	}
+
 	if viper.GetBool("prune-start") {
 		klog.Info("pruning all existing kubedock resources from namespace")
 		if err := kub.DeleteAll(); err != nil {
@@ -137,12 +329,70 @@ func run(ctx context.Context, kub backend.Backend) {
 		}
 	}
 
-	svr := server.New(kub)
+	svr := server.New(kub, rpr, imgpol)
 	if err := svr.Run(ctx); err != nil {
 		klog.Fatalf("error instantiating server: %s", err)
 	}
 }
 
+// heartbeat will maintain the heartbeat lease of this instance, which is
+// renewed 4 times within the given timeout. Other instances will delete the
+// resources of this instance once the lease has expired.
+func heartbeat(ctx context.Context, kub backend.Backend, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	klog.Infof("heartbeat started with timeout %s", timeout)
+	go func() {
+		failed := false
+		for {
+			if err := kub.UpdateHeartbeat(timeout); err != nil && !failed {
+				klog.Warningf("error updating heartbeat: %s", err)
+				failed = true
+			} else if err == nil {
+				failed = false
+			}
+			tmr := time.NewTimer(timeout / 4)
+			select {
+			case <-ctx.Done():
+				tmr.Stop()
+				return
+			case <-tmr.C:
+			}
+		}
+	}()
+}
+
+// proxy will start the socks5 and http connect proxy on the given address,
+// which tunnels connections to pods in the namespace. Depending on the given
+// mode, connections are made directly to the pod ip (direct), or via a
+// port-forward stream (port-forward). The auto mode will connect directly
+// when kubedock is running inside the cluster.
+func proxy(ctx context.Context, kub backend.Backend, addr, mode string) error {
+	if addr == "" {
+		return nil
+	}
+	var direct bool
+	switch mode {
+	case "auto":
+		direct = os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+	case "direct":
+		direct = true
+	case "port-forward":
+		direct = false
+	default:
+		return fmt.Errorf("invalid proxy mode %s (auto, direct or port-forward)", mode)
+	}
+	klog.Infof("proxy started on %s, direct connections to pods=%t", addr, direct)
+	return connectproxy.Proxy(connectproxy.Request{
+		ListenAddr: addr,
+		StopCh:     ctx.Done(),
+		Dial: func(host string, port int) (net.Conn, error) {
+			return kub.DialPod(host, port, direct)
+		},
+	})
+}
+
 // lockTimeoutHandler will wait until the return channel recieved a message,
 // if this is not done within configured lock.timeout, it will exit the
 // process.
@@ -165,7 +415,7 @@ func lockTimeoutHandler() chan struct{} {
 }
 
 // exitHandler will clean up resources before actually stopping kubedock.
-func exitHandler(kub backend.Backend, cancel context.CancelFunc) {
+func exitHandler(kub backend.Backend, podtmpls *podtemplate.Templates, cancel context.CancelFunc) {
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc,
 		syscall.SIGINT,
@@ -174,10 +424,14 @@ func exitHandler(kub backend.Backend, cancel context.CancelFunc) {
 	go func() {
 		<-sigc
 		cancel()
+		podtmpls.Stop()
 		klog.Info("exit signal recieved, removing pods, configmaps and services")
 		if err := kub.DeleteWithKubedockID(config.DefaultLabels["kubedock.id"]); err != nil {
 			klog.Fatalf("error pruning resources: %s", err)
 		}
+		if err := kub.DeleteHeartbeat(); err != nil {
+			klog.Warningf("error deleting heartbeat: %s", err)
+		}
 		os.Exit(0)
 	}()
 }
@@ -2,17 +2,25 @@ package types
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/joyrex2001/kubedock/internal/util/tar"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog"
 )
 
@@ -22,17 +30,34 @@ type Container struct {
 	ShortID        string
 	Name           string
 	Image          string
+	Platform       string
 	Labels         map[string]string
 	Entrypoint     []string
 	Cmd            []string
 	Env            []string
+	WorkingDir     string
+	Hostname       string
+	Domainname     string
+	DNS            []string
+	DNSSearch      []string
+	DNSOptions     []string
 	Binds          []string
+	Privileged     bool
+	CapAdd         []string
+	CapDrop        []string
+	ReadOnlyRootfs bool
+	SecurityOpt    []string
+	GroupAdd       []string
+	Sysctls        map[string]string
+	Tmpfs          map[string]string
+	ShmSize        int64
 	PreArchives    []PreArchive
 	HostIP         string
 	ExposedPorts   map[string]interface{}
 	ImagePorts     map[string]interface{}
 	HostPorts      map[int]int
 	MappedPorts    map[int]int
+	ExternalPorts  map[int]ExternalPort
 	Networks       map[string]interface{}
 	NetworkAliases []string
 	StopChannels   []chan struct{}
@@ -44,6 +69,56 @@ type Container struct {
 	Killed         bool
 	Created        time.Time
 	Finished       time.Time
+	lastActivity   int64
+	portForwards   sync.Map
+	toxics         sync.Map
+	toxicsLoaded   int32
+	toxicsChanged  chan struct{}
+	toxicsMu       sync.Mutex
+}
+
+// ExternalPort describes the address on which a container port is
+// reachable from outside the cluster.
+type ExternalPort struct {
+	Host string
+	Port int
+}
+
+// PortForwardStatus describes the state of a port-forward to a container
+// port.
+type PortForwardStatus struct {
+	// LocalPort is the local port of the port-forward
+	LocalPort int
+	// PodPort is the target port in the pod
+	PodPort int
+	// Pod is the name of the pod the port-forward is connected to
+	Pod string
+	// State is the current state of the port-forward
+	State string
+	// Restarts is the number of times the port-forward was reconnected
+	Restarts int
+	// Error is the last error that occurred, which is cleared once the
+	// port-forward is ready again
+	Error string
+}
+
+// Toxics describes the faults that are injected by the reverse-proxy in
+// the connections to a container port.
+type Toxics struct {
+	// Latency is the delay added to each chunk of proxied data
+	Latency time.Duration
+	// Jitter is the random variation (+/-) of the added latency
+	Jitter time.Duration
+	// Bandwidth is the max throughput in KB/s, 0 is unlimited
+	Bandwidth int
+	// ResetPeer will reset connections after being open for the given
+	// duration
+	ResetPeer time.Duration
+	// Timeout will hold back all data, and close the connection if the
+	// toxic is still active after the given duration
+	Timeout time.Duration
+	// SlowClose is the delay before a closed connection is actually closed
+	SlowClose time.Duration
 }
 
 // PreArchive contains the path and contents of archives (tar) that need to be
@@ -66,9 +141,61 @@ const (
 	// LabelNamePrefix is the label to be used to enforce a prefix for the names used
 	// for the container deployments.
 	LabelNamePrefix = "com.joyrex2001.kubedock.name-prefix"
-	// LabelRunasUser is the label to be used to enforce a specific user (uid) that
-	// runs inside the container can also be enforced w
+	// LabelRunasUser is the label to be used to enforce a specific user (uid[:gid]
+	// or name[:group]) that runs inside the container.
 	LabelRunasUser = "com.joyrex2001.kubedock.runas-user"
+	// LabelNodeSelector is the label to be used to specify the node selector
+	// (key=value[,key=value]) of the pod.
+	LabelNodeSelector = "com.joyrex2001.kubedock.node-selector"
+	// LabelTolerations is the label to be used to specify the tolerations
+	// (key[=value][:effect][,...]) of the pod.
+	LabelTolerations = "com.joyrex2001.kubedock.tolerations"
+	// LabelPriorityClass is the label to be used to specify the priority
+	// class of the pod.
+	LabelPriorityClass = "com.joyrex2001.kubedock.priority-class"
+	// LabelRuntimeClass is the label to be used to specify the runtime class
+	// of the pod.
+	LabelRuntimeClass = "com.joyrex2001.kubedock.runtime-class"
+	// LabelPodTemplate is the label to be used to select a named pod template
+	// that should be used as the base for the pod.
+	LabelPodTemplate = "com.joyrex2001.kubedock.pod-template"
+	// LabelPodPatch is the label to be used to specify a strategic merge
+	// patch or json patch (optionally base64 encoded) that should be applied
+	// to the pod before it is created.
+	LabelPodPatch = "com.joyrex2001.kubedock.pod-patch"
+	// LabelNetworkAffinity is the label to be used to specify if the pod
+	// should be co-located with (colocate), or spread from (spread) pods
+	// that share a network.
+	LabelNetworkAffinity = "com.joyrex2001.kubedock.network-affinity"
+	// LabelSession is the label to be used to specify the session the
+	// container belongs to, which is used for the per session start limits.
+	LabelSession = "com.joyrex2001.kubedock.session"
+	// LabelTestcontainersSession is the label that is set by testcontainers
+	// and is used as the session if no LabelSession is set.
+	LabelTestcontainersSession = "org.testcontainers.sessionId"
+	// LabelTTL is the label to be used to specify the max time the container
+	// may be idle before it's reaped, overriding the global reapmax.
+	LabelTTL = "com.joyrex2001.kubedock.ttl"
+	// LabelToxics is the label to be used to specify the faults that are
+	// injected by the reverse-proxy (e.g. latency=100ms,bandwidth=64). The
+	// label can be suffixed with a container port (e.g. ...toxics.5432) to
+	// only apply the toxics to that port.
+	LabelToxics = "com.joyrex2001.kubedock.toxics"
+	// LabelCapture is the label to be used to record the connections that
+	// are proxied by the reverse-proxy, which is either true (all ports) or
+	// a comma separated list of container ports.
+	LabelCapture = "com.joyrex2001.kubedock.capture"
+)
+
+const (
+	// NetworkAffinityNone will not add any affinity for pods sharing a network.
+	NetworkAffinityNone = "none"
+	// NetworkAffinityColocate will prefer scheduling pods sharing a network on
+	// the same node.
+	NetworkAffinityColocate = "colocate"
+	// NetworkAffinitySpread will prefer scheduling pods sharing a network on
+	// different nodes.
+	NetworkAffinitySpread = "spread"
 )
 
 // GetEnvVar will return the environment variables of the container
@@ -107,6 +234,186 @@ func (co *Container) GetImagePullPolicy() (corev1.PullPolicy, error) {
 	return ps["default"], nil
 }
 
+// GetNodeSelector will return the node selector that should be applied for
+// this container, based on the LabelNodeSelector label and the requested
+// platform. The given current node selector (e.g. from the pod template) is
+// used as a base.
+func (co *Container) GetNodeSelector(current map[string]string) (map[string]string, error) {
+	sel := map[string]string{}
+	for k, v := range current {
+		sel[k] = v
+	}
+	if ns := co.Labels[LabelNodeSelector]; ns != "" {
+		for _, kv := range strings.Split(ns, ",") {
+			key, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				return sel, fmt.Errorf("invalid node selector %s: expected key=value", kv)
+			}
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return sel, fmt.Errorf("invalid node selector key %s: %s", key, strings.Join(errs, ", "))
+			}
+			if errs := validation.IsValidLabelValue(val); len(errs) > 0 {
+				return sel, fmt.Errorf("invalid node selector value %s: %s", val, strings.Join(errs, ", "))
+			}
+			sel[key] = val
+		}
+	}
+	if co.Platform != "" {
+		pos, arch, err := co.parsePlatform(co.Platform)
+		if err != nil {
+			return sel, err
+		}
+		sel[corev1.LabelOSStable] = pos
+		if arch != "" {
+			sel[corev1.LabelArchStable] = arch
+		}
+	}
+	if len(sel) == 0 {
+		return nil, nil
+	}
+	return sel, nil
+}
+
+// parsePlatform will parse a platform (os[/arch[/variant]]) and returns
+// the os and architecture. The variant is ignored.
+func (co *Container) parsePlatform(platform string) (string, string, error) {
+	parts := strings.Split(strings.ToLower(platform), "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid platform %s: expected os[/arch[/variant]]", platform)
+	}
+	for _, p := range parts {
+		if errs := validation.IsValidLabelValue(p); len(errs) > 0 || p == "" {
+			return "", "", fmt.Errorf("invalid platform %s: expected os[/arch[/variant]]", platform)
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	return parts[0], parts[1], nil
+}
+
+// GetTolerations will return the tolerations that should be applied for
+// this container, based on the LabelTolerations label. The format of each
+// toleration is similar to a taint (key[=value][:effect]). If no value is
+// given, the toleration will use the Exists operator; a key of * will
+// tolerate everything.
+func (co *Container) GetTolerations() ([]corev1.Toleration, error) {
+	tols := []corev1.Toleration{}
+	tl := co.Labels[LabelTolerations]
+	if tl == "" {
+		return tols, nil
+	}
+	effects := map[string]corev1.TaintEffect{
+		"":                 "",
+		"noschedule":       corev1.TaintEffectNoSchedule,
+		"prefernoschedule": corev1.TaintEffectPreferNoSchedule,
+		"noexecute":        corev1.TaintEffectNoExecute,
+	}
+	for _, t := range strings.Split(tl, ",") {
+		t = strings.TrimSpace(t)
+		kv, eff, _ := strings.Cut(t, ":")
+		effect, ok := effects[strings.ToLower(eff)]
+		if !ok {
+			return tols, fmt.Errorf("invalid toleration %s: unknown effect %s", t, eff)
+		}
+		key, val, hasval := strings.Cut(kv, "=")
+		tol := corev1.Toleration{Key: key, Effect: effect, Operator: corev1.TolerationOpExists}
+		if key == "*" {
+			tol.Key = ""
+		} else if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return tols, fmt.Errorf("invalid toleration key %s: %s", key, strings.Join(errs, ", "))
+		}
+		if hasval {
+			if errs := validation.IsValidLabelValue(val); len(errs) > 0 || tol.Key == "" {
+				return tols, fmt.Errorf("invalid toleration %s: invalid value %s", t, val)
+			}
+			tol.Operator = corev1.TolerationOpEqual
+			tol.Value = val
+		}
+		tols = append(tols, tol)
+	}
+	return tols, nil
+}
+
+// GetNetworkAffinity will return the network affinity mode (none, colocate
+// or spread) that should be applied for this container.
+func (co *Container) GetNetworkAffinity() (string, error) {
+	na := strings.ToLower(co.Labels[LabelNetworkAffinity])
+	if na == "" {
+		return NetworkAffinityNone, nil
+	}
+	if err := ValidateNetworkAffinity(na); err != nil {
+		return NetworkAffinityNone, err
+	}
+	return na, nil
+}
+
+// ValidateNetworkAffinity will return an error if given network affinity
+// mode is not none, colocate or spread.
+func ValidateNetworkAffinity(mode string) error {
+	switch strings.ToLower(mode) {
+	case NetworkAffinityNone, NetworkAffinityColocate, NetworkAffinitySpread:
+		return nil
+	}
+	return fmt.Errorf("invalid network affinity: %s", mode)
+}
+
+// GetPodPatch will return the patch that should be applied to the pod, as
+// specified with the LabelPodPatch label. The patch can be a strategic merge
+// patch (json object) or a json patch (json array), and can optionally be
+// base64 encoded. If no patch is specified, it will return a nil patch.
+func (co *Container) GetPodPatch() (apitypes.PatchType, []byte, error) {
+	pp := strings.TrimSpace(co.Labels[LabelPodPatch])
+	if pp == "" {
+		return "", nil, nil
+	}
+	patch := []byte(pp)
+	if !strings.HasPrefix(pp, "{") && !strings.HasPrefix(pp, "[") {
+		dat, err := base64.StdEncoding.DecodeString(pp)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid pod patch: not json, nor base64 encoded json")
+		}
+		patch = bytes.TrimSpace(dat)
+	}
+	var obj interface{}
+	if err := json.Unmarshal(patch, &obj); err != nil {
+		return "", nil, fmt.Errorf("invalid pod patch: %w", err)
+	}
+	switch obj.(type) {
+	case map[string]interface{}:
+		return apitypes.StrategicMergePatchType, patch, nil
+	case []interface{}:
+		return apitypes.JSONPatchType, patch, nil
+	}
+	return "", nil, fmt.Errorf("invalid pod patch: expected a json object or array")
+}
+
+// GetPriorityClassName will return the priority class that should be used
+// for this container, or the given current value if not specified.
+func (co *Container) GetPriorityClassName(current string) (string, error) {
+	pc := co.Labels[LabelPriorityClass]
+	if pc == "" {
+		return current, nil
+	}
+	if errs := validation.IsDNS1123Subdomain(pc); len(errs) > 0 {
+		return current, fmt.Errorf("invalid priority class %s: %s", pc, strings.Join(errs, ", "))
+	}
+	return pc, nil
+}
+
+// GetRuntimeClassName will return the runtime class that should be used
+// for this container, or the given current value if not specified.
+func (co *Container) GetRuntimeClassName(current *string) (*string, error) {
+	rc := co.Labels[LabelRuntimeClass]
+	if rc == "" {
+		return current, nil
+	}
+	if errs := validation.IsDNS1123Subdomain(rc); len(errs) > 0 {
+		return current, fmt.Errorf("invalid runtime class %s: %s", rc, strings.Join(errs, ", "))
+	}
+	return &rc, nil
+}
+
 // GetResourceRequirements will return a k8s request/limits configuration
 // based on the LabelRequestCPU and LabelRequestMemory labels set on the
 // container.
@@ -151,6 +458,68 @@ func (co *Container) GetResourceRequirements() (corev1.ResourceRequirements, err
 	return req, nil
 }
 
+// GetHostname will return the hostname and subdomain that should be used
+// for the pod. If the hostname is a fully qualified name, and no domain name
+// is set, the domain part of the hostname is used as subdomain. The hostname
+// should be a valid dns label, and the domain a valid dns subdomain, otherwise
+// an error is returned. As the subdomain of a pod is a single dns label, a
+// domain consisting of multiple labels (e.g. corp.local) is not set on the
+// pod.
+func (co *Container) GetHostname() (string, string, error) {
+	host, domain := co.Hostname, co.Domainname
+	if domain == "" {
+		host, domain, _ = strings.Cut(host, ".")
+	}
+	if host != "" {
+		if errs := validation.IsDNS1123Label(host); len(errs) > 0 {
+			return "", "", fmt.Errorf("invalid hostname %s: %s", host, strings.Join(errs, ", "))
+		}
+	}
+	if domain != "" {
+		if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+			return "", "", fmt.Errorf("invalid domainname %s: %s", domain, strings.Join(errs, ", "))
+		}
+		if strings.Contains(domain, ".") {
+			klog.V(2).Infof("ignoring domainname %s, only a single dns label can be used as subdomain", domain)
+			domain = ""
+		}
+	}
+	return host, domain, nil
+}
+
+// GetDNSConfig will return the dns policy and dns config that should be used
+// for the pod. If dns servers are configured, the policy will be None and
+// only the given servers are used. If only search domains or options are
+// configured, these are added to the default cluster dns config. If nothing
+// is configured, an empty policy and nil config is returned.
+func (co *Container) GetDNSConfig() (corev1.DNSPolicy, *corev1.PodDNSConfig, error) {
+	if len(co.DNS) == 0 && len(co.DNSSearch) == 0 && len(co.DNSOptions) == 0 {
+		return "", nil, nil
+	}
+	policy := corev1.DNSClusterFirst
+	cfg := &corev1.PodDNSConfig{}
+	for _, ns := range co.DNS {
+		if net.ParseIP(ns) == nil {
+			return "", nil, fmt.Errorf("invalid dns server %s: should be an ip address", ns)
+		}
+		cfg.Nameservers = append(cfg.Nameservers, ns)
+		policy = corev1.DNSNone
+	}
+	cfg.Searches = append(cfg.Searches, co.DNSSearch...)
+	for _, opt := range co.DNSOptions {
+		name, val, ok := strings.Cut(opt, ":")
+		if name == "" {
+			return "", nil, fmt.Errorf("invalid dns option %s", opt)
+		}
+		o := corev1.PodDNSConfigOption{Name: name}
+		if ok {
+			o.Value = &val
+		}
+		cfg.Options = append(cfg.Options, o)
+	}
+	return policy, cfg, nil
+}
+
 // GetServiceAccountName will return the service account to be used for containers
 // that are deployed.
 func (co *Container) GetServiceAccountName(current string) string {
@@ -163,6 +532,186 @@ func (co *Container) GetServiceAccountName(current string) string {
 	return current
 }
 
+// GetSessionID will return the session the container belongs to, which is
+// either set with LabelSession, or the testcontainers session id. If neither
+// is set, an empty string is returned.
+func (co *Container) GetSessionID() string {
+	if id := co.Labels[LabelSession]; id != "" {
+		return id
+	}
+	return co.Labels[LabelTestcontainersSession]
+}
+
+// GetTTL will return the max time the container may be idle before it's
+// reaped, as configured with the LabelTTL label (e.g. 2h). If the label is
+// not set, the given current value is returned.
+func (co *Container) GetTTL(current time.Duration) (time.Duration, error) {
+	ttl, ok := co.Labels[LabelTTL]
+	if !ok {
+		return current, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(ttl))
+	if err != nil || d <= 0 {
+		return current, fmt.Errorf("invalid ttl: %s", ttl)
+	}
+	return d, nil
+}
+
+// Touch will record api activity (e.g. inspect, exec, logs or proxied
+// traffic) for the container.
+func (co *Container) Touch() {
+	atomic.StoreInt64(&co.lastActivity, time.Now().UnixNano())
+}
+
+// GetLastActivity will return the time of the last recorded activity for
+// the container, or the created time if there was no activity yet.
+func (co *Container) GetLastActivity() time.Time {
+	last := atomic.LoadInt64(&co.lastActivity)
+	if last == 0 || time.Unix(0, last).Before(co.Created) {
+		return co.Created
+	}
+	return time.Unix(0, last)
+}
+
+// SetPortForwardStatus will record the status of the port-forward for the
+// local port in given status.
+func (co *Container) SetPortForwardStatus(st PortForwardStatus) {
+	co.portForwards.Store(st.LocalPort, st)
+}
+
+// GetPortForwardStatus will return the status of all port-forwards of the
+// container, ordered by local port.
+func (co *Container) GetPortForwardStatus() []PortForwardStatus {
+	res := []PortForwardStatus{}
+	co.portForwards.Range(func(_, val interface{}) bool {
+		res = append(res, val.(PortForwardStatus))
+		return true
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].LocalPort < res[j].LocalPort })
+	return res
+}
+
+// GetToxicsLabels will return the toxics specifications as configured with
+// the LabelToxics labels, by container port. Toxics that apply to all ports
+// are returned with port 0.
+func (co *Container) GetToxicsLabels() (map[int]string, error) {
+	res := map[int]string{}
+	for key, val := range co.Labels {
+		if key != LabelToxics && !strings.HasPrefix(key, LabelToxics+".") {
+			continue
+		}
+		port := 0
+		if key != LabelToxics {
+			p, err := strconv.Atoi(strings.TrimPrefix(key, LabelToxics+"."))
+			if err != nil || p <= 0 {
+				return res, fmt.Errorf("invalid toxics port in label %s", key)
+			}
+			port = p
+		}
+		res[port] = val
+	}
+	return res, nil
+}
+
+// InitToxics will set the given toxics, by container port. The toxics are
+// only initialized once, so toxics that are changed at runtime are kept
+// when the container is restarted.
+func (co *Container) InitToxics(txs map[int]Toxics) {
+	if !atomic.CompareAndSwapInt32(&co.toxicsLoaded, 0, 1) {
+		return
+	}
+	for port, tx := range txs {
+		co.SetToxics(port, tx)
+	}
+}
+
+// SetToxics will set the toxics for given container port, or for all ports
+// if port is 0. Setting empty toxics will remove the toxics for the port.
+func (co *Container) SetToxics(port int, tx Toxics) {
+	if tx == (Toxics{}) {
+		co.toxics.Delete(port)
+	} else {
+		co.toxics.Store(port, tx)
+	}
+	co.toxicsMu.Lock()
+	defer co.toxicsMu.Unlock()
+	if co.toxicsChanged != nil {
+		close(co.toxicsChanged)
+		co.toxicsChanged = nil
+	}
+}
+
+// ToxicsChanged will return a channel that is closed when the toxics of
+// the container are changed. A new channel should be requested after
+// each change.
+func (co *Container) ToxicsChanged() <-chan struct{} {
+	co.toxicsMu.Lock()
+	defer co.toxicsMu.Unlock()
+	if co.toxicsChanged == nil {
+		co.toxicsChanged = make(chan struct{})
+	}
+	return co.toxicsChanged
+}
+
+// GetToxics will return the toxics that apply to given container port,
+// which are either the toxics for that specific port, or the toxics for
+// all ports.
+func (co *Container) GetToxics(port int) Toxics {
+	if tx, ok := co.toxics.Load(port); ok {
+		return tx.(Toxics)
+	}
+	if tx, ok := co.toxics.Load(0); ok {
+		return tx.(Toxics)
+	}
+	return Toxics{}
+}
+
+// GetAllToxics will return all configured toxics, by container port (where
+// port 0 applies to all ports).
+func (co *Container) GetAllToxics() map[int]Toxics {
+	res := map[int]Toxics{}
+	co.toxics.Range(func(key, val interface{}) bool {
+		res[key.(int)] = val.(Toxics)
+		return true
+	})
+	return res
+}
+
+// GetCapturePorts will return the container ports of which the proxied
+// connections should be recorded, as configured with the LabelCapture label.
+// If all ports should be recorded, port 0 is returned.
+func (co *Container) GetCapturePorts() (map[int]bool, error) {
+	res := map[int]bool{}
+	val, ok := co.Labels[LabelCapture]
+	if !ok {
+		return res, nil
+	}
+	if all, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+		if all {
+			res[0] = true
+		}
+		return res, nil
+	}
+	for _, p := range strings.Split(val, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || port <= 0 {
+			return map[int]bool{}, fmt.Errorf("invalid capture port %s", p)
+		}
+		res[port] = true
+	}
+	return res, nil
+}
+
+// IsCapturePort will return true if the proxied connections of given
+// container port should be recorded.
+func (co *Container) IsCapturePort(port int) bool {
+	ports, err := co.GetCapturePorts()
+	if err != nil {
+		klog.Errorf("error parsing capture label: %s", err)
+	}
+	return ports[0] || ports[port]
+}
+
 // GetPodName will return a human friendly name that can be used for the
 // the container deployments.
 func (co *Container) GetPodName() string {
@@ -186,10 +735,36 @@ func (co *Container) GetPodName() string {
 	return name
 }
 
+// UserLookup is the interface to resolve user and group names to their
+// numeric ids, e.g. as defined in the container image.
+type UserLookup interface {
+	// LookupUser will return the uid and primary gid of given user.
+	LookupUser(string) (int64, int64, error)
+	// LookupGroup will return the gid of given group.
+	LookupGroup(string) (int64, error)
+}
+
 // GetPodSecurityContext will create a security context for the Pod that implements
-// the relenvant features of the Docker API. Right now this only covers the ability
-// to specify the numeric user a container should run as.
-func (co *Container) GetPodSecurityContext(context *corev1.PodSecurityContext) (*corev1.PodSecurityContext, error) {
+// the relenvant features of the Docker API. This covers the user and group a container
+// should run as, additional groups and sysctls. The user can be specified as "uid:gid"
+// or "user:group"; names are resolved with given lookup.
+func (co *Container) GetPodSecurityContext(context *corev1.PodSecurityContext, lookup UserLookup) (*corev1.PodSecurityContext, error) {
+	groups, err := co.GetSupplementalGroups()
+	if err != nil {
+		return context, err
+	}
+	sysctls, err := co.GetSysctls()
+	if err != nil {
+		return context, err
+	}
+	if len(groups) > 0 || len(sysctls) > 0 {
+		if context == nil {
+			context = &corev1.PodSecurityContext{}
+		}
+		context.SupplementalGroups = append(context.SupplementalGroups, groups...)
+		context.Sysctls = append(context.Sysctls, sysctls...)
+	}
+
 	user, ok := co.Labels[LabelRunasUser]
 	if !ok || user == "" {
 		if context == nil || context.RunAsUser == nil {
@@ -202,16 +777,175 @@ func (co *Container) GetPodSecurityContext(context *corev1.PodSecurityContext) (
 		context = &corev1.PodSecurityContext{}
 	}
 
-	parsed, err := strconv.ParseInt(user, 10, 64)
+	usr, grp, _ := strings.Cut(user, ":")
+
+	uid, err := strconv.ParseInt(usr, 10, 64)
 	if err != nil {
-		return context, fmt.Errorf("failed to parse %s to Int64", user)
+		if !co.isAccountName(usr) || lookup == nil {
+			return context, fmt.Errorf("failed to parse %s to Int64", usr)
+		}
+		var gid int64
+		uid, gid, err = lookup.LookupUser(usr)
+		if err != nil {
+			return context, err
+		}
+		if grp == "" {
+			context.RunAsGroup = &gid
+		}
+	}
+	context.RunAsUser = &uid
+
+	if grp != "" {
+		gid, err := strconv.ParseInt(grp, 10, 64)
+		if err != nil {
+			if !co.isAccountName(grp) || lookup == nil {
+				return context, fmt.Errorf("failed to parse %s to Int64", grp)
+			}
+			gid, err = lookup.LookupGroup(grp)
+			if err != nil {
+				return context, err
+			}
+		}
+		context.RunAsGroup = &gid
+	}
+
+	return context, nil
+}
+
+// HasNamedUser will return true if the user or group the container should
+// run as is specified by name, rather than a numeric id.
+func (co *Container) HasNamedUser() bool {
+	usr, grp, _ := strings.Cut(co.Labels[LabelRunasUser], ":")
+	for _, n := range []string{usr, grp} {
+		if _, err := strconv.ParseInt(n, 10, 64); err != nil && co.isAccountName(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAccountName will return true if given string is a valid user or group
+// name.
+func (co *Container) isAccountName(name string) bool {
+	return regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*\$?$`).MatchString(name)
+}
+
+// GetSupplementalGroups will return the numeric groups that are added to
+// the container with GroupAdd.
+func (co *Container) GetSupplementalGroups() ([]int64, error) {
+	groups := []int64{}
+	for _, g := range co.GroupAdd {
+		gid, err := strconv.ParseInt(g, 10, 64)
+		if err != nil {
+			return groups, fmt.Errorf("invalid group %s: only numeric groups are supported", g)
+		}
+		groups = append(groups, gid)
+	}
+	return groups, nil
+}
+
+// GetSysctls will return the configured sysctls as k8s Sysctls, sorted
+// by name.
+func (co *Container) GetSysctls() ([]corev1.Sysctl, error) {
+	sysctls := []corev1.Sysctl{}
+	for name, value := range co.Sysctls {
+		if name == "" {
+			return sysctls, fmt.Errorf("invalid sysctl with empty name")
+		}
+		sysctls = append(sysctls, corev1.Sysctl{Name: name, Value: value})
 	}
+	sort.Slice(sysctls, func(i, j int) bool {
+		return sysctls[i].Name < sysctls[j].Name
+	})
+	return sysctls, nil
+}
 
-	context.RunAsUser = &parsed
+// GetContainerSecurityContext will create a security context for the main
+// container, based on the privileged, capabilities, read-only root filesystem
+// and security options settings of the Docker API. It will return nil if none
+// of these are configured.
+func (co *Container) GetContainerSecurityContext() (*corev1.SecurityContext, error) {
+	context := &corev1.SecurityContext{}
+	set := false
 
+	if co.Privileged {
+		priv := true
+		context.Privileged = &priv
+		set = true
+	}
+
+	if co.ReadOnlyRootfs {
+		ro := true
+		context.ReadOnlyRootFilesystem = &ro
+		set = true
+	}
+
+	if len(co.CapAdd) > 0 || len(co.CapDrop) > 0 {
+		context.Capabilities = &corev1.Capabilities{
+			Add:  co.getCapabilities(co.CapAdd),
+			Drop: co.getCapabilities(co.CapDrop),
+		}
+		set = true
+	}
+
+	for _, opt := range co.SecurityOpt {
+		key, value, _ := strings.Cut(opt, "=")
+		if !strings.Contains(opt, "=") {
+			key, value, _ = strings.Cut(opt, ":")
+		}
+		switch strings.ToLower(key) {
+		case "no-new-privileges":
+			nnp := value == "" || strings.ToLower(value) == "true"
+			escalate := !nnp
+			context.AllowPrivilegeEscalation = &escalate
+			set = true
+		case "seccomp":
+			prof, err := co.getSeccompProfile(value)
+			if err != nil {
+				return nil, err
+			}
+			context.SeccompProfile = prof
+			set = true
+		default:
+			klog.Warningf("ignoring unsupported security option %s", opt)
+		}
+	}
+
+	if !set {
+		return nil, nil
+	}
 	return context, nil
 }
 
+// getCapabilities will convert given list of docker capabilities to a
+// list of k8s capabilities (e.g. "cap_net_admin" to "NET_ADMIN").
+func (co *Container) getCapabilities(caps []string) []corev1.Capability {
+	res := []corev1.Capability{}
+	for _, c := range caps {
+		c = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(c)), "CAP_")
+		if c != "" {
+			res = append(res, corev1.Capability(c))
+		}
+	}
+	return res
+}
+
+// getSeccompProfile will convert given docker seccomp profile to a k8s
+// SeccompProfile. Custom profiles should be available on the node, and
+// can be referred to with "localhost/<profile>".
+func (co *Container) getSeccompProfile(prof string) (*corev1.SeccompProfile, error) {
+	switch {
+	case prof == "unconfined":
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}, nil
+	case prof == "default" || prof == "runtime/default" || prof == "builtin":
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, nil
+	case strings.HasPrefix(prof, "localhost/") && len(prof) > len("localhost/"):
+		local := strings.TrimPrefix(prof, "localhost/")
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &local}, nil
+	}
+	return nil, fmt.Errorf("unsupported seccomp profile %s: use unconfined, runtime/default or localhost/<profile>", prof)
+}
+
 // MapPort will map a pod port to a local port.
 func (co *Container) MapPort(pod, local int) {
 	if co.MappedPorts == nil {
@@ -282,6 +1016,23 @@ func (co *Container) GetServicePorts() map[int]int {
 	return ports
 }
 
+// GetHostIP will return the host address of given container port, which is
+// the external host if the port is exposed outside the cluster, otherwise
+// the HostIP of the container.
+func (co *Container) GetHostIP(port int) string {
+	if ext, ok := co.ExternalPorts[port]; ok {
+		return ext.Host
+	}
+	return co.HostIP
+}
+
+// HasHeadlessServices will return true if the network aliases of this
+// container should be exposed via headless services, which is the case
+// when aliases are configured, but no ports are known.
+func (co *Container) HasHeadlessServices() bool {
+	return len(co.NetworkAliases) > 0 && len(co.GetServicePorts()) == 0
+}
+
 // getTCPPorts will return a list of all tcp ports in given map.
 func (co *Container) getTCPPorts(ports map[string]interface{}) []int {
 	res := []int{}
@@ -354,6 +1105,61 @@ func (co *Container) GetVolumeFiles() map[string]string {
 	return mounts
 }
 
+// GetTmpfsMounts will return a map of memory backed mounts that should be
+// mounted on the target container. The key is the target location, and the
+// value the optional size limit. If a shm size is configured, this will
+// be included as /dev/shm.
+func (co *Container) GetTmpfsMounts() (map[string]*resource.Quantity, error) {
+	mounts := map[string]*resource.Quantity{}
+	for dst, opts := range co.Tmpfs {
+		if !strings.HasPrefix(dst, "/") {
+			return mounts, fmt.Errorf("invalid tmpfs mount %s: path should be absolute", dst)
+		}
+		mounts[dst] = nil
+		for _, opt := range strings.Split(opts, ",") {
+			key, val, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			if key != "size" {
+				continue
+			}
+			size, err := co.parseMemorySize(val)
+			if err != nil {
+				return mounts, fmt.Errorf("invalid tmpfs size for %s: %w", dst, err)
+			}
+			mounts[dst] = resource.NewQuantity(size, resource.BinarySI)
+		}
+	}
+	if co.ShmSize < 0 {
+		return mounts, fmt.Errorf("invalid shm size %d", co.ShmSize)
+	}
+	if co.ShmSize > 0 {
+		mounts["/dev/shm"] = resource.NewQuantity(co.ShmSize, resource.BinarySI)
+	}
+	return mounts, nil
+}
+
+// parseMemorySize will parse a docker memory size (e.g. 64m or 1g) and
+// returns the amount of bytes.
+func (co *Container) parseMemorySize(size string) (int64, error) {
+	re := regexp.MustCompile(`^(?i)([0-9]+(?:\.[0-9]+)?)\s*([kmgtp]?)(i?b)?$`)
+	m := re.FindStringSubmatch(strings.TrimSpace(size))
+	if m == nil {
+		return 0, fmt.Errorf("could not parse size %s", size)
+	}
+	val, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse size %s: %w", size, err)
+	}
+	mult := map[string]float64{
+		"":  1,
+		"k": 1 << 10,
+		"m": 1 << 20,
+		"g": 1 << 30,
+		"t": 1 << 40,
+		"p": 1 << 50,
+	}
+	return int64(val * mult[strings.ToLower(m[2])]), nil
+}
+
 // GetPreArchiveFiles will return all single files from the pre-archives as
 // a map with the filename as key, and the actual file contents as value.
 func (co *Container) GetPreArchiveFiles() map[string][]byte {
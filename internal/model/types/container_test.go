@@ -1,12 +1,14 @@
 package types
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
 )
 
 func TestNew(t *testing.T) {
@@ -382,7 +384,7 @@ func TestGetRunasUser(t *testing.T) {
 		},
 	}
 	for i, tst := range tests {
-		res, err := tst.in.GetPodSecurityContext(tst.insc)
+		res, err := tst.in.GetPodSecurityContext(tst.insc, nil)
 		if err != nil && !tst.err {
 			t.Errorf("failed test %d - unexpected error: %s", i, err)
 		}
@@ -548,6 +550,24 @@ func TestGetServicePorts(t *testing.T) {
 	}
 }
 
+func TestHasHeadlessServices(t *testing.T) {
+	tests := []struct {
+		in  *Container
+		out bool
+	}{
+		{in: &Container{}, out: false},
+		{in: &Container{NetworkAliases: []string{"tb303"}}, out: true},
+		{in: &Container{NetworkAliases: []string{"tb303"}, ExposedPorts: map[string]interface{}{"303/tcp": 0}}, out: false},
+		{in: &Container{NetworkAliases: []string{"tb303"}, HostPorts: map[int]int{-303: 303}}, out: false},
+		{in: &Container{ExposedPorts: map[string]interface{}{"303/tcp": 0}}, out: false},
+	}
+	for i, tst := range tests {
+		if res := tst.in.HasHeadlessServices(); res != tst.out {
+			t.Errorf("failed test %d - expected %t, but got %t", i, tst.out, res)
+		}
+	}
+}
+
 func TestStop(t *testing.T) {
 	tainr := &Container{}
 	res := 0
@@ -739,3 +759,643 @@ func TestMatch(t *testing.T) {
 func makeIntPointer(x int64) *int64 {
 	return &x
 }
+
+func TestGetContainerSecurityContext(t *testing.T) {
+	tru := true
+	fals := false
+	local := "profiles/audit.json"
+	tests := []struct {
+		in  *Container
+		out *corev1.SecurityContext
+		err bool
+	}{
+		{ // 0
+			in:  &Container{},
+			out: nil,
+		},
+		{ // 1
+			in:  &Container{Privileged: true, ReadOnlyRootfs: true},
+			out: &corev1.SecurityContext{Privileged: &tru, ReadOnlyRootFilesystem: &tru},
+		},
+		{ // 2
+			in: &Container{CapAdd: []string{"NET_ADMIN", "cap_sys_time"}, CapDrop: []string{"all"}},
+			out: &corev1.SecurityContext{Capabilities: &corev1.Capabilities{
+				Add:  []corev1.Capability{"NET_ADMIN", "SYS_TIME"},
+				Drop: []corev1.Capability{"ALL"},
+			}},
+		},
+		{ // 3
+			in:  &Container{SecurityOpt: []string{"no-new-privileges"}},
+			out: &corev1.SecurityContext{AllowPrivilegeEscalation: &fals},
+		},
+		{ // 4
+			in:  &Container{SecurityOpt: []string{"no-new-privileges:false"}},
+			out: &corev1.SecurityContext{AllowPrivilegeEscalation: &tru},
+		},
+		{ // 5
+			in:  &Container{SecurityOpt: []string{"seccomp=unconfined"}},
+			out: &corev1.SecurityContext{SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}},
+		},
+		{ // 6
+			in:  &Container{SecurityOpt: []string{"seccomp:runtime/default"}},
+			out: &corev1.SecurityContext{SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}},
+		},
+		{ // 7
+			in:  &Container{SecurityOpt: []string{"seccomp=localhost/profiles/audit.json"}},
+			out: &corev1.SecurityContext{SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &local}},
+		},
+		{ // 8
+			in:  &Container{SecurityOpt: []string{"seccomp=/tmp/profile.json"}},
+			err: true,
+		},
+		{ // 9
+			in:  &Container{SecurityOpt: []string{"label=disable"}},
+			out: nil,
+		},
+	}
+	for i, tst := range tests {
+		res, err := tst.in.GetContainerSecurityContext()
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetPodSecurityContextGroupsSysctls(t *testing.T) {
+	tests := []struct {
+		in      *Container
+		groups  []int64
+		sysctls []corev1.Sysctl
+		err     bool
+	}{
+		{ // 0
+			in: &Container{},
+		},
+		{ // 1
+			in:     &Container{GroupAdd: []string{"100", "200"}},
+			groups: []int64{100, 200},
+		},
+		{ // 2
+			in:  &Container{GroupAdd: []string{"wheel"}},
+			err: true,
+		},
+		{ // 3
+			in:      &Container{Sysctls: map[string]string{"net.ipv4.tcp_syncookies": "1", "kernel.shm_rmid_forced": "1"}},
+			sysctls: []corev1.Sysctl{{Name: "kernel.shm_rmid_forced", Value: "1"}, {Name: "net.ipv4.tcp_syncookies", Value: "1"}},
+		},
+	}
+	for i, tst := range tests {
+		res, err := tst.in.GetPodSecurityContext(nil, nil)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if tst.err {
+			continue
+		}
+		if tst.groups == nil && tst.sysctls == nil {
+			if res != nil {
+				t.Errorf("failed test %d - expected nil, but got %v", i, res)
+			}
+			continue
+		}
+		if len(tst.groups) > 0 && !reflect.DeepEqual(res.SupplementalGroups, tst.groups) {
+			t.Errorf("failed test %d - expected groups %v, but got %v", i, tst.groups, res.SupplementalGroups)
+		}
+		if len(tst.sysctls) > 0 && !reflect.DeepEqual(res.Sysctls, tst.sysctls) {
+			t.Errorf("failed test %d - expected sysctls %v, but got %v", i, tst.sysctls, res.Sysctls)
+		}
+	}
+}
+
+type userLookup struct{}
+
+func (ul *userLookup) LookupUser(name string) (int64, int64, error) {
+	if name == "postgres" {
+		return 999, 998, nil
+	}
+	return 0, 0, fmt.Errorf("user %s not found", name)
+}
+
+func (ul *userLookup) LookupGroup(name string) (int64, error) {
+	if name == "nogroup" {
+		return 65534, nil
+	}
+	return 0, fmt.Errorf("group %s not found", name)
+}
+
+func TestGetRunasUserGroup(t *testing.T) {
+	tests := []struct {
+		user   string
+		lookup UserLookup
+		uid    int64
+		gid    *int64
+		named  bool
+		err    bool
+	}{
+		{user: "1000:2000", uid: 1000, gid: makeIntPointer(2000)},
+		{user: "1000", uid: 1000},
+		{user: "postgres", lookup: &userLookup{}, uid: 999, gid: makeIntPointer(998), named: true},
+		{user: "postgres:nogroup", lookup: &userLookup{}, uid: 999, gid: makeIntPointer(65534), named: true},
+		{user: "postgres:100", lookup: &userLookup{}, uid: 999, gid: makeIntPointer(100), named: true},
+		{user: "1000:nogroup", lookup: &userLookup{}, uid: 1000, gid: makeIntPointer(65534), named: true},
+		{user: "postgres", named: true, err: true},
+		{user: "nobody", lookup: &userLookup{}, named: true, err: true},
+		{user: "1000:wheel", lookup: &userLookup{}, named: true, err: true},
+		{user: "1000:", uid: 1000},
+		{user: "10.0", err: true},
+	}
+	for i, tst := range tests {
+		in := &Container{Labels: map[string]string{LabelRunasUser: tst.user}}
+		if named := in.HasNamedUser(); named != tst.named {
+			t.Errorf("failed test %d - expected named %t, but got %t", i, tst.named, named)
+		}
+		res, err := in.GetPodSecurityContext(nil, tst.lookup)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if res.RunAsUser == nil || *res.RunAsUser != tst.uid {
+			t.Errorf("failed test %d - expected uid %d, but got %v", i, tst.uid, res.RunAsUser)
+		}
+		if !reflect.DeepEqual(res.RunAsGroup, tst.gid) {
+			t.Errorf("failed test %d - expected gid %v, but got %v", i, tst.gid, res.RunAsGroup)
+		}
+	}
+}
+
+func TestGetTmpfsMounts(t *testing.T) {
+	tests := []struct {
+		in  *Container
+		out map[string]string
+		err bool
+	}{
+		{in: &Container{}, out: map[string]string{}},
+		{in: &Container{Tmpfs: map[string]string{"/run": ""}}, out: map[string]string{"/run": ""}},
+		{in: &Container{Tmpfs: map[string]string{"/run": "rw,noexec,size=64m"}}, out: map[string]string{"/run": "64Mi"}},
+		{in: &Container{Tmpfs: map[string]string{"/run": "size=1g,mode=1777"}}, out: map[string]string{"/run": "1Gi"}},
+		{in: &Container{Tmpfs: map[string]string{"/run": "size=512KB"}}, out: map[string]string{"/run": "512Ki"}},
+		{in: &Container{Tmpfs: map[string]string{"/run": "size=1024"}}, out: map[string]string{"/run": "1Ki"}},
+		{in: &Container{ShmSize: 2147483648}, out: map[string]string{"/dev/shm": "2Gi"}},
+		{in: &Container{ShmSize: 67108864, Tmpfs: map[string]string{"/tmp": ""}}, out: map[string]string{"/dev/shm": "64Mi", "/tmp": ""}},
+		{in: &Container{Tmpfs: map[string]string{"/run": "size=50%"}}, err: true},
+		{in: &Container{Tmpfs: map[string]string{"run": ""}}, err: true},
+		{in: &Container{ShmSize: -1}, err: true},
+	}
+	for i, tst := range tests {
+		res, err := tst.in.GetTmpfsMounts()
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		out := map[string]string{}
+		for dst, size := range res {
+			out[dst] = ""
+			if size != nil {
+				out[dst] = size.String()
+			}
+		}
+		if !reflect.DeepEqual(out, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, out)
+		}
+	}
+}
+
+func TestGetHostname(t *testing.T) {
+	tests := []struct {
+		in        *Container
+		hostname  string
+		subdomain string
+		err       bool
+	}{
+		{in: &Container{}},
+		{in: &Container{Hostname: "db"}, hostname: "db"},
+		{in: &Container{Hostname: "db", Domainname: "cluster"}, hostname: "db", subdomain: "cluster"},
+		{in: &Container{Hostname: "db.cluster"}, hostname: "db", subdomain: "cluster"},
+		{in: &Container{Domainname: "cluster"}, subdomain: "cluster"},
+		{in: &Container{Hostname: "db.corp.local"}, hostname: "db"},
+		{in: &Container{Hostname: "db", Domainname: "example.com"}, hostname: "db"},
+		{in: &Container{Hostname: "db", Domainname: "example..com"}, err: true},
+		{in: &Container{Hostname: "db.Corp_1"}, err: true},
+		{in: &Container{Hostname: "DB_1"}, err: true},
+	}
+	for i, tst := range tests {
+		host, domain, err := tst.in.GetHostname()
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if host != tst.hostname || domain != tst.subdomain {
+			t.Errorf("failed test %d - expected %s/%s, but got %s/%s", i, tst.hostname, tst.subdomain, host, domain)
+		}
+	}
+}
+
+func TestGetDNSConfig(t *testing.T) {
+	ndots := "2"
+	tests := []struct {
+		in     *Container
+		policy corev1.DNSPolicy
+		config *corev1.PodDNSConfig
+		err    bool
+	}{
+		{in: &Container{}},
+		{
+			in:     &Container{DNS: []string{"8.8.8.8"}},
+			policy: corev1.DNSNone,
+			config: &corev1.PodDNSConfig{Nameservers: []string{"8.8.8.8"}},
+		},
+		{
+			in:     &Container{DNSSearch: []string{"example.com"}, DNSOptions: []string{"ndots:2", "rotate"}},
+			policy: corev1.DNSClusterFirst,
+			config: &corev1.PodDNSConfig{
+				Searches: []string{"example.com"},
+				Options:  []corev1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}, {Name: "rotate"}},
+			},
+		},
+		{in: &Container{DNS: []string{"dns.google"}}, err: true},
+		{in: &Container{DNSOptions: []string{":2"}}, err: true},
+	}
+	for i, tst := range tests {
+		policy, config, err := tst.in.GetDNSConfig()
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if policy != tst.policy {
+			t.Errorf("failed test %d - expected policy %s, but got %s", i, tst.policy, policy)
+		}
+		if !reflect.DeepEqual(config, tst.config) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.config, config)
+		}
+	}
+}
+
+func TestGetNodeSelector(t *testing.T) {
+	tests := []struct {
+		in      *Container
+		current map[string]string
+		out     map[string]string
+		err     bool
+	}{
+		{in: &Container{}},
+		{in: &Container{}, current: map[string]string{"pool": "ci"}, out: map[string]string{"pool": "ci"}},
+		{
+			in:  &Container{Labels: map[string]string{LabelNodeSelector: "pool=db, disktype=ssd"}},
+			out: map[string]string{"pool": "db", "disktype": "ssd"},
+		},
+		{
+			in:      &Container{Labels: map[string]string{LabelNodeSelector: "pool=db"}},
+			current: map[string]string{"pool": "ci", "zone": "a"},
+			out:     map[string]string{"pool": "db", "zone": "a"},
+		},
+		{
+			in:  &Container{Platform: "linux/arm64/v8"},
+			out: map[string]string{"kubernetes.io/os": "linux", "kubernetes.io/arch": "arm64"},
+		},
+		{
+			in:  &Container{Platform: "linux"},
+			out: map[string]string{"kubernetes.io/os": "linux"},
+		},
+		{in: &Container{Labels: map[string]string{LabelNodeSelector: "pool"}}, err: true},
+		{in: &Container{Labels: map[string]string{LabelNodeSelector: "pool=d b"}}, err: true},
+		{in: &Container{Platform: "/arm64"}, err: true},
+		{in: &Container{Platform: "linux/arm64/v8/extra"}, err: true},
+	}
+	for i, tst := range tests {
+		res, err := tst.in.GetNodeSelector(tst.current)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err == nil && !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetTolerations(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []corev1.Toleration
+		err bool
+	}{
+		{in: "", out: []corev1.Toleration{}},
+		{
+			in:  "dedicated=db:NoSchedule",
+			out: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "db", Effect: corev1.TaintEffectNoSchedule}},
+		},
+		{
+			in: "dedicated:noexecute, spot",
+			out: []corev1.Toleration{
+				{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+				{Key: "spot", Operator: corev1.TolerationOpExists},
+			},
+		},
+		{in: "*", out: []corev1.Toleration{{Operator: corev1.TolerationOpExists}}},
+		{in: "dedicated=db:Sometimes", err: true},
+		{in: "*=db", err: true},
+		{in: "in valid", err: true},
+	}
+	for i, tst := range tests {
+		in := &Container{Labels: map[string]string{LabelTolerations: tst.in}}
+		res, err := in.GetTolerations()
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err == nil && !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetPriorityRuntimeClassName(t *testing.T) {
+	current := "default"
+	tests := []struct {
+		labels   map[string]string
+		priority string
+		runtime  *string
+		err      bool
+	}{
+		{labels: map[string]string{}, priority: "default", runtime: &current},
+		{labels: map[string]string{LabelPriorityClass: "high", LabelRuntimeClass: "gvisor"}, priority: "high", runtime: makeStringPointer("gvisor")},
+		{labels: map[string]string{LabelPriorityClass: "High!"}, err: true},
+		{labels: map[string]string{LabelRuntimeClass: "g_visor"}, err: true},
+	}
+	for i, tst := range tests {
+		in := &Container{Labels: tst.labels}
+		pc, err1 := in.GetPriorityClassName(current)
+		rc, err2 := in.GetRuntimeClassName(&current)
+		if (err1 != nil || err2 != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error result: %v, %v", i, err1, err2)
+		}
+		if tst.err {
+			continue
+		}
+		if pc != tst.priority {
+			t.Errorf("failed test %d - expected priority class %s, but got %s", i, tst.priority, pc)
+		}
+		if stringPointerValue(rc) != stringPointerValue(tst.runtime) {
+			t.Errorf("failed test %d - expected runtime class %s, but got %s", i, stringPointerValue(tst.runtime), stringPointerValue(rc))
+		}
+	}
+}
+
+func makeStringPointer(s string) *string {
+	return &s
+}
+
+func stringPointerValue(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+func TestGetPodPatch(t *testing.T) {
+	tests := []struct {
+		in  string
+		typ apitypes.PatchType
+		out string
+		err bool
+	}{
+		{in: ""},
+		{in: `{"spec":{}}`, typ: apitypes.StrategicMergePatchType, out: `{"spec":{}}`},
+		{in: `[{"op":"remove","path":"/spec"}]`, typ: apitypes.JSONPatchType, out: `[{"op":"remove","path":"/spec"}]`},
+		{in: "eyJzcGVjIjp7fX0=", typ: apitypes.StrategicMergePatchType, out: `{"spec":{}}`},
+		{in: "{invalid", err: true},
+		{in: "not base64!", err: true},
+		{in: "MTIz", err: true},
+	}
+	for i, tst := range tests {
+		in := &Container{Labels: map[string]string{LabelPodPatch: tst.in}}
+		typ, res, err := in.GetPodPatch()
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if typ != tst.typ || string(res) != tst.out {
+			t.Errorf("failed test %d - expected %s %s, but got %s %s", i, tst.typ, tst.out, typ, res)
+		}
+	}
+}
+
+func TestGetSessionID(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		out    string
+	}{
+		{labels: map[string]string{}, out: ""},
+		{labels: map[string]string{LabelTestcontainersSession: "tc"}, out: "tc"},
+		{labels: map[string]string{LabelSession: "kd"}, out: "kd"},
+		{labels: map[string]string{LabelSession: "kd", LabelTestcontainersSession: "tc"}, out: "kd"},
+	}
+	for i, tst := range tests {
+		tainr := &Container{Labels: tst.labels}
+		if res := tainr.GetSessionID(); res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+	}
+}
+
+func TestGetTTL(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		out    time.Duration
+		err    bool
+	}{
+		{labels: map[string]string{}, out: time.Hour},
+		{labels: map[string]string{LabelTTL: "10m"}, out: 10 * time.Minute},
+		{labels: map[string]string{LabelTTL: "4h"}, out: 4 * time.Hour},
+		{labels: map[string]string{LabelTTL: "forever"}, out: time.Hour, err: true},
+		{labels: map[string]string{LabelTTL: "-5m"}, out: time.Hour, err: true},
+	}
+	for i, tst := range tests {
+		tainr := &Container{Labels: tst.labels}
+		res, err := tainr.GetTTL(time.Hour)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+	}
+}
+
+func TestLastActivity(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	tainr := &Container{Created: created}
+	if !tainr.GetLastActivity().Equal(created) {
+		t.Errorf("expected created time as last activity, but got %s", tainr.GetLastActivity())
+	}
+	tainr.Touch()
+	if time.Since(tainr.GetLastActivity()) > time.Minute {
+		t.Errorf("expected recent last activity, but got %s", tainr.GetLastActivity())
+	}
+}
+
+func TestPortForwardStatus(t *testing.T) {
+	tainr := &Container{}
+	if len(tainr.GetPortForwardStatus()) != 0 {
+		t.Errorf("expected no port-forward status")
+	}
+	tainr.SetPortForwardStatus(PortForwardStatus{LocalPort: 8080, State: "connecting"})
+	tainr.SetPortForwardStatus(PortForwardStatus{LocalPort: 443, State: "ready"})
+	tainr.SetPortForwardStatus(PortForwardStatus{LocalPort: 8080, State: "ready", Restarts: 1})
+	res := tainr.GetPortForwardStatus()
+	if len(res) != 2 || res[0].LocalPort != 443 || res[1].State != "ready" || res[1].Restarts != 1 {
+		t.Errorf("unexpected port-forward status %v", res)
+	}
+}
+
+func TestGetToxicsLabels(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		out    map[int]string
+		err    bool
+	}{
+		{labels: map[string]string{}, out: map[int]string{}},
+		{
+			labels: map[string]string{LabelToxics: "latency=100ms", LabelToxics + ".5432": "bandwidth=64"},
+			out:    map[int]string{0: "latency=100ms", 5432: "bandwidth=64"},
+		},
+		{labels: map[string]string{LabelToxics + ".http": "latency=100ms"}, err: true},
+		{labels: map[string]string{LabelToxics + ".0": "latency=100ms"}, err: true},
+	}
+	for i, tst := range tests {
+		tainr := &Container{Labels: tst.labels}
+		res, err := tainr.GetToxicsLabels()
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if !tst.err && !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+	}
+}
+
+func TestToxics(t *testing.T) {
+	tainr := &Container{}
+	tainr.InitToxics(map[int]Toxics{0: {Latency: 100 * time.Millisecond}})
+	if tainr.GetToxics(80).Latency != 100*time.Millisecond {
+		t.Errorf("expected toxics for all ports to apply to port 80")
+	}
+	changed := tainr.ToxicsChanged()
+	tainr.SetToxics(80, Toxics{Bandwidth: 10})
+	select {
+	case <-changed:
+	default:
+		t.Errorf("expected toxics changed channel to be closed")
+	}
+	if tainr.ToxicsChanged() == changed {
+		t.Errorf("expected a new toxics changed channel after a change")
+	}
+	if tx := tainr.GetToxics(80); tx.Latency != 0 || tx.Bandwidth != 10 {
+		t.Errorf("expected port specific toxics for port 80, but got %v", tx)
+	}
+	tainr.SetToxics(0, Toxics{})
+	tainr.InitToxics(map[int]Toxics{0: {Latency: 100 * time.Millisecond}})
+	if tx := tainr.GetToxics(443); tx != (Toxics{}) {
+		t.Errorf("expected removed toxics to stay removed after initializing again, but got %v", tx)
+	}
+	if len(tainr.GetAllToxics()) != 1 {
+		t.Errorf("expected 1 toxic, but got %v", tainr.GetAllToxics())
+	}
+}
+
+func TestGetCapturePorts(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		out    map[int]bool
+		port   int
+		match  bool
+		err    bool
+	}{
+		{labels: map[string]string{}, out: map[int]bool{}, port: 80},
+		{labels: map[string]string{LabelCapture: "true"}, out: map[int]bool{0: true}, port: 80, match: true},
+		{labels: map[string]string{LabelCapture: "false"}, out: map[int]bool{}, port: 80},
+		{labels: map[string]string{LabelCapture: "5432, 8080"}, out: map[int]bool{5432: true, 8080: true}, port: 8080, match: true},
+		{labels: map[string]string{LabelCapture: "5432"}, out: map[int]bool{5432: true}, port: 8080},
+		{labels: map[string]string{LabelCapture: "http"}, out: map[int]bool{}, port: 80, err: true},
+	}
+	for i, tst := range tests {
+		tainr := &Container{Labels: tst.labels}
+		res, err := tainr.GetCapturePorts()
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if !reflect.DeepEqual(res, tst.out) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+		if tainr.IsCapturePort(tst.port) != tst.match {
+			t.Errorf("failed test %d - expected capture of port %d to be %t", i, tst.port, tst.match)
+		}
+	}
+}
+
+func TestGetHostIP(t *testing.T) {
+	tainr := &Container{HostIP: "10.0.0.1", ExternalPorts: map[int]ExternalPort{5432: {Host: "lb.example.com", Port: 5432}}}
+	if ip := tainr.GetHostIP(5432); ip != "lb.example.com" {
+		t.Errorf("expected external host for exposed port, but got %s", ip)
+	}
+	if ip := tainr.GetHostIP(8080); ip != "10.0.0.1" {
+		t.Errorf("expected host ip for port that is not exposed, but got %s", ip)
+	}
+}
+
+func TestValidateNetworkAffinity(t *testing.T) {
+	tests := []struct {
+		in  string
+		err bool
+	}{
+		{in: "none"},
+		{in: "colocate"},
+		{in: "Spread"},
+		{in: "together", err: true},
+		{in: "", err: true},
+	}
+	for i, tst := range tests {
+		err := ValidateNetworkAffinity(tst.in)
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - unexpected error %s", i, err)
+		}
+	}
+}
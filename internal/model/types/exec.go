@@ -1,6 +1,7 @@
 package types
 
 import (
+	"sync/atomic"
 	"time"
 )
 
@@ -15,4 +16,19 @@ type Exec struct {
 	Stderr      bool
 	ExitCode    int
 	Created     time.Time
+	running     int32
+}
+
+// SetRunning will mark the exec as running, or as finished.
+func (ex *Exec) SetRunning(running bool) {
+	val := int32(0)
+	if running {
+		val = 1
+	}
+	atomic.StoreInt32(&ex.running, val)
+}
+
+// IsRunning will return true if the exec is currently running.
+func (ex *Exec) IsRunning() bool {
+	return atomic.LoadInt32(&ex.running) == 1
 }
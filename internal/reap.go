@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/reaper"
+)
+
+// Reap will run the reaper once for the configured namespace, and delete all
+// resources of kubedock instances that are no longer alive. If all is set,
+// all kubedock resources are deleted instead. If dryrun is set, the resources
+// that would be deleted are written to given writer, rather than deleting
+// them.
+func Reap(out io.Writer, dryrun, all bool) error {
+	cfg, err := config.GetKubernetes()
+	if err != nil {
+		return fmt.Errorf("error instantiating kubernetes client: %w", err)
+	}
+
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("error instantiating kubernetes client: %w", err)
+	}
+
+	kub := backend.New(backend.Config{
+		Client:     cli,
+		RestConfig: cfg,
+		Namespace:  viper.GetString("kubernetes.namespace"),
+	})
+
+	rpr, err := reaper.New(reaper.Config{
+		KeepMax: viper.GetDuration("reaper.reapmax"),
+		Backend: kub,
+	})
+	if err != nil {
+		return fmt.Errorf("error instantiating reaper: %w", err)
+	}
+
+	if !dryrun {
+		if all {
+			return kub.DeleteAll()
+		}
+		return rpr.Clean()
+	}
+
+	var res []backend.Candidate
+	if all {
+		res, err = kub.DeleteAllDryRun()
+	} else {
+		res, err = rpr.DryRun()
+	}
+	if err != nil {
+		return err
+	}
+	writeCandidates(out, res)
+	return nil
+}
+
+// writeCandidates will write given candidates as a table to given writer.
+func writeCandidates(out io.Writer, res []backend.Candidate) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tINSTANCE\tAGE\tREASON")
+	for _, c := range res {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Kind, c.Name, c.Instance, c.Age, c.Reason)
+	}
+	w.Flush()
+}
@@ -1,38 +1,77 @@
 package reaper
 
 import (
+	"fmt"
 	"time"
 
 	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/events"
+	"github.com/joyrex2001/kubedock/internal/model/types"
 )
 
 // CleanContainers will clean all lingering containers that are
-// older than the configured keepMax duration, and stored locally
-// in the in memory database.
+// stored locally in the in memory database, and have been idle for
+// longer than the configured keepMax duration, or the ttl that is
+// configured on the container itself.
 func (in *Reaper) CleanContainers() error {
 	tainrs, err := in.db.GetContainers()
 	if err != nil {
 		return err
 	}
+	failed := 0
 	for _, tainr := range tainrs {
-		if tainr.Created.Before(time.Now().Add(-in.keepMax)) {
-			klog.V(3).Infof("deleting container: %s", tainr.ID)
+		if _, ok := in.getContainerReapReason(tainr); ok {
+			klog.V(3).Infof("deleting container: %s (idle since %s)", tainr.ID, tainr.GetLastActivity().Format(time.RFC3339))
 			if err := in.kub.DeleteContainer(tainr); err != nil {
-				// inform only, if deleting somehow failed, the
-				// CleanContainersKubernetes will pick it up anyways
+				// keep the container, so deleting is retried in the
+				// next cycle; CleanContainersKubernetes only cleans
+				// resources of other kubedock instances
 				klog.Warningf("error deleting deployment: %s", err)
+				failed++
+				continue
+			}
+			if !tainr.Stopped && !tainr.Killed {
+				in.events.Publish(tainr.ID, events.Container, events.Die)
 			}
 			if err := in.db.DeleteContainer(tainr); err != nil {
 				return err
 			}
+			in.events.Publish(tainr.ID, events.Container, events.Destroy)
 		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("failed deleting %d containers", failed)
+	}
 	return nil
 }
 
 // CleanContainersKubernetes will clean all lingering containers
-// that are older than the configured keepMax duration, and stored
-// not stored in the local in memory database.
+// that are older than the configured keepMax duration, and are
+// not orchestrated by this instance (and hence not stored in the
+// local in memory database).
 func (in *Reaper) CleanContainersKubernetes() error {
-	return in.kub.DeleteOlderThan(in.keepMax + 15*time.Minute)
+	return in.kub.DeleteOlderThan(in.getKubernetesKeepMax())
+}
+
+// getKubernetesKeepMax will return the max age of kubernetes resources of
+// other kubedock instances, which is a bit more relaxed than the keepMax
+// to give these instances a chance to clean up themselves.
+func (in *Reaper) getKubernetesKeepMax() time.Duration {
+	return in.keepMax + 15*time.Minute
+}
+
+// getContainerReapReason will return the reason why given container should
+// be reaped, and false if it should not be reaped. Containers are reaped if
+// they have been idle for longer than their ttl, or the configured keepMax
+// duration if no ttl is set.
+func (in *Reaper) getContainerReapReason(tainr *types.Container) (string, bool) {
+	ttl, err := tainr.GetTTL(in.keepMax)
+	if err != nil {
+		klog.Warningf("using default reapmax for container %s: %s", tainr.ShortID, err)
+	}
+	if tainr.GetLastActivity().Before(time.Now().Add(-ttl)) {
+		return fmt.Sprintf("idle for longer than %s", ttl), true
+	}
+	return "", false
 }
@@ -1,13 +1,17 @@
 package reaper
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 
 	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/events"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 )
 
@@ -33,6 +37,14 @@ func TestCleanContainers(t *testing.T) {
 		}
 	}
 	time.Sleep(100 * time.Millisecond)
+	evs, id := rp.events.Subscribe()
+	defer rp.events.Unsubscribe(id)
+	actions := make(chan string, 2)
+	go func() {
+		for msg := range evs {
+			actions <- msg.Action
+		}
+	}()
 	if err := rp.CleanContainers(); err != nil {
 		t.Errorf("unexpected error while cleaning containers: %s", err)
 	}
@@ -43,4 +55,101 @@ func TestCleanContainers(t *testing.T) {
 			t.Errorf("expected 0 container, but got %d", len(excs))
 		}
 	}
+	for _, exp := range []string{events.Die, events.Destroy} {
+		select {
+		case act := <-actions:
+			if act != exp {
+				t.Errorf("expected %s event, but got %s", exp, act)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("expected %s event, but got none", exp)
+		}
+	}
+}
+
+func TestCleanContainersIdle(t *testing.T) {
+	kub := backend.New(backend.Config{
+		Client:    fake.NewSimpleClientset(),
+		Namespace: viper.GetString("kubernetes.namespace"),
+		InitImage: viper.GetString("kubernetes.initimage"),
+	})
+	rp, _ := New(Config{
+		KeepMax: time.Hour,
+		Backend: kub,
+	})
+	rp.keepMax = time.Hour
+
+	tests := []struct {
+		tainr  *types.Container
+		touch  bool
+		reaped bool
+	}{
+		{tainr: &types.Container{}, reaped: false},
+		{tainr: &types.Container{Labels: map[string]string{types.LabelTTL: "1ms"}}, reaped: true},
+		{tainr: &types.Container{Labels: map[string]string{types.LabelTTL: "30ms"}}, touch: true, reaped: false},
+		{tainr: &types.Container{Labels: map[string]string{types.LabelTTL: "invalid"}}, reaped: false},
+	}
+	for _, tst := range tests {
+		rp.db.SaveContainer(tst.tainr)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, tst := range tests {
+		if tst.touch {
+			tst.tainr.Touch()
+		}
+	}
+
+	if err := rp.CleanContainers(); err != nil {
+		t.Errorf("unexpected error while cleaning containers: %s", err)
+	}
+	for i, tst := range tests {
+		_, err := rp.db.GetContainer(tst.tainr.ID)
+		if (err != nil) != tst.reaped {
+			t.Errorf("failed test %d - expected reaped %t, but got %t", i, tst.reaped, err != nil)
+		}
+		rp.db.DeleteContainer(tst.tainr)
+	}
+}
+
+func TestCleanContainersRetry(t *testing.T) {
+	cli := fake.NewSimpleClientset()
+	fail := true
+	cli.PrependReactor("list", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if fail {
+			return true, nil, fmt.Errorf("api unavailable")
+		}
+		return false, nil, nil
+	})
+	kub := backend.New(backend.Config{
+		Client:    cli,
+		Namespace: viper.GetString("kubernetes.namespace"),
+		InitImage: viper.GetString("kubernetes.initimage"),
+	})
+	rp, _ := New(Config{
+		KeepMax: time.Millisecond,
+		Backend: kub,
+	})
+	rp.keepMax = time.Millisecond
+	rp.kub = kub
+	tainr := &types.Container{}
+	rp.db.SaveContainer(tainr)
+	time.Sleep(10 * time.Millisecond)
+
+	tests := []struct {
+		fail   bool
+		reaped bool
+	}{
+		{fail: true, reaped: false},
+		{fail: false, reaped: true},
+	}
+	for i, tst := range tests {
+		fail = tst.fail
+		if err := rp.CleanContainers(); (err != nil) != tst.fail {
+			t.Errorf("failed test %d - expected error %t, but got %v", i, tst.fail, err)
+		}
+		_, err := rp.db.GetContainer(tainr.ID)
+		if (err != nil) != tst.reaped {
+			t.Errorf("failed test %d - expected reaped %t, but got %t", i, tst.reaped, err != nil)
+		}
+	}
 }
@@ -4,18 +4,19 @@ import (
 	"time"
 
 	"k8s.io/klog"
-)
 
-var execReapMax = 5 * time.Minute
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
 
-// CleanExecs will clean all lingering execs that are older than 5 minutes.
+// CleanExecs will clean all lingering execs that are older than the
+// configured execMax duration, and are no longer running.
 func (in *Reaper) CleanExecs() error {
 	excs, err := in.db.GetExecs()
 	if err != nil {
 		return err
 	}
 	for _, exc := range excs {
-		if exc.Created.Before(time.Now().Add(-execReapMax)) {
+		if in.isExecExpired(exc) {
 			klog.V(3).Infof("deleting exec: %s", exc.ID)
 			if err := in.db.DeleteExec(exc); err != nil {
 				return err
@@ -24,3 +25,8 @@ func (in *Reaper) CleanExecs() error {
 	}
 	return nil
 }
+
+// isExecExpired will return true if given exec should be reaped.
+func (in *Reaper) isExecExpired(exc *types.Exec) bool {
+	return !exc.IsRunning() && exc.Created.Before(time.Now().Add(-in.execMax))
+}
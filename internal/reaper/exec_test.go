@@ -9,7 +9,7 @@ import (
 
 func TestCleanExecs(t *testing.T) {
 	rp, _ := New(Config{})
-	execReapMax = 20 * time.Millisecond
+	rp.execMax = 20 * time.Millisecond
 	rp.db.SaveExec(&types.Exec{})
 	if err := rp.CleanExecs(); err != nil {
 		t.Errorf("unexpected error while cleaning execs: %s", err)
@@ -33,3 +33,33 @@ func TestCleanExecs(t *testing.T) {
 		}
 	}
 }
+
+func TestCleanExecsRunning(t *testing.T) {
+	rp, _ := New(Config{})
+	rp.execMax = 20 * time.Millisecond
+
+	tests := []struct {
+		exec    *types.Exec
+		running bool
+		reaped  bool
+	}{
+		{exec: &types.Exec{}, running: false, reaped: true},
+		{exec: &types.Exec{}, running: true, reaped: false},
+	}
+	for _, tst := range tests {
+		tst.exec.SetRunning(tst.running)
+		rp.db.SaveExec(tst.exec)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err := rp.CleanExecs(); err != nil {
+		t.Errorf("unexpected error while cleaning execs: %s", err)
+	}
+	for i, tst := range tests {
+		_, err := rp.db.GetExec(tst.exec.ID)
+		if (err != nil) != tst.reaped {
+			t.Errorf("failed test %d - expected reaped %t, but got %t", i, tst.reaped, err != nil)
+		}
+		rp.db.DeleteExec(tst.exec)
+	}
+}
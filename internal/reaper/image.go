@@ -0,0 +1,47 @@
+package reaper
+
+import (
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// CleanImages will clean all image records that are older than the
+// configured imageMax duration, and are not used by any container.
+func (in *Reaper) CleanImages() error {
+	if in.imageMax <= 0 {
+		return nil
+	}
+	imgs, err := in.db.GetImages()
+	if err != nil {
+		return err
+	}
+	tainrs, err := in.db.GetContainers()
+	if err != nil {
+		return err
+	}
+	for _, img := range imgs {
+		if in.isImageExpired(img, tainrs) {
+			klog.V(3).Infof("deleting image: %s", img.Name)
+			if err := in.db.DeleteImage(img); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isImageExpired will return true if given image record should be reaped.
+func (in *Reaper) isImageExpired(img *types.Image, tainrs []*types.Container) bool {
+	if in.imageMax <= 0 || img.Created.After(time.Now().Add(-in.imageMax)) {
+		return false
+	}
+	for _, tainr := range tainrs {
+		if tainr.Image == img.Name || tainr.Image == img.ID {
+			return false
+		}
+	}
+	return true
+}
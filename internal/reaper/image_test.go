@@ -0,0 +1,44 @@
+package reaper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestCleanImages(t *testing.T) {
+	rp, _ := New(Config{})
+
+	used := &types.Image{Name: "joyrex2001/used:latest"}
+	unused := &types.Image{Name: "joyrex2001/unused:latest"}
+	rp.db.SaveImage(used)
+	rp.db.SaveImage(unused)
+	tainr := &types.Container{Image: used.Name}
+	rp.db.SaveContainer(tainr)
+	defer rp.db.DeleteContainer(tainr)
+	defer rp.db.DeleteImage(used)
+	defer rp.db.DeleteImage(unused)
+	time.Sleep(50 * time.Millisecond)
+
+	tests := []struct {
+		max    time.Duration
+		img    *types.Image
+		reaped bool
+	}{
+		{max: 0, img: unused, reaped: false},
+		{max: time.Hour, img: unused, reaped: false},
+		{max: 20 * time.Millisecond, img: used, reaped: false},
+		{max: 20 * time.Millisecond, img: unused, reaped: true},
+	}
+	for i, tst := range tests {
+		rp.imageMax = tst.max
+		if err := rp.CleanImages(); err != nil {
+			t.Errorf("failed test %d - unexpected error while cleaning images: %s", i, err)
+		}
+		_, err := rp.db.GetImage(tst.img.ID)
+		if (err != nil) != tst.reaped {
+			t.Errorf("failed test %d - expected reaped %t, but got %t", i, tst.reaped, err != nil)
+		}
+	}
+}
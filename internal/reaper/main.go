@@ -1,23 +1,34 @@
 package reaper
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/events"
 	"github.com/joyrex2001/kubedock/internal/model"
 )
 
 // Reaper is the object handles reaping of resources.
 type Reaper struct {
-	db      *model.Database
-	keepMax time.Duration
-	kub     backend.Backend
-	quit    chan struct{}
+	db         *model.Database
+	keepMax    time.Duration
+	execMax    time.Duration
+	networkMax time.Duration
+	imageMax   time.Duration
+	kub        backend.Backend
+	events     events.Events
+	quit       chan struct{}
 }
 
+// defaultExecMax is the max age of execs if not configured.
+const defaultExecMax = 5 * time.Minute
+
 var instance *Reaper
 var once sync.Once
 
@@ -25,6 +36,14 @@ var once sync.Once
 type Config struct {
 	// KeepMax is the maximum age of resources, older resources are deleted.
 	KeepMax time.Duration
+	// ExecMax is the maximum age of finished execs (defaults to 5 minutes).
+	ExecMax time.Duration
+	// NetworkMax is the maximum age of networks without connected containers
+	// (0 disables reaping networks).
+	NetworkMax time.Duration
+	// ImageMax is the maximum age of image records that are not used by any
+	// container (0 disables reaping images).
+	ImageMax time.Duration
 	// Backend is the kubedock backend object.
 	Backend backend.Backend
 }
@@ -38,7 +57,14 @@ func New(cfg Config) (*Reaper, error) {
 		db, err = model.New()
 		instance.db = db
 		instance.kub = cfg.Backend
+		instance.events = events.New()
 		instance.keepMax = cfg.KeepMax
+		instance.execMax = cfg.ExecMax
+		if instance.execMax <= 0 {
+			instance.execMax = defaultExecMax
+		}
+		instance.networkMax = cfg.NetworkMax
+		instance.imageMax = cfg.ImageMax
 	})
 	return instance, err
 }
@@ -71,15 +97,84 @@ func (in *Reaper) runloop() {
 	}()
 }
 
-// clean will run all cleaners.
-func (in *Reaper) clean() {
-	if err := in.CleanExecs(); err != nil {
-		klog.Errorf("error cleaning execs: %s", err)
+// clean will run all cleaners, and will return the errors of the cleaners
+// that failed.
+func (in *Reaper) clean() error {
+	errs := []error{}
+	for _, c := range []struct {
+		name  string
+		clean func() error
+	}{
+		{"execs", in.CleanExecs},
+		{"containers", in.CleanContainers},
+		{"networks", in.CleanNetworks},
+		{"images", in.CleanImages},
+		{"k8s containers", in.CleanContainersKubernetes},
+	} {
+		if err := c.clean(); err != nil {
+			klog.Errorf("error cleaning %s: %s", c.name, err)
+			errs = append(errs, fmt.Errorf("error cleaning %s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Clean will run all cleaners once, and will return an error if any of the
+// cleaners failed.
+func (in *Reaper) Clean() error {
+	return in.clean()
+}
+
+// DryRun will return all resources that would be deleted by the cleaners,
+// without actually deleting them. This includes the execs, containers,
+// networks and images in the in memory database, and the kubernetes resources of other kubedock
+// instances that are no longer alive.
+func (in *Reaper) DryRun() ([]backend.Candidate, error) {
+	res := []backend.Candidate{}
+
+	excs, err := in.db.GetExecs()
+	if err != nil {
+		return nil, err
 	}
-	if err := in.CleanContainers(); err != nil {
-		klog.Errorf("error cleaning containers: %s", err)
+	for _, exc := range excs {
+		if in.isExecExpired(exc) {
+			res = append(res, backend.NewCandidate("exec", exc.ID, config.InstanceID, exc.Created, fmt.Sprintf("finished and older than %s", in.execMax)))
+		}
+	}
+
+	tainrs, err := in.db.GetContainers()
+	if err != nil {
+		return nil, err
 	}
-	if err := in.CleanContainersKubernetes(); err != nil {
-		klog.Errorf("error cleaning k8s containers: %s", err)
+	for _, tainr := range tainrs {
+		if msg, ok := in.getContainerReapReason(tainr); ok {
+			res = append(res, backend.NewCandidate("container", tainr.ShortID, config.InstanceID, tainr.Created, msg))
+		}
+	}
+
+	netws, err := in.db.GetNetworks()
+	if err != nil {
+		return nil, err
+	}
+	for _, netw := range netws {
+		if in.isNetworkExpired(netw, tainrs) {
+			res = append(res, backend.NewCandidate("network", netw.Name, config.InstanceID, netw.Created, fmt.Sprintf("unused and older than %s", in.networkMax)))
+		}
+	}
+
+	imgs, err := in.db.GetImages()
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range imgs {
+		if in.isImageExpired(img, tainrs) {
+			res = append(res, backend.NewCandidate("image", img.Name, config.InstanceID, img.Created, fmt.Sprintf("unused and older than %s", in.imageMax)))
+		}
+	}
+
+	rscs, err := in.kub.DeleteOlderThanDryRun(in.getKubernetesKeepMax())
+	if err != nil {
+		return nil, err
 	}
+	return append(res, rscs...), nil
 }
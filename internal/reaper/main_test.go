@@ -2,6 +2,12 @@ package reaper
 
 import (
 	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/model/types"
 )
 
 func TestNew(t *testing.T) {
@@ -13,3 +19,38 @@ func TestNew(t *testing.T) {
 		}
 	}
 }
+
+func TestDryRun(t *testing.T) {
+	rp, _ := New(Config{})
+	rp.kub = backend.New(backend.Config{Client: fake.NewSimpleClientset(), Namespace: "default"})
+	rp.keepMax = time.Hour
+	rp.execMax = 20 * time.Millisecond
+	rp.networkMax = 0
+	rp.imageMax = 0
+
+	idle := &types.Container{Labels: map[string]string{types.LabelTTL: "1ms"}}
+	busy := &types.Container{}
+	exc := &types.Exec{}
+	rp.db.SaveContainer(idle)
+	rp.db.SaveContainer(busy)
+	rp.db.SaveExec(exc)
+	defer rp.db.DeleteContainer(idle)
+	defer rp.db.DeleteContainer(busy)
+	defer rp.db.DeleteExec(exc)
+	time.Sleep(50 * time.Millisecond)
+
+	res, err := rp.DryRun()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	kinds := map[string]string{}
+	for _, c := range res {
+		kinds[c.Kind] = c.Name
+	}
+	if len(res) != 2 || kinds["container"] != idle.ShortID || kinds["exec"] != exc.ID {
+		t.Errorf("expected idle container and exec as candidates, but got %v", res)
+	}
+	if _, err := rp.db.GetContainer(idle.ID); err != nil {
+		t.Errorf("expected container not to be deleted, but got %s", err)
+	}
+}
@@ -0,0 +1,48 @@
+package reaper
+
+import (
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// CleanNetworks will clean all networks that are older than the configured
+// networkMax duration, and have no containers connected. Pre-defined
+// networks are never cleaned.
+func (in *Reaper) CleanNetworks() error {
+	if in.networkMax <= 0 {
+		return nil
+	}
+	netws, err := in.db.GetNetworks()
+	if err != nil {
+		return err
+	}
+	tainrs, err := in.db.GetContainers()
+	if err != nil {
+		return err
+	}
+	for _, netw := range netws {
+		if in.isNetworkExpired(netw, tainrs) {
+			klog.V(3).Infof("deleting network: %s", netw.Name)
+			if err := in.db.DeleteNetwork(netw); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isNetworkExpired will return true if given network should be reaped.
+func (in *Reaper) isNetworkExpired(netw *types.Network, tainrs []*types.Container) bool {
+	if in.networkMax <= 0 || netw.IsPredefined() || netw.Created.After(time.Now().Add(-in.networkMax)) {
+		return false
+	}
+	for _, tainr := range tainrs {
+		if _, ok := tainr.Networks[netw.ID]; ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package reaper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestCleanNetworks(t *testing.T) {
+	rp, _ := New(Config{})
+
+	used := &types.Network{Name: "used"}
+	unused := &types.Network{Name: "unused"}
+	rp.db.SaveNetwork(used)
+	rp.db.SaveNetwork(unused)
+	tainr := &types.Container{Networks: map[string]interface{}{}}
+	rp.db.SaveContainer(tainr)
+	tainr.ConnectNetwork(used.ID)
+	defer rp.db.DeleteContainer(tainr)
+	defer rp.db.DeleteNetwork(used)
+	defer rp.db.DeleteNetwork(unused)
+	time.Sleep(50 * time.Millisecond)
+
+	tests := []struct {
+		max    time.Duration
+		netw   *types.Network
+		reaped bool
+	}{
+		{max: 0, netw: unused, reaped: false},
+		{max: time.Hour, netw: unused, reaped: false},
+		{max: 20 * time.Millisecond, netw: used, reaped: false},
+		{max: 20 * time.Millisecond, netw: unused, reaped: true},
+	}
+	for i, tst := range tests {
+		rp.networkMax = tst.max
+		if err := rp.CleanNetworks(); err != nil {
+			t.Errorf("failed test %d - unexpected error while cleaning networks: %s", i, err)
+		}
+		_, err := rp.db.GetNetwork(tst.netw.ID)
+		if (err != nil) != tst.reaped {
+			t.Errorf("failed test %d - expected reaped %t, but got %t", i, tst.reaped, err != nil)
+		}
+	}
+
+	for _, name := range []string{"bridge", "host", "null"} {
+		if _, err := rp.db.GetNetworkByName(name); err != nil {
+			t.Errorf("expected pre-defined network %s to be kept", name)
+		}
+	}
+}
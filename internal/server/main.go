@@ -9,19 +9,25 @@ import (
 	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/reaper"
 	"github.com/joyrex2001/kubedock/internal/server/httputil"
 	"github.com/joyrex2001/kubedock/internal/server/routes"
 	"github.com/joyrex2001/kubedock/internal/server/routes/common"
+	"github.com/joyrex2001/kubedock/internal/util/image"
 )
 
 // Server is the API server.
 type Server struct {
 	kub backend.Backend
+	rpr *reaper.Reaper
+	pol *image.Policy
 }
 
-// New will instantiate a Server object.
-func New(kub backend.Backend) *Server {
-	return &Server{kub: kub}
+// New will instantiate a Server object, which will enforce the given image
+// policy.
+func New(kub backend.Backend, rpr *reaper.Reaper, pol *image.Policy) *Server {
+	return &Server{kub: kub, rpr: rpr, pol: pol}
 }
 
 // Run will initialize the http api server and configure all available
@@ -114,21 +120,39 @@ func (s *Server) getGinEngine() *gin.Engine {
 	pulpol := viper.GetString("kubernetes.pull-policy")
 	klog.Infof("default image pull policy: %s", pulpol)
 
+	netaff := viper.GetString("kubernetes.network-affinity")
+	if netaff != "" && netaff != types.NetworkAffinityNone {
+		klog.Infof("default network affinity: %s", netaff)
+	}
+
 	sa := viper.GetString("kubernetes.service-account")
 	klog.Infof("service account used in deployments: %s", sa)
 
 	klog.Infof("using namespace: %s", viper.GetString("kubernetes.namespace"))
 
+	inslim, seslim := getLimits()
+	maxwait := viper.GetDuration("queue.max-wait")
+	if !inslim.IsZero() || !seslim.IsZero() {
+		klog.Infof("start queue enabled: max wait=%s", maxwait)
+	}
+
 	cr, err := common.NewContextRouter(s.kub, common.Config{
-		Inspector:      insp,
-		RequestCPU:     reqcpu,
-		RequestMemory:  reqmem,
-		ServiceAccount: sa,
-		RunasUser:      runasuid,
-		PullPolicy:     pulpol,
-		PortForward:    pfwrd,
-		ReverseProxy:   revprox,
-		PreArchive:     prea,
+		Inspector:       insp,
+		RequestCPU:      reqcpu,
+		RequestMemory:   reqmem,
+		ServiceAccount:  sa,
+		RunasUser:       runasuid,
+		PullPolicy:      pulpol,
+		NetworkAffinity: netaff,
+		PortForward:     pfwrd,
+		ReverseProxy:    revprox,
+		PreArchive:      prea,
+		ImagePolicy:     s.pol,
+		InstanceLimits:  inslim,
+		SessionLimits:   seslim,
+		QueueMaxWait:    maxwait,
+		Reaper:          s.rpr,
+		CaptureDir:      viper.GetString("capture.dir"),
 	})
 	if err != nil {
 		klog.Errorf("error setting up context: %s", err)
@@ -136,6 +160,28 @@ func (s *Server) getGinEngine() *gin.Engine {
 
 	routes.RegisterDockerRoutes(router, cr)
 	routes.RegisterLibpodRoutes(router, cr)
+	routes.RegisterKubedockRoutes(router, cr)
 
 	return router
 }
+
+// getLimits will return the instance and session limits as configured with
+// the max-containers, max-cpu, max-memory arguments (and their session
+// counterparts).
+func getLimits() (common.Limits, common.Limits) {
+	res := []common.Limits{}
+	for _, l := range []struct{ name, prefix string }{{"instance", "queue."}, {"session", "queue.session-"}} {
+		lim, err := common.ParseLimits(
+			viper.GetInt(l.prefix+"max-containers"),
+			viper.GetString(l.prefix+"max-cpu"),
+			viper.GetString(l.prefix+"max-memory"))
+		if err != nil {
+			klog.Fatalf("error parsing %s limits: %s", l.name, err)
+		}
+		if !lim.IsZero() {
+			klog.Infof("%s limits: max containers=%d, cpu=%s, memory=%s", l.name, lim.Containers, lim.CPU.String(), lim.Memory.String())
+		}
+		res = append(res, lim)
+	}
+	return res[0], res[1]
+}
@@ -48,6 +48,7 @@ func PutArchive(cr *ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 
 	archive, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -102,6 +103,7 @@ func HeadArchive(cr *ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 
 	path := c.Query("path")
 	if path == "" {
@@ -132,6 +134,7 @@ func GetArchive(cr *ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 
 	path := c.Query("path")
 	if path == "" {
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/joyrex2001/kubedock/internal/server/httputil"
+	"github.com/joyrex2001/kubedock/internal/util/reverseproxy"
+)
+
+// CaptureList - list the recorded connections, optionally filtered on
+// container (id or name).
+// GET "/kubedock/captures"
+func CaptureList(cr *ContextRouter, c *gin.Context) {
+	if cr.Config.CaptureDir == "" {
+		httputil.Error(c, http.StatusServiceUnavailable, fmt.Errorf("capture is not enabled"))
+		return
+	}
+	prefix := ""
+	if id := c.Query("container"); id != "" {
+		tainr, err := cr.DB.GetContainerByNameOrID(id)
+		if err != nil {
+			httputil.Error(c, http.StatusNotFound, err)
+			return
+		}
+		prefix = tainr.ShortID + "-"
+	}
+	res, err := reverseproxy.ListCaptures(cr.Config.CaptureDir, prefix)
+	if err != nil {
+		httputil.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// CaptureDownload - download a recorded connection.
+// GET "/kubedock/captures/:name"
+func CaptureDownload(cr *ContextRouter, c *gin.Context) {
+	if cr.Config.CaptureDir == "" {
+		httputil.Error(c, http.StatusServiceUnavailable, fmt.Errorf("capture is not enabled"))
+		return
+	}
+	name := c.Param("name")
+	path, err := reverseproxy.GetCapturePath(cr.Config.CaptureDir, name)
+	if err != nil {
+		httputil.Error(c, http.StatusNotFound, err)
+		return
+	}
+	c.FileAttachment(path, name)
+}
@@ -190,6 +190,7 @@ func ContainerAttach(cr *ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 
 	stdin, _ := strconv.ParseBool(c.Query("stdin"))
 	if stdin {
@@ -1,11 +1,18 @@
 package common
 
 import (
+	"sync"
+	"time"
+
 	"golang.org/x/time/rate"
+	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/backend"
 	"github.com/joyrex2001/kubedock/internal/events"
 	"github.com/joyrex2001/kubedock/internal/model"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/reaper"
+	"github.com/joyrex2001/kubedock/internal/util/image"
 )
 
 const (
@@ -13,6 +20,10 @@ const (
 	PollRate = 1
 	// PollBurst defines maximum burst poll requests towards the backend
 	PollBurst = 3
+	// RunningStatusInterval defines the minimum interval in which the pod
+	// status of a running container is checked when counting the running
+	// containers
+	RunningStatusInterval = 10 * time.Second
 )
 
 // Config is the structure to instantiate a Router object
@@ -33,8 +44,24 @@ type Config struct {
 	PullPolicy string
 	// PreArchive will enable copying files without starting containers
 	PreArchive bool
+	// NetworkAffinity contains the default network affinity mode for pods
+	NetworkAffinity string
 	// ServiceAccount contains the service account name to be used for running containers
 	ServiceAccount string
+	// ImagePolicy contains the optional policy of images that are allowed
+	ImagePolicy *image.Policy
+	// InstanceLimits contains the max running containers and requested
+	// resources for this kubedock instance
+	InstanceLimits Limits
+	// SessionLimits contains the max running containers and requested
+	// resources per session
+	SessionLimits Limits
+	// QueueMaxWait is the max time a container waits in the start queue
+	QueueMaxWait time.Duration
+	// Reaper is the reaper that is cleaning lingering resources
+	Reaper *reaper.Reaper
+	// CaptureDir is the directory containing the recorded connections
+	CaptureDir string
 }
 
 // ContextRouter is the object that contains shared context for the kubedock API endpoints.
@@ -44,6 +71,9 @@ type ContextRouter struct {
 	Backend backend.Backend
 	Events  events.Events
 	Limiter *rate.Limiter
+	Queue   *StartQueue
+	checked map[string]time.Time
+	mu      sync.Mutex
 }
 
 // NewContextRouter will instantiate a ContextRouter object.
@@ -59,5 +89,56 @@ func NewContextRouter(kub backend.Backend, cfg Config) (*ContextRouter, error) {
 		Events:  events.New(),
 		Limiter: rate.NewLimiter(PollRate, PollBurst),
 	}
+	if !cfg.InstanceLimits.IsZero() || !cfg.SessionLimits.IsZero() {
+		cr.Queue = NewStartQueue(cfg.InstanceLimits, cfg.SessionLimits, cfg.QueueMaxWait, cr.getRunningContainers, kub.GetResourceQuotas)
+	}
 	return cr, nil
 }
+
+// getRunningContainers will return all containers that are running. As
+// the completed state is only updated when a container is inspected, the
+// status of the pods of containers that are assumed to be running is
+// retrieved, and containers that completed or failed are not returned. The
+// status of each container is retrieved at most once per status interval,
+// and only if allowed by the rate limiter; otherwise it's assumed to be
+// still running.
+func (cr *ContextRouter) getRunningContainers() []*types.Container {
+	tainrs, err := cr.DB.GetContainers()
+	if err != nil {
+		klog.Errorf("error retrieving containers: %s", err)
+		return nil
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	checked := map[string]time.Time{}
+	res := []*types.Container{}
+	for _, tainr := range tainrs {
+		if !tainr.Running || tainr.Completed {
+			continue
+		}
+		last, ok := cr.checked[tainr.ID]
+		if (ok && time.Since(last) < RunningStatusInterval) || !cr.Limiter.Allow() {
+			if ok {
+				checked[tainr.ID] = last
+			}
+			res = append(res, tainr)
+			continue
+		}
+		checked[tainr.ID] = time.Now()
+		status, err := cr.Backend.GetContainerStatus(tainr)
+		if status == backend.DeployCompleted {
+			tainr.Finished = time.Now()
+			tainr.Completed = true
+			tainr.Running = false
+			continue
+		}
+		if status == backend.DeployFailed {
+			klog.V(3).Infof("not counting container %s as running: %s", tainr.ShortID, err)
+			continue
+		}
+		res = append(res, tainr)
+	}
+	cr.checked = checked
+	return res
+}
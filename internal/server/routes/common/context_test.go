@@ -0,0 +1,82 @@
+package common
+
+import (
+	"testing"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/model"
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestGetRunningContainers(t *testing.T) {
+	running := &corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	completed := &corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}
+	db, err := model.New()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		tainr     *types.Container
+		state     *corev1.ContainerState
+		running   bool
+		completed bool
+	}{
+		{tainr: &types.Container{Running: true}, state: running, running: true},
+		{tainr: &types.Container{Running: true}, state: completed, completed: true},
+		{tainr: &types.Container{}, state: running},
+		{tainr: &types.Container{Running: true}},
+	}
+	cli := fake.NewSimpleClientset()
+	for _, tst := range tests {
+		if err := db.SaveContainer(tst.tainr); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer db.DeleteContainer(tst.tainr)
+		if tst.state == nil {
+			continue
+		}
+		cli.Tracker().Add(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: tst.tainr.GetPodName(), Namespace: "default"},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "main", State: *tst.state}},
+			},
+		})
+	}
+	cr := &ContextRouter{
+		DB:      db,
+		Backend: backend.New(backend.Config{Client: cli, Namespace: "default"}),
+		Limiter: rate.NewLimiter(PollRate, PollBurst),
+	}
+
+	res := map[string]bool{}
+	for _, tainr := range cr.getRunningContainers() {
+		res[tainr.ID] = true
+	}
+	for i, tst := range tests {
+		if res[tst.tainr.ID] != tst.running {
+			t.Errorf("failed test %d - expected running %t, but got %t", i, tst.running, res[tst.tainr.ID])
+		}
+		if tst.tainr.Completed != tst.completed {
+			t.Errorf("failed test %d - expected completed %t, but got %t", i, tst.completed, tst.tainr.Completed)
+		}
+	}
+
+	// the status is not retrieved again within the status interval
+	gets := 0
+	cli.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+	cr.getRunningContainers()
+	if gets != 0 {
+		t.Errorf("expected no pod status requests within the status interval, but got %d", gets)
+	}
+}
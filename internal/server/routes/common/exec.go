@@ -35,11 +35,12 @@ func ContainerExec(cr *ContextRouter, c *gin.Context) {
 	}
 
 	id := c.Param("id")
-	_, err := cr.DB.GetContainer(id)
+	tainr, err := cr.DB.GetContainer(id)
 	if err != nil {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 
 	exec := &types.Exec{
 		ContainerID: id,
@@ -77,7 +78,7 @@ func ExecInfo(cr *ContextRouter, c *gin.Context) {
 		"OpenStderr": exec.Stderr,
 		"OpenStdin":  exec.Stdin,
 		"OpenStdout": exec.Stdout,
-		"Running":    false,
+		"Running":    exec.IsRunning(),
 		"ExitCode":   exec.ExitCode,
 		"ProcessConfig": gin.H{
 			"tty":        exec.TTY,
@@ -109,9 +110,12 @@ func ExecStart(cr *ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 
+	exec.SetRunning(true)
 	if req.Detach {
 		go func() {
+			defer exec.SetRunning(false)
 			code, err := cr.Backend.ExecContainer(tainr, exec, nil, io.Discard)
 			if err != nil {
 				klog.Errorf("error during exec: %s", err)
@@ -125,6 +129,7 @@ func ExecStart(cr *ContextRouter, c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{})
 		return
 	}
+	defer exec.SetRunning(false)
 
 	r := c.Request
 	w := c.Writer
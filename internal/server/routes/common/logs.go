@@ -25,6 +25,7 @@ func ContainerLogs(cr *ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 
 	if !tainr.Running && !tainr.Completed {
 		httputil.Error(c, http.StatusNotFound, fmt.Errorf("container %s is not running", tainr.ShortID))
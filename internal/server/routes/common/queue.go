@@ -0,0 +1,378 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+// QueuePollInterval is the interval in which waiting containers are checked
+// against the current usage.
+var QueuePollInterval = time.Second
+
+// Limits contains the max number of running containers, and the max total
+// cpu and memory requests of the running containers. Zero values are not
+// limited.
+type Limits struct {
+	Containers int
+	CPU        resource.Quantity
+	Memory     resource.Quantity
+}
+
+// ParseLimits will return a Limits object for the given max containers, and
+// the given max cpu and memory (as kubernetes quantities, or empty).
+func ParseLimits(containers int, cpu, memory string) (Limits, error) {
+	lim := Limits{Containers: containers}
+	if containers < 0 {
+		return lim, fmt.Errorf("invalid max containers %d", containers)
+	}
+	for _, l := range []struct {
+		val string
+		out *resource.Quantity
+	}{{cpu, &lim.CPU}, {memory, &lim.Memory}} {
+		if l.val == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(l.val)
+		if err != nil {
+			return lim, fmt.Errorf("invalid limit %s: %w", l.val, err)
+		}
+		*l.out = q
+	}
+	return lim, nil
+}
+
+// IsZero will return true if no limits are configured.
+func (l Limits) IsZero() bool {
+	return l.Containers == 0 && l.CPU.IsZero() && l.Memory.IsZero()
+}
+
+// fits will return true if the given request fits within the limits, when
+// added to the given usage.
+func (l Limits) fits(use usage, req usage) bool {
+	if l.Containers > 0 && use.containers+req.containers > l.Containers {
+		return false
+	}
+	use.add(req)
+	if !l.CPU.IsZero() && use.cpu.Cmp(l.CPU) > 0 {
+		return false
+	}
+	if !l.Memory.IsZero() && use.memory.Cmp(l.Memory) > 0 {
+		return false
+	}
+	return true
+}
+
+// usage contains the number of containers and their total cpu and memory
+// requests.
+type usage struct {
+	containers int
+	cpu        resource.Quantity
+	memory     resource.Quantity
+}
+
+// add will add the given usage to this usage.
+func (u *usage) add(o usage) {
+	u.containers += o.containers
+	u.cpu.Add(o.cpu)
+	u.memory.Add(o.memory)
+}
+
+// queueEntry is a container that is waiting in, or was admitted by, the
+// start queue.
+type queueEntry struct {
+	id      string
+	session string
+	req     usage
+	ready   chan struct{}
+	moved   chan struct{}
+}
+
+// StartQueue will limit the number of concurrently running containers and
+// their total requested cpu and memory, both for this kubedock instance and
+// per session. Containers that don't fit are queued until enough containers
+// are finished, or until the max wait time has passed.
+type StartQueue struct {
+	instance    Limits
+	session     Limits
+	maxWait     time.Duration
+	running     func() []*types.Container
+	quotas      func() ([]corev1.ResourceQuota, error)
+	waiting     []*queueEntry
+	starting    map[string]*queueEntry
+	kick        chan struct{}
+	dispatching bool
+	mu          sync.Mutex
+}
+
+// NewStartQueue will return a StartQueue for the given instance and session
+// limits. The running function should return the containers that are
+// currently running, and the quotas function should return the resource
+// quotas in the namespace, which are used to reject containers that will
+// never fit.
+func NewStartQueue(instance, session Limits, maxWait time.Duration, running func() []*types.Container, quotas func() ([]corev1.ResourceQuota, error)) *StartQueue {
+	return &StartQueue{
+		instance: instance,
+		session:  session,
+		maxWait:  maxWait,
+		running:  running,
+		quotas:   quotas,
+		starting: map[string]*queueEntry{},
+		kick:     make(chan struct{}, 1),
+	}
+}
+
+// Wait will wait until the given container can be started within the
+// configured limits. The notify function is called with the (1 based)
+// position in the queue whenever that position changes. It will return a
+// release function that should be called when the container has been
+// started, or failed to start. If the container will never fit, or has
+// been waiting longer than the max wait time, an error is returned.
+func (q *StartQueue) Wait(tainr *types.Container, notify func(int)) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+
+	req, err := q.getRequest(tainr)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.checkNeverFits(req); err != nil {
+		return nil, err
+	}
+
+	e := &queueEntry{id: tainr.ID, session: tainr.GetSessionID(), req: req, ready: make(chan struct{}), moved: make(chan struct{}, 1)}
+	release := func() {
+		q.mu.Lock()
+		delete(q.starting, e.id)
+		q.mu.Unlock()
+		q.trigger()
+	}
+
+	running := q.running()
+	q.mu.Lock()
+	q.waiting = append(q.waiting, e)
+	q.dispatch(running)
+	pos := q.position(e)
+	if pos >= 0 && !q.dispatching {
+		q.dispatching = true
+		go q.dispatcher()
+	}
+	q.mu.Unlock()
+	if pos < 0 {
+		return release, nil
+	}
+	notify(pos + 1)
+
+	timeout := time.NewTimer(q.maxWait)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-e.ready:
+			return release, nil
+		case <-timeout.C:
+			q.mu.Lock()
+			pos := q.position(e)
+			if pos >= 0 {
+				q.waiting = append(q.waiting[:pos], q.waiting[pos+1:]...)
+				q.notifyMoved()
+			}
+			q.mu.Unlock()
+			if pos < 0 {
+				return release, nil
+			}
+			return nil, fmt.Errorf("container %s could not be started within %s, still at position %d in the start queue", tainr.ShortID, q.maxWait, pos+1)
+		case <-e.moved:
+			q.mu.Lock()
+			p := q.position(e)
+			q.mu.Unlock()
+			if p >= 0 && p != pos {
+				pos = p
+				notify(pos + 1)
+			}
+		}
+	}
+}
+
+// dispatcher will admit waiting containers every poll interval, or when a
+// started container is released, until the queue is empty. A single
+// dispatcher is running for the whole queue, so the running containers are
+// retrieved once per interval, regardless of the number of waiting
+// containers.
+func (q *StartQueue) dispatcher() {
+	tick := time.NewTicker(QueuePollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-q.kick:
+		}
+		running := q.running()
+		q.mu.Lock()
+		q.dispatch(running)
+		if len(q.waiting) == 0 {
+			q.dispatching = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+	}
+}
+
+// trigger will make the dispatcher admit waiting containers right away,
+// rather than at the next poll interval.
+func (q *StartQueue) trigger() {
+	select {
+	case q.kick <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch will admit all waiting containers that fit within the limits,
+// given the running containers, in the order they were queued. To prevent
+// starvation of containers with large requests, it will stop at the first
+// container that doesn't fit in the instance limits. Containers that only
+// exceed their session limits are skipped, so other sessions are not
+// blocked. Should be called while holding the lock.
+func (q *StartQueue) dispatch(running []*types.Container) {
+	if len(q.waiting) == 0 {
+		return
+	}
+	total, sessions := q.getUsage(running)
+	admitted := false
+	for i := 0; i < len(q.waiting); {
+		e := q.waiting[i]
+		if !q.instance.fits(total, e.req) {
+			break
+		}
+		if e.session != "" && !q.session.fits(sessions[e.session], e.req) {
+			i++
+			continue
+		}
+		q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+		q.starting[e.id] = e
+		total.add(e.req)
+		su := sessions[e.session]
+		su.add(e.req)
+		sessions[e.session] = su
+		close(e.ready)
+		admitted = true
+	}
+	if admitted {
+		q.notifyMoved()
+	}
+}
+
+// notifyMoved will signal all waiting containers that their position in
+// the queue may have changed. Should be called while holding the lock.
+func (q *StartQueue) notifyMoved() {
+	for _, e := range q.waiting {
+		select {
+		case e.moved <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// position will return the position of the given entry in the queue, or -1
+// if it's not waiting. Should be called while holding the lock.
+func (q *StartQueue) position(e *queueEntry) int {
+	for i, w := range q.waiting {
+		if w == e {
+			return i
+		}
+	}
+	return -1
+}
+
+// getUsage will return the total usage of the given running and the
+// starting containers, and the usage per session. Should be called while
+// holding the lock.
+func (q *StartQueue) getUsage(running []*types.Container) (usage, map[string]usage) {
+	total := usage{}
+	sessions := map[string]usage{}
+	add := func(session string, req usage) {
+		total.add(req)
+		su := sessions[session]
+		su.add(req)
+		sessions[session] = su
+	}
+	for _, e := range q.starting {
+		add(e.session, e.req)
+	}
+	for _, tainr := range running {
+		if _, ok := q.starting[tainr.ID]; ok {
+			continue
+		}
+		req, err := q.getRequest(tainr)
+		if err != nil {
+			klog.Warningf("ignoring requests of container %s: %s", tainr.ShortID, err)
+			req = usage{containers: 1}
+		}
+		add(tainr.GetSessionID(), req)
+	}
+	return total, sessions
+}
+
+// getRequest will return the requested resources of the given container.
+func (q *StartQueue) getRequest(tainr *types.Container) (usage, error) {
+	req := usage{containers: 1}
+	res, err := tainr.GetResourceRequirements()
+	if err != nil {
+		return req, err
+	}
+	req.cpu = res.Requests[corev1.ResourceCPU]
+	req.memory = res.Requests[corev1.ResourceMemory]
+	return req, nil
+}
+
+// checkNeverFits will return an error if the given request exceeds any of
+// the configured limits, or any of the resource quotas in the namespace,
+// which means the container will never be started.
+func (q *StartQueue) checkNeverFits(req usage) error {
+	for _, l := range []struct {
+		name string
+		lim  Limits
+	}{{"instance", q.instance}, {"session", q.session}} {
+		if !l.lim.fits(usage{}, req) {
+			return fmt.Errorf("container requests (cpu=%s, memory=%s) exceed the %s limits (containers=%d, cpu=%s, memory=%s)",
+				req.cpu.String(), req.memory.String(), l.name, l.lim.Containers, l.lim.CPU.String(), l.lim.Memory.String())
+		}
+	}
+
+	if q.quotas == nil {
+		return nil
+	}
+	quotas, err := q.quotas()
+	if err != nil {
+		klog.Warningf("error reading resource quotas: %s", err)
+		return nil
+	}
+	for _, quota := range quotas {
+		for _, r := range []struct {
+			names []corev1.ResourceName
+			val   resource.Quantity
+		}{
+			{[]corev1.ResourceName{corev1.ResourceRequestsCPU, corev1.ResourceCPU}, req.cpu},
+			{[]corev1.ResourceName{corev1.ResourceRequestsMemory, corev1.ResourceMemory}, req.memory},
+		} {
+			for _, name := range r.names {
+				hard, ok := quota.Status.Hard[name]
+				if !ok {
+					hard, ok = quota.Spec.Hard[name]
+				}
+				if ok && r.val.Cmp(hard) > 0 {
+					return fmt.Errorf("container requests %s %s, which exceeds the hard limit of %s in resource quota %s", name, r.val.String(), hard.String(), quota.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
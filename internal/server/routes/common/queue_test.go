@@ -0,0 +1,204 @@
+package common
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		containers int
+		cpu        string
+		memory     string
+		zero       bool
+		err        bool
+	}{
+		{zero: true},
+		{containers: 10},
+		{cpu: "2", memory: "4Gi"},
+		{containers: -1, err: true},
+		{cpu: "lots", err: true},
+	}
+	for i, tst := range tests {
+		lim, err := ParseLimits(tst.containers, tst.cpu, tst.memory)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err == nil && lim.IsZero() != tst.zero {
+			t.Errorf("failed test %d - expected zero %t, but got %t", i, tst.zero, lim.IsZero())
+		}
+	}
+}
+
+func TestStartQueueNeverFits(t *testing.T) {
+	quota := corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute"},
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+			corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+		}},
+	}
+	tests := []struct {
+		instance Limits
+		session  Limits
+		labels   map[string]string
+		err      bool
+	}{
+		{instance: Limits{Containers: 1}},
+		{instance: Limits{CPU: resource.MustParse("2")}, labels: map[string]string{types.LabelRequestCPU: "1"}},
+		{instance: Limits{CPU: resource.MustParse("2")}, labels: map[string]string{types.LabelRequestCPU: "3"}, err: true},
+		{session: Limits{Memory: resource.MustParse("512Mi")}, labels: map[string]string{types.LabelRequestMemory: "1Gi"}, err: true},
+		{instance: Limits{Containers: 1}, labels: map[string]string{types.LabelRequestMemory: "2Gi"}, err: true},
+		{instance: Limits{Containers: 1}, labels: map[string]string{types.LabelRequestMemory: "invalid"}, err: true},
+	}
+	for i, tst := range tests {
+		q := NewStartQueue(tst.instance, tst.session, time.Second, func() []*types.Container { return nil },
+			func() ([]corev1.ResourceQuota, error) { return []corev1.ResourceQuota{quota}, nil })
+		release, err := q.Wait(&types.Container{ID: "tb303", Labels: tst.labels}, func(int) {})
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err == nil {
+			release()
+		}
+	}
+}
+
+func TestStartQueue(t *testing.T) {
+	QueuePollInterval = 10 * time.Millisecond
+
+	mu := sync.Mutex{}
+	running := []*types.Container{}
+	setRunning := func(tainrs ...*types.Container) {
+		mu.Lock()
+		defer mu.Unlock()
+		running = tainrs
+	}
+
+	q := NewStartQueue(Limits{Containers: 2}, Limits{Containers: 1}, time.Second, func() []*types.Container {
+		mu.Lock()
+		defer mu.Unlock()
+		return running
+	}, nil)
+
+	session := func(id string) map[string]string {
+		return map[string]string{types.LabelSession: id}
+	}
+	a := &types.Container{ID: "a", ShortID: "a", Labels: session("1")}
+	b := &types.Container{ID: "b", ShortID: "b", Labels: session("1")}
+	c := &types.Container{ID: "c", ShortID: "c", Labels: session("2")}
+
+	// a starts immediately and is running afterwards
+	release, err := q.Wait(a, func(int) { t.Errorf("unexpected queueing of a") })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	setRunning(a)
+	release()
+
+	// b is in the same session as a, and has to wait; c is in another
+	// session and can start while b is waiting
+	positions := make(chan int, 10)
+	done := make(chan error, 1)
+	go func() {
+		release, err := q.Wait(b, func(pos int) { positions <- pos })
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	if pos := <-positions; pos != 1 {
+		t.Errorf("expected position 1, but got %d", pos)
+	}
+
+	release, err = q.Wait(c, func(int) { t.Errorf("unexpected queueing of c") })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	setRunning(a, c)
+	release()
+
+	// b still can't start, as a is running
+	select {
+	case err := <-done:
+		t.Fatalf("unexpected start of b: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a is done, b can start
+	setRunning(c)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for b to start")
+	}
+
+	// the max wait time is exceeded
+	q.maxWait = 50 * time.Millisecond
+	setRunning(a, c)
+	if _, err := q.Wait(b, func(int) {}); err == nil {
+		t.Errorf("expected timeout error, but succeeded without error")
+	}
+	if len(q.waiting) != 0 || len(q.starting) != 0 {
+		t.Errorf("expected empty queue, but got %d waiting and %d starting", len(q.waiting), len(q.starting))
+	}
+}
+
+func TestStartQueueNil(t *testing.T) {
+	var q *StartQueue
+	release, err := q.Wait(&types.Container{}, func(int) {})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	release()
+}
+
+func TestStartQueueDispatcher(t *testing.T) {
+	QueuePollInterval = 10 * time.Millisecond
+
+	mu := sync.Mutex{}
+	calls := 0
+	busy := &types.Container{ID: "busy", ShortID: "busy"}
+	q := NewStartQueue(Limits{Containers: 1}, Limits{}, 100*time.Millisecond, func() []*types.Container {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return []*types.Container{busy}
+	}, nil)
+
+	waiters := 5
+	wg := sync.WaitGroup{}
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if _, err := q.Wait(&types.Container{ID: id, ShortID: id}, func(int) {}); err == nil {
+				t.Errorf("expected timeout error for %s, but succeeded without error", id)
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+
+	// one call per waiter when queued, and one per poll interval for the
+	// whole queue; polling per waiter would result in waiters*10 calls
+	mu.Lock()
+	defer mu.Unlock()
+	if max := waiters + 2*int(q.maxWait/QueuePollInterval); calls > max {
+		t.Errorf("expected at most %d calls to running, but got %d", max, calls)
+	}
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/server/httputil"
+)
+
+// ReaperDryRun - list all resources that would be deleted by the reaper, or
+// when pruning all kubedock resources if all=true, without deleting them.
+// GET "/kubedock/reaper"
+func ReaperDryRun(cr *ContextRouter, c *gin.Context) {
+	all, _ := strconv.ParseBool(c.Query("all"))
+	var res []backend.Candidate
+	var err error
+	if all {
+		res, err = cr.Backend.DeleteAllDryRun()
+	} else {
+		if cr.Config.Reaper == nil {
+			httputil.Error(c, http.StatusServiceUnavailable, fmt.Errorf("reaper is not running"))
+			return
+		}
+		res, err = cr.Config.Reaper.DryRun()
+	}
+	if err != nil {
+		httputil.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
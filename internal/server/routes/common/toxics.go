@@ -0,0 +1,82 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/joyrex2001/kubedock/internal/model/types"
+	"github.com/joyrex2001/kubedock/internal/server/httputil"
+	"github.com/joyrex2001/kubedock/internal/util/reverseproxy"
+)
+
+// ContainerToxics - list the toxics that are injected by the reverse-proxy
+// for the given container, by container port (where port 0 applies to all
+// ports).
+// GET "/kubedock/containers/:id/toxics"
+func ContainerToxics(cr *ContextRouter, c *gin.Context) {
+	tainr, err := cr.DB.GetContainerByNameOrID(c.Param("id"))
+	if err != nil {
+		httputil.Error(c, http.StatusNotFound, err)
+		return
+	}
+	res := map[int]reverseproxy.Toxics{}
+	for port, tx := range tainr.GetAllToxics() {
+		res[port] = reverseproxy.Toxics(tx)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// ContainerToxicsUpdate - set the toxics that are injected by the
+// reverse-proxy for the given container port, or all ports if port is 0.
+// The toxics are applied to open connections as well.
+// PUT "/kubedock/containers/:id/toxics/:port"
+func ContainerToxicsUpdate(cr *ContextRouter, c *gin.Context) {
+	tainr, err := cr.DB.GetContainerByNameOrID(c.Param("id"))
+	if err != nil {
+		httputil.Error(c, http.StatusNotFound, err)
+		return
+	}
+	port, err := getToxicsPort(c)
+	if err != nil {
+		httputil.Error(c, http.StatusBadRequest, err)
+		return
+	}
+	tx := reverseproxy.Toxics{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&tx); err != nil {
+		httputil.Error(c, http.StatusBadRequest, err)
+		return
+	}
+	tainr.SetToxics(port, types.Toxics(tx))
+	c.JSON(http.StatusOK, tx)
+}
+
+// ContainerToxicsDelete - remove the toxics for the given container port,
+// or the toxics for all ports if port is 0.
+// DELETE "/kubedock/containers/:id/toxics/:port"
+func ContainerToxicsDelete(cr *ContextRouter, c *gin.Context) {
+	tainr, err := cr.DB.GetContainerByNameOrID(c.Param("id"))
+	if err != nil {
+		httputil.Error(c, http.StatusNotFound, err)
+		return
+	}
+	port, err := getToxicsPort(c)
+	if err != nil {
+		httputil.Error(c, http.StatusBadRequest, err)
+		return
+	}
+	tainr.SetToxics(port, types.Toxics{})
+	c.Writer.WriteHeader(http.StatusNoContent)
+}
+
+// getToxicsPort will return the container port as given in the request.
+func getToxicsPort(c *gin.Context) (int, error) {
+	port, err := strconv.Atoi(c.Param("port"))
+	if err != nil || port < 0 {
+		return 0, fmt.Errorf("invalid port %s", c.Param("port"))
+	}
+	return port, nil
+}
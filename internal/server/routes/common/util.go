@@ -1,17 +1,30 @@
 package common
 
 import (
+	"strconv"
 	"time"
 
 	"k8s.io/klog"
 
 	"github.com/joyrex2001/kubedock/internal/backend"
+	"github.com/joyrex2001/kubedock/internal/events"
 	"github.com/joyrex2001/kubedock/internal/model/types"
 )
 
 // StartContainer will start given container and saves the appropriate state
 // in the database.
 func StartContainer(cr *ContextRouter, tainr *types.Container) error {
+	release, err := cr.Queue.Wait(tainr, func(pos int) {
+		klog.Infof("container %s is waiting in the start queue at position %d", tainr.ShortID, pos)
+		cr.Events.PublishWithAttributes(tainr.ID, events.Container, events.Queue, map[string]string{
+			"position": strconv.Itoa(pos),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	state, err := cr.Backend.StartContainer(tainr)
 	if err != nil {
 		return err
@@ -21,7 +34,7 @@ func StartContainer(cr *ContextRouter, tainr *types.Container) error {
 	if cr.Config.PortForward {
 		cr.Backend.CreatePortForwards(tainr)
 	} else {
-		if len(tainr.GetServicePorts()) > 0 {
+		if len(tainr.GetServicePorts()) > 0 || tainr.HasHeadlessServices() {
 			ip, err := cr.Backend.GetPodIP(tainr)
 			if err != nil {
 				return err
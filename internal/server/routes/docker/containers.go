@@ -26,6 +26,11 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 		return
 	}
 
+	if err := cr.Config.ImagePolicy.Check(in.Image); err != nil {
+		httputil.Error(c, http.StatusForbidden, err)
+		return
+	}
+
 	if in.Name == "" {
 		in.Name = c.Query("name")
 	}
@@ -50,6 +55,9 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 	if _, ok := in.Labels[types.LabelPullPolicy]; !ok && cr.Config.PullPolicy != "" {
 		in.Labels[types.LabelPullPolicy] = cr.Config.PullPolicy
 	}
+	if _, ok := in.Labels[types.LabelNetworkAffinity]; !ok && cr.Config.NetworkAffinity != "" {
+		in.Labels[types.LabelNetworkAffinity] = cr.Config.NetworkAffinity
+	}
 	if in.HostConfig.Memory != 0 {
 		in.Labels[types.LabelRequestMemory] = fmt.Sprintf("%d", in.HostConfig.Memory)
 	}
@@ -59,16 +67,32 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 	in.Labels[types.LabelServiceAccount] = cr.Config.ServiceAccount
 
 	tainr := &types.Container{
-		Name:         in.Name,
-		Image:        in.Image,
-		Entrypoint:   in.Entrypoint,
-		Cmd:          in.Cmd,
-		Env:          in.Env,
-		ExposedPorts: in.ExposedPorts,
-		ImagePorts:   map[string]interface{}{},
-		Labels:       in.Labels,
-		Binds:        in.HostConfig.Binds,
-		PreArchives:  []types.PreArchive{},
+		Name:           in.Name,
+		Image:          in.Image,
+		Platform:       c.Query("platform"),
+		Entrypoint:     in.Entrypoint,
+		Cmd:            in.Cmd,
+		Env:            in.Env,
+		WorkingDir:     in.WorkingDir,
+		Hostname:       in.Hostname,
+		Domainname:     in.Domainname,
+		DNS:            in.HostConfig.DNS,
+		DNSSearch:      in.HostConfig.DNSSearch,
+		DNSOptions:     in.HostConfig.DNSOptions,
+		ExposedPorts:   in.ExposedPorts,
+		ImagePorts:     map[string]interface{}{},
+		Labels:         in.Labels,
+		Binds:          in.HostConfig.Binds,
+		Privileged:     in.HostConfig.Privileged,
+		CapAdd:         in.HostConfig.CapAdd,
+		CapDrop:        in.HostConfig.CapDrop,
+		ReadOnlyRootfs: in.HostConfig.ReadonlyRootfs,
+		SecurityOpt:    in.HostConfig.SecurityOpt,
+		GroupAdd:       in.HostConfig.GroupAdd,
+		Sysctls:        in.HostConfig.Sysctls,
+		Tmpfs:          in.HostConfig.Tmpfs,
+		ShmSize:        in.HostConfig.ShmSize,
+		PreArchives:    []types.PreArchive{},
 	}
 
 	if img, err := cr.DB.GetImageByNameOrID(in.Image); err != nil {
@@ -109,6 +133,11 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 		tainr.ConnectNetwork(netw.ID)
 	}
 
+	if err := cr.Backend.ValidateContainer(tainr); err != nil {
+		httputil.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
 	if err := cr.DB.SaveContainer(tainr); err != nil {
 		httputil.Error(c, http.StatusInternalServerError, err)
 		return
@@ -170,6 +199,8 @@ func ContainerDelete(cr *common.ContextRouter, c *gin.Context) {
 		return
 	}
 
+	cr.Events.Publish(tainr.ID, events.Container, events.Destroy)
+
 	c.Writer.WriteHeader(http.StatusNoContent)
 }
 
@@ -183,6 +214,7 @@ func ContainerInfo(cr *common.ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 	c.JSON(http.StatusOK, getContainerInfo(cr, tainr, true))
 }
 
@@ -246,7 +278,7 @@ func getContainerInfo(cr *common.ContextRouter, tainr *types.Container, detail b
 		netdtl[netw.Name] = gin.H{
 			"NetworkID": netw.ID,
 			"Aliases":   tainr.NetworkAliases,
-			"IPAddress": "127.0.0.1",
+			"IPAddress": getNetworkIPAddress(tainr),
 		}
 	}
 	res := gin.H{
@@ -265,6 +297,18 @@ func getContainerInfo(cr *common.ContextRouter, tainr *types.Container, detail b
 				"Type":   "json-file",
 				"Config": gin.H{},
 			},
+			"Privileged":     tainr.Privileged,
+			"CapAdd":         tainr.CapAdd,
+			"CapDrop":        tainr.CapDrop,
+			"ReadonlyRootfs": tainr.ReadOnlyRootfs,
+			"SecurityOpt":    tainr.SecurityOpt,
+			"GroupAdd":       tainr.GroupAdd,
+			"Sysctls":        tainr.Sysctls,
+			"Tmpfs":          tainr.Tmpfs,
+			"ShmSize":        tainr.ShmSize,
+			"Dns":            tainr.DNS,
+			"DnsSearch":      tainr.DNSSearch,
+			"DnsOptions":     tainr.DNSOptions,
 		},
 	}
 	if detail {
@@ -285,13 +329,19 @@ func getContainerInfo(cr *common.ContextRouter, tainr *types.Container, detail b
 			"Error":      errstr,
 		}
 		res["Config"] = gin.H{
-			"Image":  tainr.Image,
-			"Labels": tainr.Labels,
-			"Env":    tainr.Env,
-			"Cmd":    tainr.Cmd,
-			"Tty":    false,
+			"Image":      tainr.Image,
+			"Labels":     tainr.Labels,
+			"Env":        tainr.Env,
+			"Cmd":        tainr.Cmd,
+			"WorkingDir": tainr.WorkingDir,
+			"Hostname":   tainr.Hostname,
+			"Domainname": tainr.Domainname,
+			"Tty":        false,
 		}
 		res["Created"] = tainr.Created.Format("2006-01-02T15:04:05Z")
+		if pfs := tainr.GetPortForwardStatus(); len(pfs) > 0 {
+			res["PortForwards"] = pfs
+		}
 	} else {
 		res["Labels"] = tainr.Labels
 		res["State"] = tainr.StatusString()
@@ -318,7 +368,7 @@ func getNetworkSettingsPorts(cr *common.ContextRouter, tainr *types.Container) g
 				continue
 			}
 			pp = append(pp, map[string]string{
-				"HostIp":   tainr.HostIP,
+				"HostIp":   tainr.GetHostIP(dst),
 				"HostPort": fmt.Sprintf("%d", src),
 			})
 			done[src] = 1
@@ -343,7 +393,7 @@ func getContainerPorts(cr *common.ContextRouter, tainr *types.Container) []map[s
 				continue
 			}
 			pp := map[string]interface{}{
-				"IP":          tainr.HostIP,
+				"IP":          tainr.GetHostIP(dst),
 				"PrivatePort": dst,
 				"Type":        "tcp",
 			}
@@ -358,9 +408,16 @@ func getContainerPorts(cr *common.ContextRouter, tainr *types.Container) []map[s
 }
 
 // getAvailablePorts will return all ports that are currently available on
-// the running container.
+// the running container. If the container is exposed outside the cluster,
+// the external ports are returned instead.
 func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container) map[int][]int {
 	ports := map[int][]int{}
+	if len(tainr.ExternalPorts) > 0 {
+		for dst, ext := range tainr.ExternalPorts {
+			ports[dst] = []int{ext.Port}
+		}
+		return ports
+	}
 	add := func(prts map[int]int) {
 		for src, dst := range prts {
 			if src < 0 {
@@ -381,6 +438,16 @@ func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container) map[int
 	return ports
 }
 
+// getNetworkIPAddress will return the ip address of the container within
+// its networks. If the network aliases are backed by headless services, the
+// aliases resolve to the pod ip directly, otherwise 127.0.0.1 is returned.
+func getNetworkIPAddress(tainr *types.Container) string {
+	if tainr.HasHeadlessServices() && tainr.HostIP != "" {
+		return tainr.HostIP
+	}
+	return "127.0.0.1"
+}
+
 // getContainerNames will list of possible names to identify the container.
 func getContainerNames(tainr *types.Container) []string {
 	names := []string{}
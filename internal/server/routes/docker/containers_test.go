@@ -181,3 +181,21 @@ func TestGetContainerNames(t *testing.T) {
 		}
 	}
 }
+
+func TestGetNetworkIPAddress(t *testing.T) {
+	tests := []struct {
+		tainr *types.Container
+		out   string
+	}{
+		{tainr: &types.Container{}, out: "127.0.0.1"},
+		{tainr: &types.Container{HostIP: "10.0.0.1", ExposedPorts: map[string]interface{}{"303/tcp": 0}}, out: "127.0.0.1"},
+		{tainr: &types.Container{HostIP: "10.0.0.1", NetworkAliases: []string{"tb303"}, ExposedPorts: map[string]interface{}{"303/tcp": 0}}, out: "127.0.0.1"},
+		{tainr: &types.Container{NetworkAliases: []string{"tb303"}}, out: "127.0.0.1"},
+		{tainr: &types.Container{HostIP: "10.0.0.1", NetworkAliases: []string{"tb303"}}, out: "10.0.0.1"},
+	}
+	for i, tst := range tests {
+		if res := getNetworkIPAddress(tst.tainr); res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+	}
+}
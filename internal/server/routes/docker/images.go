@@ -20,6 +20,10 @@ func ImageCreate(cr *common.ContextRouter, c *gin.Context) {
 	if tag != "" {
 		from = from + ":" + tag
 	}
+	if err := cr.Config.ImagePolicy.Check(from); err != nil {
+		httputil.Error(c, http.StatusForbidden, err)
+		return
+	}
 	img := &types.Image{Name: from}
 	if cr.Config.Inspector {
 		pts, err := cr.Backend.GetImageExposedPorts(from)
@@ -86,7 +86,8 @@ func Events(cr *common.ContextRouter, c *gin.Context) {
 					"Status": msg.Action,
 					"Action": msg.Action,
 					"Actor": gin.H{
-						"ID": msg.ID,
+						"ID":         msg.ID,
+						"Attributes": msg.Attributes,
 					},
 					"scope":    "local",
 					"time":     msg.Time,
@@ -11,6 +11,9 @@ type ContainerCreateRequest struct {
 	Cmd           []string               `json:"Cmd"`
 	Env           []string               `json:"Env"`
 	User          string                 `json:"User"`
+	WorkingDir    string                 `json:"WorkingDir"`
+	Hostname      string                 `json:"Hostname"`
+	Domainname    string                 `json:"Domainname"`
 	HostConfig    HostConfig             `json:"HostConfig"`
 	NetworkConfig NetworkingConfig       `json:"NetworkingConfig"`
 }
@@ -35,12 +38,25 @@ type NetworkDisconnectRequest struct {
 	Container string `json:"container"`
 }
 
-// HostConfig contains to be mounted files from the host system.
+// HostConfig contains to be mounted files from the host system, resource
+// and security settings.
 type HostConfig struct {
-	Binds        []string `json:"Binds"`
-	PortBindings map[string][]PortBinding
-	Memory       int `json:"Memory"`
-	NanoCpus     int `json:"NanoCpus"`
+	Binds          []string `json:"Binds"`
+	PortBindings   map[string][]PortBinding
+	Memory         int               `json:"Memory"`
+	NanoCpus       int               `json:"NanoCpus"`
+	Privileged     bool              `json:"Privileged"`
+	CapAdd         []string          `json:"CapAdd"`
+	CapDrop        []string          `json:"CapDrop"`
+	ReadonlyRootfs bool              `json:"ReadonlyRootfs"`
+	SecurityOpt    []string          `json:"SecurityOpt"`
+	GroupAdd       []string          `json:"GroupAdd"`
+	Sysctls        map[string]string `json:"Sysctls"`
+	Tmpfs          map[string]string `json:"Tmpfs"`
+	ShmSize        int64             `json:"ShmSize"`
+	DNS            []string          `json:"Dns"`
+	DNSSearch      []string          `json:"DnsSearch"`
+	DNSOptions     []string          `json:"DnsOptions"`
 }
 
 // PortBinding represents a binding between to a port
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/joyrex2001/kubedock/internal/server/routes/common"
+)
+
+// RegisterKubedockRoutes will add all kubedock specific admin routes.
+func RegisterKubedockRoutes(router *gin.Engine, cr *common.ContextRouter) {
+	wrap := func(fn func(*common.ContextRouter, *gin.Context)) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			fn(cr, c)
+		}
+	}
+
+	router.GET("/kubedock/reaper", wrap(common.ReaperDryRun))
+	router.GET("/kubedock/containers/:id/toxics", wrap(common.ContainerToxics))
+	router.PUT("/kubedock/containers/:id/toxics/:port", wrap(common.ContainerToxicsUpdate))
+	router.DELETE("/kubedock/containers/:id/toxics/:port", wrap(common.ContainerToxicsDelete))
+	router.GET("/kubedock/captures", wrap(common.CaptureList))
+	router.GET("/kubedock/captures/:name", wrap(common.CaptureDownload))
+}
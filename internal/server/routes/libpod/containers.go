@@ -27,6 +27,11 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 		return
 	}
 
+	if err := cr.Config.ImagePolicy.Check(in.Image); err != nil {
+		httputil.Error(c, http.StatusForbidden, err)
+		return
+	}
+
 	if in.Name == "" {
 		in.Name = c.Query("name")
 	}
@@ -51,18 +56,42 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 	if _, ok := in.Labels[types.LabelPullPolicy]; !ok && cr.Config.PullPolicy != "" {
 		in.Labels[types.LabelPullPolicy] = cr.Config.PullPolicy
 	}
+	if _, ok := in.Labels[types.LabelNetworkAffinity]; !ok && cr.Config.NetworkAffinity != "" {
+		in.Labels[types.LabelNetworkAffinity] = cr.Config.NetworkAffinity
+	}
 	in.Labels[types.LabelServiceAccount] = cr.Config.ServiceAccount
 
 	tainr := &types.Container{
-		Name:         in.Name,
-		Image:        in.Image,
-		Entrypoint:   in.Entrypoint,
-		Cmd:          in.Command,
-		Env:          in.Env,
-		Binds:        []string{},
-		ExposedPorts: map[string]interface{}{},
-		ImagePorts:   map[string]interface{}{},
-		Labels:       in.Labels,
+		Name:           in.Name,
+		Image:          in.Image,
+		Entrypoint:     in.Entrypoint,
+		Cmd:            in.Command,
+		Env:            in.Env,
+		WorkingDir:     in.WorkDir,
+		Hostname:       in.Hostname,
+		DNS:            in.DNSServer,
+		DNSSearch:      in.DNSSearch,
+		DNSOptions:     in.DNSOption,
+		Binds:          []string{},
+		ExposedPorts:   map[string]interface{}{},
+		ImagePorts:     map[string]interface{}{},
+		Labels:         in.Labels,
+		Privileged:     in.Privileged,
+		CapAdd:         in.CapAdd,
+		CapDrop:        in.CapDrop,
+		ReadOnlyRootfs: in.ReadOnlyFilesystem,
+		SecurityOpt:    []string{},
+		GroupAdd:       in.Groups,
+		Sysctls:        in.Sysctl,
+		Tmpfs:          map[string]string{},
+		ShmSize:        in.ShmSize,
+	}
+
+	if in.NoNewPrivileges {
+		tainr.SecurityOpt = append(tainr.SecurityOpt, "no-new-privileges")
+	}
+	if in.SeccompProfilePath != "" {
+		tainr.SecurityOpt = append(tainr.SecurityOpt, "seccomp="+in.SeccompProfilePath)
 	}
 
 	if img, err := cr.DB.GetImageByNameOrID(in.Image); err != nil {
@@ -86,6 +115,10 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 	addNetworkAliases(tainr, in.Network)
 
 	for _, mount := range in.Mounts {
+		if mount.Type == "tmpfs" {
+			tainr.Tmpfs[mount.Destination] = strings.Join(mount.Options, ",")
+			continue
+		}
 		tainr.Binds = append(tainr.Binds, mount.Source+":"+mount.Destination)
 	}
 
@@ -96,6 +129,11 @@ func ContainerCreate(cr *common.ContextRouter, c *gin.Context) {
 	}
 	tainr.ConnectNetwork(netw.ID)
 
+	if err := cr.Backend.ValidateContainer(tainr); err != nil {
+		httputil.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
 	if err := cr.DB.SaveContainer(tainr); err != nil {
 		httputil.Error(c, http.StatusInternalServerError, err)
 		return
@@ -161,6 +199,8 @@ func ContainerDelete(cr *common.ContextRouter, c *gin.Context) {
 		return
 	}
 
+	cr.Events.Publish(tainr.ID, events.Container, events.Destroy)
+
 	c.JSON(http.StatusOK, []gin.H{})
 }
 
@@ -187,6 +227,7 @@ func ContainerInfo(cr *common.ContextRouter, c *gin.Context) {
 		httputil.Error(c, http.StatusNotFound, err)
 		return
 	}
+	tainr.Touch()
 	c.JSON(http.StatusOK, getContainerInfo(cr, tainr, true))
 }
 
@@ -227,7 +268,7 @@ func getContainerInfo(cr *common.ContextRouter, tainr *types.Container, detail b
 		netdtl[netw.Name] = gin.H{
 			"NetworkID": netw.ID,
 			"Aliases":   tainr.NetworkAliases,
-			"IPAddress": "127.0.0.1",
+			"IPAddress": getNetworkIPAddress(tainr),
 		}
 	}
 	res := gin.H{
@@ -241,6 +282,9 @@ func getContainerInfo(cr *common.ContextRouter, tainr *types.Container, detail b
 		},
 		"HostConfig": gin.H{
 			"PortBindings": getNetworkSettingsPorts(cr, tainr),
+			"Dns":          tainr.DNS,
+			"DnsSearch":    tainr.DNSSearch,
+			"DnsOptions":   tainr.DNSOptions,
 		},
 		"Ports": getContainerInfoPorts(cr, tainr),
 		"Names": getContainerNames(tainr),
@@ -263,11 +307,16 @@ func getContainerInfo(cr *common.ContextRouter, tainr *types.Container, detail b
 			"Error":      errstr,
 		}
 		res["Config"] = gin.H{
-			"Image":  tainr.Image,
-			"Labels": tainr.Labels,
-			"Env":    tainr.Env,
-			"Cmd":    tainr.Cmd,
-			"Tty":    false,
+			"Image":      tainr.Image,
+			"Labels":     tainr.Labels,
+			"Env":        tainr.Env,
+			"Cmd":        tainr.Cmd,
+			"WorkingDir": tainr.WorkingDir,
+			"Hostname":   tainr.Hostname,
+			"Tty":        false,
+		}
+		if pfs := tainr.GetPortForwardStatus(); len(pfs) > 0 {
+			res["PortForwards"] = pfs
 		}
 	} else {
 		res["Created"] = tainr.Created.Format("2006-01-02T15:04:05Z")
@@ -278,6 +327,16 @@ func getContainerInfo(cr *common.ContextRouter, tainr *types.Container, detail b
 	return res
 }
 
+// getNetworkIPAddress will return the ip address of the container within
+// its networks. If the network aliases are backed by headless services, the
+// aliases resolve to the pod ip directly, otherwise 127.0.0.1 is returned.
+func getNetworkIPAddress(tainr *types.Container) string {
+	if tainr.HasHeadlessServices() && tainr.HostIP != "" {
+		return tainr.HostIP
+	}
+	return "127.0.0.1"
+}
+
 // getContainerNames will list of possible names to identify the container.
 func getContainerNames(tainr *types.Container) []string {
 	names := []string{}
@@ -310,7 +369,7 @@ func getNetworkSettingsPorts(cr *common.ContextRouter, tainr *types.Container) g
 				continue
 			}
 			pp = append(pp, map[string]string{
-				"HostIp":   tainr.HostIP,
+				"HostIp":   tainr.GetHostIP(dst),
 				"HostPort": fmt.Sprintf("%d", src),
 			})
 			done[src] = 1
@@ -335,7 +394,7 @@ func getContainerInfoPorts(cr *common.ContextRouter, tainr *types.Container) []m
 				continue
 			}
 			res = append(res, map[string]interface{}{
-				"host_ip":        tainr.HostIP,
+				"host_ip":        tainr.GetHostIP(dst),
 				"host_port":      src,
 				"container_port": dst,
 				"protocol":       "TCP",
@@ -347,9 +406,16 @@ func getContainerInfoPorts(cr *common.ContextRouter, tainr *types.Container) []m
 }
 
 // getAvailablePorts will return all ports that are currently available on
-// the running container.
+// the running container. If the container is exposed outside the cluster,
+// the external ports are returned instead.
 func getAvailablePorts(cr *common.ContextRouter, tainr *types.Container) map[int][]int {
 	ports := map[int][]int{}
+	if len(tainr.ExternalPorts) > 0 {
+		for dst, ext := range tainr.ExternalPorts {
+			ports[dst] = []int{ext.Port}
+		}
+		return ports
+	}
 	add := func(prts map[int]int) {
 		for src, dst := range prts {
 			if src < 0 {
@@ -16,6 +16,10 @@ import (
 // POST "/libpod/images/pull"
 func ImagePull(cr *common.ContextRouter, c *gin.Context) {
 	from := c.Query("reference")
+	if err := cr.Config.ImagePolicy.Check(from); err != nil {
+		httputil.Error(c, http.StatusForbidden, err)
+		return
+	}
 	img := &types.Image{Name: from}
 	if cr.Config.Inspector {
 		pts, err := cr.Backend.GetImageExposedPorts(from)
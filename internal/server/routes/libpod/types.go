@@ -3,16 +3,30 @@ package libpod
 // ContainerCreateRequest represents the json structure that
 // is used for the /libpod/container/create post endpoint.
 type ContainerCreateRequest struct {
-	Name         string                      `json:"name"`
-	Image        string                      `json:"image"`
-	Labels       map[string]string           `json:"Labels"`
-	Entrypoint   []string                    `json:"Entrypoint"`
-	Command      []string                    `json:"Command"`
-	Env          []string                    `json:"Env"`
-	User         string                      `json:"User"`
-	PortMappings []PortMapping               `json:"portmappings"`
-	Network      map[string]NetworksProperty `json:"Networks"`
-	Mounts       []Mount                     `json:"mounts"`
+	Name               string                      `json:"name"`
+	Image              string                      `json:"image"`
+	Labels             map[string]string           `json:"Labels"`
+	Entrypoint         []string                    `json:"Entrypoint"`
+	Command            []string                    `json:"Command"`
+	Env                []string                    `json:"Env"`
+	User               string                      `json:"User"`
+	PortMappings       []PortMapping               `json:"portmappings"`
+	Network            map[string]NetworksProperty `json:"Networks"`
+	Mounts             []Mount                     `json:"mounts"`
+	Privileged         bool                        `json:"privileged"`
+	CapAdd             []string                    `json:"cap_add"`
+	CapDrop            []string                    `json:"cap_drop"`
+	ReadOnlyFilesystem bool                        `json:"read_only_filesystem"`
+	NoNewPrivileges    bool                        `json:"no_new_privileges"`
+	SeccompProfilePath string                      `json:"seccomp_profile_path"`
+	Groups             []string                    `json:"groups"`
+	Sysctl             map[string]string           `json:"sysctl"`
+	ShmSize            int64                       `json:"shm_size"`
+	WorkDir            string                      `json:"work_dir"`
+	Hostname           string                      `json:"hostname"`
+	DNSServer          []string                    `json:"dns_server"`
+	DNSSearch          []string                    `json:"dns_search"`
+	DNSOption          []string                    `json:"dns_option"`
 }
 
 // PortMapping describes how to map a port into the container.
@@ -31,7 +45,8 @@ type NetworksProperty struct {
 
 // Mount describes how volumes should be mounted.
 type Mount struct {
-	Source      string `json:"source"`
-	Destination string `json:"destination"`
-	Type        string `json:"type"`
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Options     []string `json:"options"`
 }
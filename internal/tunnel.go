@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/viper"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joyrex2001/kubedock/internal/config"
+	"github.com/joyrex2001/kubedock/internal/tunnel"
+)
+
+// Tunnel will connect to a kubedock instance running in the configured
+// namespace, and serves its api and container ports locally until the
+// process is signalled to stop.
+func Tunnel(cfg tunnel.Config) error {
+	rcfg, err := config.GetKubernetes()
+	if err != nil {
+		return fmt.Errorf("error instantiating kubernetes client: %w", err)
+	}
+
+	cli, err := kubernetes.NewForConfig(rcfg)
+	if err != nil {
+		return fmt.Errorf("error instantiating kubernetes client: %w", err)
+	}
+
+	cfg.RestConfig = rcfg
+	cfg.Client = cli
+	cfg.Namespace = viper.GetString("kubernetes.namespace")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+	return tunnel.New(cfg).Run(ctx)
+}
@@ -0,0 +1,190 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// event is the relevant part of a docker api event.
+type event struct {
+	ID     string `json:"id"`
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+}
+
+// container is the relevant part of a docker api container inspect.
+type container struct {
+	ID              string `json:"Id"`
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+// watch will bind local ports for the ports of all running containers, and
+// will keep these in sync by watching the container events, until the
+// given context is done.
+func (t *Tunnel) watch(ctx context.Context) {
+	cli := &http.Client{Transport: &http.Transport{
+		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+			return t.dial(t.cfg.RemotePort)
+		},
+	}}
+	for {
+		if err := t.sync(ctx, cli); err != nil && ctx.Err() == nil {
+			klog.Warningf("error watching container events: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(MinBackoff):
+		}
+	}
+}
+
+// sync will bind the ports of all running containers, and unbinds the
+// ports of containers that are no longer running (e.g. when these were
+// removed while the tunnel was disconnected). Afterwards, it processes the
+// container events until the event stream is closed.
+func (t *Tunnel) sync(ctx context.Context, cli *http.Client) error {
+	ids := []struct {
+		ID string `json:"Id"`
+	}{}
+	if err := apiGet(ctx, cli, "/containers/json", &ids); err != nil {
+		return err
+	}
+	running := map[string]bool{}
+	for _, id := range ids {
+		running[id.ID] = true
+		t.bind(ctx, cli, id.ID)
+	}
+	for _, id := range t.bound() {
+		if !running[id] {
+			t.unbind(id)
+		}
+	}
+
+	filters := url.QueryEscape(`{"type":["container"]}`)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://kubedock/events?filters="+filters, nil)
+	if err != nil {
+		return err
+	}
+	res, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		ev := event{}
+		if err := dec.Decode(&ev); err != nil {
+			return err
+		}
+		if ev.Type != "container" {
+			continue
+		}
+		switch ev.Action {
+		case "start":
+			t.bind(ctx, cli, ev.ID)
+		case "die", "destroy":
+			t.unbind(ev.ID)
+		}
+	}
+}
+
+// bind will listen to the local host ports of given container, and will
+// forward these to the same ports of the kubedock pod, which are served by
+// the reverse-proxy of kubedock.
+func (t *Tunnel) bind(ctx context.Context, cli *http.Client, id string) {
+	tainr := container{}
+	if err := apiGet(ctx, cli, "/containers/"+id+"/json", &tainr); err != nil {
+		klog.Errorf("error inspecting container %s: %s", id, err)
+		return
+	}
+	ports := map[int]bool{}
+	for _, bindings := range tainr.NetworkSettings.Ports {
+		for _, b := range bindings {
+			if port, err := strconv.Atoi(b.HostPort); err == nil && port > 0 {
+				ports[port] = true
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bound := map[int]bool{}
+	for _, l := range t.ports[id] {
+		bound[l.Addr().(*net.TCPAddr).Port] = true
+	}
+	for port := range ports {
+		if bound[port] {
+			continue
+		}
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			klog.Errorf("error binding port %d for container %s: %s", port, id, err)
+			continue
+		}
+		klog.Infof("forwarding 127.0.0.1:%d to container %s", port, id)
+		t.ports[id] = append(t.ports[id], l)
+		go t.serve(l, port)
+	}
+}
+
+// unbind will stop listening to the local ports of given container.
+func (t *Tunnel) unbind(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, l := range t.ports[id] {
+		klog.Infof("stopped forwarding %s to container %s", l.Addr(), id)
+		l.Close()
+	}
+	delete(t.ports, id)
+}
+
+// unbindAll will stop listening to the local ports of all containers.
+func (t *Tunnel) unbindAll() {
+	for _, id := range t.bound() {
+		t.unbind(id)
+	}
+}
+
+// bound will return the ids of the containers of which local ports are
+// bound.
+func (t *Tunnel) bound() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := []string{}
+	for id := range t.ports {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// apiGet will do a get request on given path of the kubedock api, and
+// decodes the json response into given result.
+func apiGet(ctx context.Context, cli *http.Client, path string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://kubedock"+path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
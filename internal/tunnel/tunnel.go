@@ -0,0 +1,222 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/util/portforward"
+)
+
+var (
+	// MinBackoff is the initial time to wait before reconnecting.
+	MinBackoff = time.Second
+	// MaxBackoff is the maximum time to wait before reconnecting.
+	MaxBackoff = 30 * time.Second
+)
+
+// Config is the configuration to be used for the Tunnel.
+type Config struct {
+	// RestConfig is the kubernetes config
+	RestConfig *rest.Config
+	// Client is the kubernetes clientset
+	Client kubernetes.Interface
+	// Namespace is the namespace in which kubedock is running
+	Namespace string
+	// Pod is the name of the kubedock pod, if not set, the pod is found
+	// with the Selector
+	Pod string
+	// Selector is the label selector to find the kubedock pod
+	Selector string
+	// RemotePort is the port of the kubedock api in the pod
+	RemotePort int
+	// ListenAddr is the local tcp address of the kubedock api
+	ListenAddr string
+	// Socket is the local unix socket of the kubedock api (instead of the
+	// ListenAddr)
+	Socket string
+}
+
+// Tunnel is a client for a kubedock instance that runs inside the cluster,
+// which serves the kubedock api locally, and binds local ports for the
+// ports of the containers, all via a single port-forward connection.
+type Tunnel struct {
+	cfg   Config
+	tun   *portforward.Tunnel
+	dial  func(int) (net.Conn, error)
+	ports map[string][]net.Listener
+	mu    sync.Mutex
+}
+
+// New will return a new Tunnel instance.
+func New(cfg Config) *Tunnel {
+	t := &Tunnel{cfg: cfg, ports: map[string][]net.Listener{}}
+	t.dial = t.dialTunnel
+	return t
+}
+
+// Run will connect to the kubedock pod and serve the kubedock api locally
+// until the given context is done. If the connection drops, it will
+// reconnect automatically.
+func (t *Tunnel) Run(ctx context.Context) error {
+	if err := t.connect(); err != nil {
+		return err
+	}
+	go t.reconnect(ctx)
+
+	var listener net.Listener
+	var err error
+	if t.cfg.Socket != "" {
+		listener, err = net.Listen("unix", t.cfg.Socket)
+		defer os.Remove(t.cfg.Socket)
+	} else {
+		listener, err = net.Listen("tcp", t.cfg.ListenAddr)
+	}
+	if err != nil {
+		return err
+	}
+	klog.Infof("kubedock api available on %s", listener.Addr())
+
+	go t.serve(listener, t.cfg.RemotePort)
+	go t.watch(ctx)
+
+	<-ctx.Done()
+	listener.Close()
+	t.unbindAll()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tun != nil {
+		t.tun.Close()
+	}
+	return nil
+}
+
+// connect will open the port-forward connection to the kubedock pod.
+func (t *Tunnel) connect() error {
+	pod, err := t.getPod()
+	if err != nil {
+		return err
+	}
+	tun, err := portforward.NewTunnel(t.cfg.RestConfig, *pod)
+	if err != nil {
+		return err
+	}
+	klog.Infof("connected to kubedock pod %s", pod.Name)
+	t.mu.Lock()
+	t.tun = tun
+	t.mu.Unlock()
+	return nil
+}
+
+// reconnect will open a new port-forward connection when the current
+// connection is closed, with an exponential backoff on failures.
+func (t *Tunnel) reconnect(ctx context.Context) {
+	for {
+		t.mu.Lock()
+		done := t.tun.Done()
+		t.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+		}
+
+		klog.Warningf("lost connection to kubedock pod, reconnecting")
+		backoff := MinBackoff
+		for {
+			err := t.connect()
+			if err == nil {
+				break
+			}
+			klog.Warningf("error connecting to kubedock pod: %s (retrying in %s)", err, backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > MaxBackoff {
+				backoff = MaxBackoff
+			}
+		}
+	}
+}
+
+// getPod will return the kubedock pod, which is either the configured pod,
+// or the first running pod that matches the configured selector.
+func (t *Tunnel) getPod() (*corev1.Pod, error) {
+	pods := t.cfg.Client.CoreV1().Pods(t.cfg.Namespace)
+	if t.cfg.Pod != "" {
+		return pods.Get(context.Background(), t.cfg.Pod, metav1.GetOptions{})
+	}
+	lst, err := pods.List(context.Background(), metav1.ListOptions{LabelSelector: t.cfg.Selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range lst.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			return &pod, nil
+		}
+	}
+	return nil, fmt.Errorf("no running kubedock pod found with selector %s in namespace %s", t.cfg.Selector, t.cfg.Namespace)
+}
+
+// dialTunnel will open a connection to given port of the kubedock pod via
+// the current port-forward connection.
+func (t *Tunnel) dialTunnel(port int) (net.Conn, error) {
+	t.mu.Lock()
+	tun := t.tun
+	t.mu.Unlock()
+	if tun == nil {
+		return nil, fmt.Errorf("not connected to kubedock pod")
+	}
+	return tun.Dial(port)
+}
+
+// serve will accept connections on given listener, and forwards these to
+// given port of the kubedock pod, until the listener is closed.
+func (t *Tunnel) serve(listener net.Listener, port int) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			remote, err := t.dial(port)
+			if err != nil {
+				klog.Errorf("error connecting to port %d of kubedock pod: %s", port, err)
+				return
+			}
+			defer remote.Close()
+			pipe(conn, remote)
+		}()
+	}
+}
+
+// closeWriter is implemented by connections that support half-closing.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe will copy data between the given connections until the remote
+// connection is closed.
+func pipe(conn, remote net.Conn) {
+	go func() {
+		io.Copy(remote, conn)
+		if cw, ok := remote.(closeWriter); ok {
+			cw.CloseWrite()
+		}
+	}()
+	io.Copy(conn, remote)
+}
@@ -0,0 +1,186 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetPod(t *testing.T) {
+	pod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "kubedock"}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	cli := fake.NewSimpleClientset(pod("tb303", corev1.PodPending), pod("rc752", corev1.PodRunning))
+
+	tests := []struct {
+		pod      string
+		selector string
+		out      string
+		err      bool
+	}{
+		{selector: "app=kubedock", out: "rc752"},
+		{pod: "tb303", out: "tb303"},
+		{pod: "f1spirit", err: true},
+		{selector: "app=other", err: true},
+	}
+	for i, tst := range tests {
+		tun := New(Config{Client: cli, Namespace: "default", Pod: tst.pod, Selector: tst.selector})
+		res, err := tun.getPod()
+		if (err != nil) != tst.err {
+			t.Errorf("failed test %d - expected error %t, but got %v", i, tst.err, err)
+			continue
+		}
+		if err == nil && res.Name != tst.out {
+			t.Errorf("failed test %d - expected pod %s, but got %s", i, tst.out, res.Name)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	free := func() int {
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port
+	}
+	stopped, started := free(), free()
+
+	events := make(chan string, 2)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			fmt.Fprint(w, `[{"Id":"tb303"}]`)
+		case "/containers/tb303/json":
+			fmt.Fprintf(w, `{"Id":"tb303","NetworkSettings":{"Ports":{"80/tcp":[{"HostPort":"%d"}]}}}`, stopped)
+		case "/containers/rc752/json":
+			fmt.Fprintf(w, `{"Id":"rc752","NetworkSettings":{"Ports":{"80/tcp":[{"HostPort":"%d"}]}}}`, started)
+		case "/events":
+			w.WriteHeader(http.StatusOK)
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case ev := <-events:
+					fmt.Fprintln(w, ev)
+					w.(http.Flusher).Flush()
+				}
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	echo, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	tun := New(Config{RemotePort: 2475})
+	tun.dial = func(port int) (net.Conn, error) {
+		if port == 2475 {
+			return net.Dial("tcp", api.Listener.Addr().String())
+		}
+		return net.Dial("tcp", echo.Addr().String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tun.watch(ctx)
+
+	bound := func(port int) bool {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 100*time.Millisecond)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		conn.Write([]byte("ping"))
+		res := make([]byte, 4)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = io.ReadFull(conn, res)
+		return err == nil && string(res) == "ping"
+	}
+	wait := func(port int, exp bool) bool {
+		for i := 0; i < 50; i++ {
+			if bound(port) == exp {
+				return true
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		return false
+	}
+
+	if !wait(stopped, true) {
+		t.Errorf("expected port %d of running container to be forwarded", stopped)
+	}
+	events <- `{"id":"rc752","Type":"container","Action":"start"}`
+	events <- `{"id":"tb303","Type":"container","Action":"destroy"}`
+	if !wait(started, true) {
+		t.Errorf("expected port %d of started container to be forwarded", started)
+	}
+	if !wait(stopped, false) {
+		t.Errorf("expected port %d of stopped container not to be forwarded", stopped)
+	}
+
+	tun.unbindAll()
+	if !wait(started, false) {
+		t.Errorf("expected port %d not to be forwarded after unbind", started)
+	}
+}
+
+func TestSyncUnbind(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			fmt.Fprint(w, `[]`)
+		case "/events":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	tun := New(Config{RemotePort: 2475})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer l.Close()
+	tun.ports["tb303"] = []net.Listener{l}
+
+	cli := &http.Client{Transport: &http.Transport{
+		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("tcp", api.Listener.Addr().String())
+		},
+	}}
+	tun.sync(context.Background(), cli)
+
+	if len(tun.bound()) != 0 {
+		t.Errorf("expected ports of removed container to be unbound, but got %v", tun.bound())
+	}
+	if _, err := l.Accept(); err == nil {
+		t.Errorf("expected listener of removed container to be closed")
+	}
+}
@@ -0,0 +1,239 @@
+package connectproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"k8s.io/klog"
+)
+
+const (
+	socksVersion             = 0x05
+	socksConnect             = 0x01
+	socksNoAuth              = 0x00
+	socksNoAcceptableMethods = 0xFF
+	socksIPv4                = 0x01
+	socksDomain              = 0x03
+	socksIPv6                = 0x04
+
+	socksSucceeded           = 0x00
+	socksGeneralFailure      = 0x01
+	socksHostUnreachable     = 0x04
+	socksCommandNotSupported = 0x07
+	socksAddressNotSupported = 0x08
+)
+
+// DialFunc is the function that is used to connect to the requested host
+// and port.
+type DialFunc func(host string, port int) (net.Conn, error)
+
+// Request is the structure used as argument for Proxy
+type Request struct {
+	// ListenAddr is the address the proxy listens to (e.g. :1080)
+	ListenAddr string
+	// Dial is the function that connects to the requested destination
+	Dial DialFunc
+	// StopCh is the channel used to manage the proxy lifecycle
+	StopCh <-chan struct{}
+}
+
+// Proxy will start a proxy listening to the given address, which supports
+// both SOCKS5 (without authentication) and HTTP CONNECT requests, and
+// tunnels the connections to the destination via the given Dial function.
+func Proxy(req Request) error {
+	listener, err := net.Listen("tcp", req.ListenAddr)
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("start socks5/http connect proxy on %s", listener.Addr())
+
+	done := false
+	go func() {
+		<-req.StopCh
+		klog.Infof("stopped socks5/http connect proxy on %s", listener.Addr())
+		done = true
+		listener.Close()
+	}()
+
+	go func() {
+		for !done {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !done {
+					klog.Errorf("error accepting connection: %s", err)
+				}
+				continue
+			}
+			go handleConnection(conn, req.Dial)
+		}
+	}()
+
+	return nil
+}
+
+// handleConnection will determine the protocol of the given connection, and
+// handles the request accordingly. It will close the connection when
+// returned.
+func handleConnection(conn net.Conn, dial DialFunc) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	ver, err := rd.Peek(1)
+	if err != nil {
+		return
+	}
+	if ver[0] == socksVersion {
+		err = handleSocks(conn, rd, dial)
+	} else {
+		err = handleConnect(conn, rd, dial)
+	}
+	if err != nil {
+		klog.V(2).Infof("proxy connection from %s failed: %s", conn.RemoteAddr(), err)
+	}
+}
+
+// handleSocks will handle a SOCKS5 connect request (RFC 1928). Only the
+// connect command is supported, without authentication; if the client does
+// not offer the no authentication method, the request is refused.
+func handleSocks(conn net.Conn, rd *bufio.Reader, dial DialFunc) error {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		return err
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(rd, methods); err != nil {
+		return err
+	}
+	if !bytes.Contains(methods, []byte{socksNoAuth}) {
+		conn.Write([]byte{socksVersion, socksNoAcceptableMethods})
+		return fmt.Errorf("no supported socks authentication method offered")
+	}
+	// no authentication required
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return err
+	}
+
+	hdr = make([]byte, 4)
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		return err
+	}
+	if hdr[0] != socksVersion {
+		return fmt.Errorf("unsupported socks version %d", hdr[0])
+	}
+	if hdr[1] != socksConnect {
+		socksReply(conn, socksCommandNotSupported)
+		return fmt.Errorf("unsupported socks command %d", hdr[1])
+	}
+
+	var host string
+	switch hdr[3] {
+	case socksIPv4, socksIPv6:
+		ip := make([]byte, net.IPv4len)
+		if hdr[3] == socksIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(rd, ip); err != nil {
+			return err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		n, err := rd.ReadByte()
+		if err != nil {
+			return err
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(rd, name); err != nil {
+			return err
+		}
+		host = string(name)
+	default:
+		socksReply(conn, socksAddressNotSupported)
+		return fmt.Errorf("unsupported socks address type %d", hdr[3])
+	}
+	prt := make([]byte, 2)
+	if _, err := io.ReadFull(rd, prt); err != nil {
+		return err
+	}
+	port := int(binary.BigEndian.Uint16(prt))
+
+	remote, err := dial(host, port)
+	if err != nil {
+		socksReply(conn, socksHostUnreachable)
+		return fmt.Errorf("error connecting to %s:%d: %w", host, port, err)
+	}
+	defer remote.Close()
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		return err
+	}
+
+	klog.V(3).Infof("proxying socks5 connection from %s to %s:%d", conn.RemoteAddr(), host, port)
+	pipe(conn, rd, remote)
+	return nil
+}
+
+// socksReply will write a SOCKS5 reply with given status.
+func socksReply(conn net.Conn, status byte) error {
+	_, err := conn.Write([]byte{socksVersion, status, 0x00, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// handleConnect will handle a HTTP CONNECT request.
+func handleConnect(conn net.Conn, rd *bufio.Reader, dial DialFunc) error {
+	req, err := http.ReadRequest(rd)
+	if err != nil {
+		return err
+	}
+	if req.Method != http.MethodConnect {
+		fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n\r\n", http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return fmt.Errorf("unsupported http method %s", req.Method)
+	}
+
+	host, prt, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n\r\n", http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return err
+	}
+	port, err := strconv.Atoi(prt)
+	if err != nil {
+		fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n\r\n", http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return err
+	}
+
+	remote, err := dial(host, port)
+	if err != nil {
+		fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n\r\n", http.StatusBadGateway, http.StatusText(http.StatusBadGateway))
+		return fmt.Errorf("error connecting to %s:%d: %w", host, port, err)
+	}
+	defer remote.Close()
+	if _, err := fmt.Fprintf(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return err
+	}
+
+	klog.V(3).Infof("proxying connect connection from %s to %s:%d", conn.RemoteAddr(), host, port)
+	pipe(conn, rd, remote)
+	return nil
+}
+
+// closeWriter is implemented by connections that support half-closing.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe will copy data between the client and the remote connection until
+// the remote connection is closed. Data that is already buffered in given
+// reader is sent to the remote connection as well.
+func pipe(conn net.Conn, rd io.Reader, remote net.Conn) {
+	go func() {
+		io.Copy(remote, rd)
+		if cw, ok := remote.(closeWriter); ok {
+			cw.CloseWrite()
+		}
+	}()
+	io.Copy(conn, remote)
+}
@@ -0,0 +1,114 @@
+package connectproxy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestHandleConnection(t *testing.T) {
+	socks := func(atyp byte, addr []byte) []byte {
+		req := []byte{socksVersion, 1, 0x00, socksVersion, socksConnect, 0x00, atyp}
+		req = append(req, addr...)
+		return append(req, 0x1f, 0x90) // port 8080
+	}
+
+	tests := []struct {
+		request []byte
+		reply   []byte
+		target  string
+		fail    bool
+	}{
+		{
+			request: socks(socksDomain, append([]byte{8}, []byte("f1spirit")...)),
+			reply:   []byte{socksVersion, 0x00, socksVersion, socksSucceeded, 0x00, socksIPv4, 0, 0, 0, 0, 0, 0},
+			target:  "f1spirit:8080",
+		},
+		{
+			request: socks(socksIPv4, []byte{10, 0, 0, 1}),
+			reply:   []byte{socksVersion, 0x00, socksVersion, socksSucceeded, 0x00, socksIPv4, 0, 0, 0, 0, 0, 0},
+			target:  "10.0.0.1:8080",
+		},
+		{
+			request: socks(socksDomain, append([]byte{5}, []byte("tb303")...)),
+			reply:   []byte{socksVersion, 0x00, socksVersion, socksHostUnreachable, 0x00, socksIPv4, 0, 0, 0, 0, 0, 0},
+			target:  "tb303:8080",
+			fail:    true,
+		},
+		{
+			request: []byte{socksVersion, 1, 0x02},
+			reply:   []byte{socksVersion, socksNoAcceptableMethods},
+			fail:    true,
+		},
+		{
+			request: []byte("CONNECT f1spirit:8080 HTTP/1.1\r\nHost: f1spirit:8080\r\n\r\n"),
+			reply:   []byte("HTTP/1.1 200 Connection established\r\n\r\n"),
+			target:  "f1spirit:8080",
+		},
+		{
+			request: []byte("CONNECT tb303:8080 HTTP/1.1\r\nHost: tb303:8080\r\n\r\n"),
+			reply:   []byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"),
+			target:  "tb303:8080",
+			fail:    true,
+		},
+		{
+			request: []byte("GET / HTTP/1.1\r\nHost: f1spirit:8080\r\n\r\n"),
+			reply:   []byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"),
+			fail:    true,
+		},
+	}
+
+	for i, tst := range tests {
+		client, proxy := net.Pipe()
+		target := ""
+		go handleConnection(proxy, func(host string, port int) (net.Conn, error) {
+			target = fmt.Sprintf("%s:%d", host, port)
+			if tst.fail {
+				return nil, fmt.Errorf("connection refused")
+			}
+			// echo server
+			local, remote := net.Pipe()
+			go func() {
+				io.Copy(remote, remote)
+				remote.Close()
+			}()
+			return local, nil
+		})
+
+		go client.Write(tst.request)
+		rd := bufio.NewReader(client)
+		reply := make([]byte, len(tst.reply))
+		if _, err := io.ReadFull(rd, reply); err != nil {
+			t.Errorf("failed test %d - unexpected error reading reply: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(reply, tst.reply) {
+			t.Errorf("failed test %d - expected reply %q, but got %q", i, tst.reply, reply)
+		}
+		if target != tst.target {
+			t.Errorf("failed test %d - expected target %s, but got %s", i, tst.target, target)
+		}
+		if !tst.fail {
+			go client.Write([]byte("ping"))
+			echo := make([]byte, 4)
+			if _, err := io.ReadFull(rd, echo); err != nil || string(echo) != "ping" {
+				t.Errorf("failed test %d - expected echo ping, but got %q (%v)", i, echo, err)
+			}
+		}
+		client.Close()
+	}
+}
+
+func TestProxy(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := Proxy(Request{ListenAddr: "127.0.0.1:0", StopCh: stop}); err != nil {
+		t.Errorf("unexpected error starting proxy: %s", err)
+	}
+	if err := Proxy(Request{ListenAddr: "invalid", StopCh: stop}); err == nil {
+		t.Errorf("expected error starting proxy with invalid address")
+	}
+}
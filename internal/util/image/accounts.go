@@ -0,0 +1,197 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	passwdFile = "etc/passwd"
+	groupFile  = "etc/group"
+)
+
+// Accounts contains the users and groups as defined in the /etc/passwd
+// and /etc/group files of an image.
+type Accounts struct {
+	users  map[string][2]int64
+	groups map[string]int64
+}
+
+var accountsCache = map[string]*Accounts{}
+var accountsMutex sync.Mutex
+
+// InspectAccounts will return the users and groups that are defined in
+// the specified image (docker://docker.io/library/postgres:latest). The
+// results are cached per image digest.
+func InspectAccounts(name string) (*Accounts, error) {
+	sys := &types.SystemContext{
+		OSChoice: "linux",
+	}
+
+	ctx := context.Background()
+	src, err := parseImageSource(ctx, sys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing manifest for image: %w", err)
+	}
+
+	digest := img.ConfigInfo().Digest.String()
+	accountsMutex.Lock()
+	accts, ok := accountsCache[digest]
+	accountsMutex.Unlock()
+	if ok {
+		return accts, nil
+	}
+
+	files := map[string][]byte{}
+	layers := img.LayerInfos()
+	for i := len(layers) - 1; i >= 0 && len(files) < 2; i-- {
+		blob, _, err := src.GetBlob(ctx, layers[i], none.NoCache)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading layer %s: %w", layers[i].Digest, err)
+		}
+		err = readAccountFiles(blob, files)
+		blob.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading layer %s: %w", layers[i].Digest, err)
+		}
+	}
+
+	accts = ParseAccounts(files[passwdFile], files[groupFile])
+	accountsMutex.Lock()
+	accountsCache[digest] = accts
+	accountsMutex.Unlock()
+	return accts, nil
+}
+
+// readAccountFiles will read the passwd and group files from given layer
+// and adds them to the given files map, if not already present. Files that
+// are removed in the layer (whiteouts) are added as empty files.
+func readAccountFiles(layer io.Reader, files map[string][]byte) error {
+	rd, _, err := compression.AutoDecompress(layer)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	found := map[string][]byte{}
+	opaque := false
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		switch name {
+		case passwdFile, groupFile:
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			dat, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			found[name] = dat
+		case "etc/.wh.passwd", "etc/.wh.group":
+			found["etc/"+strings.TrimPrefix(path.Base(name), ".wh.")] = []byte{}
+		case "etc/.wh..wh..opq":
+			opaque = true
+		}
+	}
+
+	for _, f := range []string{passwdFile, groupFile} {
+		if _, ok := files[f]; ok {
+			continue
+		}
+		if dat, ok := found[f]; ok {
+			files[f] = dat
+		} else if opaque {
+			files[f] = []byte{}
+		}
+	}
+	return nil
+}
+
+// ParseAccounts will parse the given contents of a passwd and group file
+// and returns the Accounts accordingly. Invalid lines are ignored.
+func ParseAccounts(passwd, group []byte) *Accounts {
+	accts := &Accounts{
+		users:  map[string][2]int64{},
+		groups: map[string]int64{},
+	}
+	scan := func(dat []byte, fn func([]string)) {
+		sc := bufio.NewScanner(bytes.NewReader(dat))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fn(strings.Split(line, ":"))
+		}
+	}
+	scan(passwd, func(f []string) {
+		if len(f) < 4 {
+			return
+		}
+		uid, err := strconv.ParseInt(f[2], 10, 64)
+		if err != nil {
+			return
+		}
+		gid, err := strconv.ParseInt(f[3], 10, 64)
+		if err != nil {
+			return
+		}
+		accts.users[f[0]] = [2]int64{uid, gid}
+	})
+	scan(group, func(f []string) {
+		if len(f) < 3 {
+			return
+		}
+		gid, err := strconv.ParseInt(f[2], 10, 64)
+		if err != nil {
+			return
+		}
+		accts.groups[f[0]] = gid
+	})
+	return accts
+}
+
+// LookupUser will return the uid and primary gid of the given user name.
+func (ac *Accounts) LookupUser(name string) (int64, int64, error) {
+	ids, ok := ac.users[name]
+	if !ok {
+		return 0, 0, fmt.Errorf("user %s not found in image", name)
+	}
+	return ids[0], ids[1], nil
+}
+
+// LookupGroup will return the gid of the given group name.
+func (ac *Accounts) LookupGroup(name string) (int64, error) {
+	gid, ok := ac.groups[name]
+	if !ok {
+		return 0, fmt.Errorf("group %s not found in image", name)
+	}
+	return gid, nil
+}
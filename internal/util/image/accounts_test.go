@@ -0,0 +1,86 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+)
+
+func TestParseAccounts(t *testing.T) {
+	passwd := []byte("root:x:0:0:root:/root:/bin/bash\n# comment\npostgres:x:999:998::/var/lib/postgresql:/bin/bash\ninvalid:x:abc:0\n")
+	group := []byte("root:x:0:\nnogroup:x:65534:\n")
+	accts := ParseAccounts(passwd, group)
+
+	uid, gid, err := accts.LookupUser("postgres")
+	if err != nil || uid != 999 || gid != 998 {
+		t.Errorf("expected postgres to be 999:998, but got %d:%d (%v)", uid, gid, err)
+	}
+	if _, _, err := accts.LookupUser("invalid"); err == nil {
+		t.Errorf("expected error for invalid user")
+	}
+	if _, _, err := accts.LookupUser("nobody"); err == nil {
+		t.Errorf("expected error for unknown user")
+	}
+	gid, err = accts.LookupGroup("nogroup")
+	if err != nil || gid != 65534 {
+		t.Errorf("expected nogroup to be 65534, but got %d (%v)", gid, err)
+	}
+	if _, err := accts.LookupGroup("wheel"); err == nil {
+		t.Errorf("expected error for unknown group")
+	}
+}
+
+func TestReadAccountFiles(t *testing.T) {
+	layer := func(files map[string]string) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for name, dat := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(dat)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(dat))
+		}
+		tw.Close()
+		return &buf
+	}
+
+	tests := []struct {
+		layers []map[string]string
+		passwd string
+		group  string
+		count  int
+	}{
+		{
+			layers: []map[string]string{{"./etc/passwd": "a", "etc/group": "b"}},
+			passwd: "a", group: "b", count: 2,
+		},
+		{
+			layers: []map[string]string{{"etc/passwd": "top"}, {"etc/passwd": "bottom", "etc/group": "b"}},
+			passwd: "top", group: "b", count: 2,
+		},
+		{
+			layers: []map[string]string{{"etc/.wh.group": ""}, {"etc/group": "b"}},
+			passwd: "", group: "", count: 1,
+		},
+		{
+			layers: []map[string]string{{"etc/.wh..wh..opq": "", "etc/passwd": "a"}, {"etc/group": "b"}},
+			passwd: "a", group: "", count: 2,
+		},
+		{
+			layers: []map[string]string{{"usr/bin/true": "x"}},
+			count:  0,
+		},
+	}
+	for i, tst := range tests {
+		files := map[string][]byte{}
+		for _, l := range tst.layers {
+			if err := readAccountFiles(layer(l), files); err != nil {
+				t.Errorf("failed test %d - unexpected error: %s", i, err)
+			}
+		}
+		if len(files) != tst.count {
+			t.Errorf("failed test %d - expected %d files, but got %d", i, tst.count, len(files))
+		}
+		if string(files[passwdFile]) != tst.passwd || string(files[groupFile]) != tst.group {
+			t.Errorf("failed test %d - unexpected contents %v", i, files)
+		}
+	}
+}
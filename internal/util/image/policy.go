@@ -0,0 +1,114 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy will check if images are allowed to be used, based on lists of
+// allowed and denied image patterns. Patterns are matched against the fully
+// qualified image name (e.g. postgres:15 is docker.io/library/postgres:15),
+// with or without the tag, and may contain * and ? wildcards.
+type Policy struct {
+	// Allow contains the patterns of allowed images; if empty, all images
+	// that are not denied are allowed.
+	Allow []string `json:"allow"`
+	// Deny contains the patterns of denied images; deny takes precedence
+	// over allow.
+	Deny []string `json:"deny"`
+	// RequireDigest contains the patterns of images that should be
+	// referenced by digest (e.g. alpine@sha256:...).
+	RequireDigest []string `json:"requireDigest"`
+}
+
+// LoadPolicy will read a Policy from the given yaml or json file.
+func LoadPolicy(file string) (*Policy, error) {
+	dat, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pol := &Policy{}
+	if err := yaml.UnmarshalStrict(dat, pol); err != nil {
+		return nil, fmt.Errorf("invalid image policy %s: %w", file, err)
+	}
+	return pol, nil
+}
+
+// Add will add the given allow, deny and require digest patterns to the
+// policy.
+func (p *Policy) Add(allow, deny, digest []string) {
+	p.Allow = append(p.Allow, allow...)
+	p.Deny = append(p.Deny, deny...)
+	p.RequireDigest = append(p.RequireDigest, digest...)
+}
+
+// IsEmpty will return true if the policy doesn't restrict any images.
+func (p *Policy) IsEmpty() bool {
+	return p == nil || (len(p.Allow) == 0 && len(p.Deny) == 0 && len(p.RequireDigest) == 0)
+}
+
+// Check will return an error if the given image is not allowed by the
+// policy.
+func (p *Policy) Check(name string) error {
+	if p.IsEmpty() {
+		return nil
+	}
+	ref, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return fmt.Errorf("image %s is not allowed by policy: %w", name, err)
+	}
+	full := reference.TagNameOnly(ref).String()
+	names := []string{full, ref.Name()}
+	if matchAny(p.Deny, names) {
+		return fmt.Errorf("image %s is not allowed by policy: image is denied", full)
+	}
+	if len(p.Allow) > 0 && !matchAny(p.Allow, names) {
+		return fmt.Errorf("image %s is not allowed by policy: image is not in the allow list", full)
+	}
+	if _, ok := ref.(reference.Digested); !ok && matchAny(p.RequireDigest, names) {
+		return fmt.Errorf("image %s is not allowed by policy: image should be referenced by digest", full)
+	}
+	return nil
+}
+
+// Match will return true if the given image matches any of the given
+// patterns. The patterns are matched with the same wildcards as the policy
+// against the fully qualified image name, with or without the tag, and
+// against the short image name (e.g. postgres:15).
+func Match(patterns []string, name string) bool {
+	ref, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return false
+	}
+	ref = reference.TagNameOnly(ref)
+	return matchAny(patterns, []string{ref.String(), ref.Name(), reference.FamiliarString(ref)})
+}
+
+// matchAny will return true if any of the given names matches any of the
+// given patterns.
+func matchAny(patterns []string, names []string) bool {
+	for _, pat := range patterns {
+		re := globToRegexp(pat)
+		for _, name := range names {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globToRegexp will convert the given wildcard pattern to a regular
+// expression; * matches any sequence of characters (including /), and ?
+// matches a single character.
+func globToRegexp(pat string) *regexp.Regexp {
+	re := regexp.QuoteMeta(strings.TrimSpace(pat))
+	re = strings.ReplaceAll(re, `\*`, `.*`)
+	re = strings.ReplaceAll(re, `\?`, `.`)
+	return regexp.MustCompile("^" + re + "$")
+}
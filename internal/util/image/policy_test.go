@@ -0,0 +1,102 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	digest := "@sha256:4b1f7d5b5fd7e7de5b5b1d7f3e3a6c6d4b5e3e2c1f0a9b8c7d6e5f4a3b2c1d0e"
+	tests := []struct {
+		pol   *Policy
+		image string
+		err   bool
+	}{
+		{pol: nil, image: "alpine"},
+		{pol: &Policy{}, image: "alpine"},
+		{pol: &Policy{Allow: []string{"docker.io/library/*"}}, image: "alpine"},
+		{pol: &Policy{Allow: []string{"docker.io/library/*"}}, image: "quay.io/keycloak/keycloak:22", err: true},
+		{pol: &Policy{Allow: []string{"docker.io/library/postgres"}}, image: "postgres:15"},
+		{pol: &Policy{Allow: []string{"docker.io/library/postgres:1?"}}, image: "postgres:15"},
+		{pol: &Policy{Allow: []string{"docker.io/library/postgres:1?"}}, image: "postgres:9", err: true},
+		{pol: &Policy{Allow: []string{"mirror.corp/*"}}, image: "mirror.corp/team/app:1.0"},
+		{pol: &Policy{Deny: []string{"*:latest"}}, image: "alpine", err: true},
+		{pol: &Policy{Deny: []string{"*:latest"}}, image: "alpine:3.18"},
+		{pol: &Policy{Allow: []string{"*"}, Deny: []string{"docker.io/library/alpine"}}, image: "alpine:3.18", err: true},
+		{pol: &Policy{RequireDigest: []string{"*"}}, image: "alpine:3.18", err: true},
+		{pol: &Policy{RequireDigest: []string{"*"}}, image: "alpine" + digest},
+		{pol: &Policy{RequireDigest: []string{"quay.io/*"}}, image: "alpine:3.18"},
+		{pol: &Policy{Allow: []string{"*"}}, image: "Invalid Image", err: true},
+	}
+	for i, tst := range tests {
+		err := tst.pol.Check(tst.image)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		image    string
+		match    bool
+	}{
+		{patterns: []string{"postgres:*"}, image: "postgres:15", match: true},
+		{patterns: []string{"docker.io/library/postgres:*"}, image: "postgres:15", match: true},
+		{patterns: []string{"docker.io/library/postgres"}, image: "postgres", match: true},
+		{patterns: []string{"docker.io/*"}, image: "bitnami/kafka:3.5", match: true},
+		{patterns: []string{"quay.io/*"}, image: "postgres:15", match: false},
+		{patterns: []string{"postgres:*"}, image: "postgresql:15", match: false},
+		{patterns: []string{"*"}, image: "Invalid Image", match: false},
+		{patterns: nil, image: "postgres:15", match: false},
+	}
+	for i, tst := range tests {
+		if match := Match(tst.patterns, tst.image); match != tst.match {
+			t.Errorf("failed test %d - expected match %t, but got %t", i, tst.match, match)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		data  string
+		allow int
+		deny  int
+		dgst  int
+		err   bool
+	}{
+		{data: "allow:\n- docker.io/library/*\n- mirror.corp/*\ndeny:\n- '*:latest'\nrequireDigest:\n- quay.io/*\n", allow: 2, deny: 1, dgst: 1},
+		{data: `{"deny":["*"]}`, deny: 1},
+		{data: "allow: docker.io/*\n", err: true},
+		{data: "unknown: true\n", err: true},
+	}
+	for i, tst := range tests {
+		file := filepath.Join(dir, "policy.yaml")
+		if err := os.WriteFile(file, []byte(tst.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pol, err := LoadPolicy(file)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if len(pol.Allow) != tst.allow || len(pol.Deny) != tst.deny || len(pol.RequireDigest) != tst.dgst {
+			t.Errorf("failed test %d - unexpected policy %v", i, pol)
+		}
+	}
+
+	if _, err := LoadPolicy(filepath.Join(dir, "notfound.yaml")); err == nil {
+		t.Errorf("expected an error when file does not exist")
+	}
+}
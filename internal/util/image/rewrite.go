@@ -0,0 +1,80 @@
+package image
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+)
+
+// Rewriter will rewrite image names according to a list of rules, e.g.
+// to pull images from a mirror instead of the original registry.
+type Rewriter struct {
+	rules []rewriteRule
+}
+
+// rewriteRule is a single rewrite rule. If re is set, the rule is a
+// regular expression, otherwise it's a prefix rule.
+type rewriteRule struct {
+	prefix      string
+	re          *regexp.Regexp
+	replacement string
+}
+
+// NewRewriter will return a Rewriter for the given rules. Each rule has the
+// format match=replacement. The match is a prefix of the image name (e.g.
+// docker.io/=mirror.corp/dockerhub/), or a regular expression if prefixed
+// with ~ (e.g. ~^quay\.io/(.*)$=mirror.corp/quay/$1).
+func NewRewriter(rules []string) (*Rewriter, error) {
+	rw := &Rewriter{}
+	for _, r := range rules {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		i := strings.LastIndex(r, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid image rewrite rule %s: expected match=replacement", r)
+		}
+		match, repl := r[:i], r[i+1:]
+		rule := rewriteRule{replacement: repl}
+		if strings.HasPrefix(match, "~") {
+			re, err := regexp.Compile(match[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid image rewrite rule %s: %w", r, err)
+			}
+			rule.re = re
+		} else {
+			rule.prefix = match
+		}
+		rw.rules = append(rw.rules, rule)
+	}
+	return rw, nil
+}
+
+// Rewrite will return the rewritten image name, according to the first
+// rule that matches the image. Rules are matched against the fully
+// qualified image name (e.g. postgres:15 is docker.io/library/postgres:15).
+// If no rule matches, the given name is returned as is.
+func (rw *Rewriter) Rewrite(name string) string {
+	if rw == nil || len(rw.rules) == 0 {
+		return name
+	}
+	full := name
+	if ref, err := reference.ParseNormalizedNamed(name); err == nil {
+		full = reference.TagNameOnly(ref).String()
+	}
+	for _, r := range rw.rules {
+		if r.re != nil {
+			if r.re.MatchString(full) {
+				return r.re.ReplaceAllString(full, r.replacement)
+			}
+			continue
+		}
+		if strings.HasPrefix(full, r.prefix) {
+			return r.replacement + strings.TrimPrefix(full, r.prefix)
+		}
+	}
+	return name
+}
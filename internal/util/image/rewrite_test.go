@@ -0,0 +1,52 @@
+package image
+
+import (
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		rules []string
+		in    string
+		out   string
+		err   bool
+	}{
+		{rules: []string{}, in: "postgres:15", out: "postgres:15"},
+		{rules: []string{"docker.io/=mirror.corp/dockerhub/"}, in: "postgres:15", out: "mirror.corp/dockerhub/library/postgres:15"},
+		{rules: []string{"docker.io/=mirror.corp/dockerhub/"}, in: "joyrex2001/kubedock", out: "mirror.corp/dockerhub/joyrex2001/kubedock:latest"},
+		{rules: []string{"docker.io/=mirror.corp/dockerhub/"}, in: "quay.io/coreos/etcd:v3", out: "quay.io/coreos/etcd:v3"},
+		{
+			rules: []string{"quay.io/=mirror.corp/quay/", "docker.io/=mirror.corp/dockerhub/"},
+			in:    "quay.io/coreos/etcd:v3",
+			out:   "mirror.corp/quay/coreos/etcd:v3",
+		},
+		{
+			rules: []string{`~^docker\.io/library/([^:]+):(.*)$=mirror.corp/$1:$2`},
+			in:    "docker.io/library/redis:7",
+			out:   "mirror.corp/redis:7",
+		},
+		{rules: []string{"=mirror.corp/"}, err: true},
+		{rules: []string{"docker.io/"}, err: true},
+		{rules: []string{"~docker.io/(=mirror.corp/"}, err: true},
+	}
+	for i, tst := range tests {
+		rw, err := NewRewriter(tst.rules)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if res := rw.Rewrite(tst.in); res != tst.out {
+			t.Errorf("failed test %d - expected %s, but got %s", i, tst.out, res)
+		}
+	}
+
+	var rw *Rewriter
+	if res := rw.Rewrite("postgres:15"); res != "postgres:15" {
+		t.Errorf("failed nil rewriter - expected postgres:15, but got %s", res)
+	}
+}
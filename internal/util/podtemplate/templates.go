@@ -0,0 +1,239 @@
+package podtemplate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/joyrex2001/kubedock/internal/util/image"
+)
+
+const (
+	// DefaultTemplate is the name of the template that is used if no other
+	// template has been selected for a container.
+	DefaultTemplate = "default"
+	// ImagePatternAnnotation is the annotation that can be added to a pod
+	// template to select the template for images matching any of the given
+	// comma separated glob patterns (e.g. docker.io/library/postgres:*).
+	ImagePatternAnnotation = "com.joyrex2001.kubedock.image-pattern"
+)
+
+// Templates contains a set of named pod templates, that are read from a
+// single file (named default), or from a directory (named by file name).
+type Templates struct {
+	path     string
+	pods     map[string]*corev1.Pod
+	patterns map[string][]string
+	modified map[string]time.Time
+	quit     chan struct{}
+	mu       sync.RWMutex
+}
+
+// Load will read the pod templates from the given path, which can either
+// be a single pod file, or a directory containing pod files (.yaml, .yml
+// or .json). All templates are validated, and an error is returned if any
+// of them is invalid.
+func Load(path string) (*Templates, error) {
+	tp := &Templates{path: path}
+	if err := tp.load(); err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
+
+// Names will return the names of the available templates.
+func (tp *Templates) Names() []string {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	names := []string{}
+	for name := range tp.pods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get will return a copy of the template with given name. If no name is
+// given, it will return the first template of which an image pattern
+// matches the given image, or the default template. If no template is
+// found at all, an empty pod is returned.
+func (tp *Templates) Get(name, image string) (*corev1.Pod, error) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	if name != "" {
+		pod, ok := tp.pods[name]
+		if !ok {
+			return nil, fmt.Errorf("pod template %s not found", name)
+		}
+		return pod.DeepCopy(), nil
+	}
+	if pod := tp.matchImage(image); pod != nil {
+		return pod.DeepCopy(), nil
+	}
+	if pod, ok := tp.pods[DefaultTemplate]; ok {
+		return pod.DeepCopy(), nil
+	}
+	return &corev1.Pod{}, nil
+}
+
+// Watch will start a background process that periodically checks if the
+// templates have been changed, and will reload them if so. If the reloaded
+// templates are invalid, the previous templates will stay active.
+func (tp *Templates) Watch(interval time.Duration) {
+	quit := make(chan struct{})
+	tp.mu.Lock()
+	tp.quit = quit
+	tp.mu.Unlock()
+	go func() {
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-tick.C:
+				if !tp.changed() {
+					continue
+				}
+				if err := tp.load(); err != nil {
+					klog.Errorf("error reloading pod templates: %s", err)
+					continue
+				}
+				klog.Infof("reloaded pod templates: %s", strings.Join(tp.Names(), ", "))
+			}
+		}
+	}()
+}
+
+// Stop will stop watching the templates for changes. It's safe to call Stop
+// if the templates are not watched, or on nil templates.
+func (tp *Templates) Stop() {
+	if tp == nil {
+		return
+	}
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.quit != nil {
+		close(tp.quit)
+		tp.quit = nil
+	}
+}
+
+// matchImage will return the first template (in order of name) that has
+// an image pattern matching the given image.
+func (tp *Templates) matchImage(img string) *corev1.Pod {
+	names := []string{}
+	for name := range tp.patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if image.Match(tp.patterns[name], img) {
+			return tp.pods[name]
+		}
+	}
+	return nil
+}
+
+// load will (re)read all templates and replaces the current templates if
+// all could be read successfully.
+func (tp *Templates) load() error {
+	files, err := tp.files()
+	if err != nil {
+		return err
+	}
+
+	pods := map[string]*corev1.Pod{}
+	patterns := map[string][]string{}
+	modified := map[string]time.Time{}
+	for name, file := range files {
+		st, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		pod, err := PodFromFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading pod template %s: %w", file, err)
+		}
+		if pat, ok := pod.ObjectMeta.Annotations[ImagePatternAnnotation]; ok {
+			for _, p := range strings.Split(pat, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					patterns[name] = append(patterns[name], p)
+				}
+			}
+			delete(pod.ObjectMeta.Annotations, ImagePatternAnnotation)
+		}
+		pods[name] = pod
+		modified[file] = st.ModTime()
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.pods = pods
+	tp.patterns = patterns
+	tp.modified = modified
+	return nil
+}
+
+// changed will return true if any of the template files have been added,
+// removed or modified since they were loaded.
+func (tp *Templates) changed() bool {
+	files, err := tp.files()
+	if err != nil {
+		return true
+	}
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	if len(files) != len(tp.modified) {
+		return true
+	}
+	for _, file := range files {
+		st, err := os.Stat(file)
+		if err != nil {
+			return true
+		}
+		if mod, ok := tp.modified[file]; !ok || !mod.Equal(st.ModTime()) {
+			return true
+		}
+	}
+	return false
+}
+
+// files will return a map of template names and their file location.
+func (tp *Templates) files() (map[string]string, error) {
+	st, err := os.Stat(tp.path)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return map[string]string{DefaultTemplate: tp.path}, nil
+	}
+	entries, err := os.ReadDir(tp.path)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for _, e := range entries {
+		// skip hidden files, such as the ..data folders of mounted configmaps
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(e.Name())
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+		file := filepath.Join(tp.path, e.Name())
+		if st, err := os.Stat(file); err != nil || st.IsDir() {
+			continue
+		}
+		files[strings.TrimSuffix(e.Name(), ext)] = file
+	}
+	return files, nil
+}
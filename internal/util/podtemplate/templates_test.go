@@ -0,0 +1,144 @@
+package podtemplate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		path  string
+		names []string
+		err   bool
+	}{
+		{path: "test/test_pod.yaml", names: []string{"default"}},
+		{path: "test/templates", names: []string{"browser", "database", "default"}},
+		{path: "test/notfound", err: true},
+		{path: "test/test_invalid.yaml", err: true},
+	}
+	for i, tst := range tests {
+		tp, err := Load(tst.path)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if names := tp.Names(); !reflect.DeepEqual(names, tst.names) {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.names, names)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	tp, err := Load("test/templates")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tests := []struct {
+		name  string
+		image string
+		sa    string
+		err   bool
+	}{
+		{name: "", image: "alpine:latest", sa: "kubedock"},
+		{name: "browser", image: "postgres:15", sa: "browser"},
+		{name: "", image: "postgres:15", sa: "database"},
+		{name: "", image: "docker.io/library/mysql:8", sa: "database"},
+		{name: "", image: "mysql:8", sa: "database"},
+		{name: "", image: "docker.io/library/postgres:15", sa: "database"},
+		{name: "", image: "postgresql:15", sa: "kubedock"},
+		{name: "kafka", image: "alpine:latest", err: true},
+	}
+	for i, tst := range tests {
+		pod, err := tp.Get(tst.name, tst.image)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if err != nil {
+			continue
+		}
+		if pod.Spec.ServiceAccountName != tst.sa {
+			t.Errorf("failed test %d - expected service account %s, but got %s", i, tst.sa, pod.Spec.ServiceAccountName)
+		}
+		if _, ok := pod.ObjectMeta.Annotations[ImagePatternAnnotation]; ok {
+			t.Errorf("failed test %d - image pattern annotation should not be present", i)
+		}
+		pod.Spec.ServiceAccountName = "modified"
+	}
+	if pod, _ := tp.Get("browser", ""); pod.Spec.ServiceAccountName != "browser" {
+		t.Errorf("template should not be modified by callers")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, sa string, mod time.Time) {
+		file := filepath.Join(dir, name)
+		dat := []byte("apiVersion: v1\nkind: Pod\nspec:\n  serviceAccountName: " + sa + "\n")
+		if err := os.WriteFile(file, dat, 0644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := os.Chtimes(file, mod, mod); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	now := time.Now()
+	write("default.yaml", "first", now)
+	tp, err := Load(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tp.changed() {
+		t.Errorf("expected templates to be unchanged")
+	}
+
+	write("default.yaml", "second", now.Add(time.Second))
+	if !tp.changed() {
+		t.Errorf("expected templates to be changed after modification")
+	}
+	if err := tp.load(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pod, _ := tp.Get("", ""); pod.Spec.ServiceAccountName != "second" {
+		t.Errorf("expected reloaded template, but got %s", pod.Spec.ServiceAccountName)
+	}
+
+	write("other.yaml", "other", now)
+	if !tp.changed() {
+		t.Errorf("expected templates to be changed after adding a template")
+	}
+}
+
+func TestStop(t *testing.T) {
+	var nilt *Templates
+	nilt.Stop()
+
+	tp, err := Load("test/test_pod.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		tp.Stop()
+		tp.Watch(time.Hour)
+		tp.Stop()
+		tp.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("expected stop to return")
+	}
+}
@@ -0,0 +1,65 @@
+package portforward
+
+import (
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// activityDialer is a dialer that wraps the streams of the connections it
+// creates, so the activity function is called whenever data is forwarded.
+type activityDialer struct {
+	httpstream.Dialer
+	activity func()
+}
+
+// Dial will open a streaming connection, of which the streams call the
+// activity function when data is read or written.
+func (d *activityDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	conn, proto, err := d.Dialer.Dial(protocols...)
+	if err != nil {
+		return conn, proto, err
+	}
+	return &activityConnection{conn, d.activity}, proto, nil
+}
+
+// activityConnection is a connection that creates streams which call the
+// activity function when data is read or written.
+type activityConnection struct {
+	httpstream.Connection
+	activity func()
+}
+
+// CreateStream will create a new stream with the supplied headers, which
+// calls the activity function when data is read or written.
+func (c *activityConnection) CreateStream(headers http.Header) (httpstream.Stream, error) {
+	stream, err := c.Connection.CreateStream(headers)
+	if err != nil {
+		return stream, err
+	}
+	return &activityStream{stream, c.activity}, nil
+}
+
+// activityStream is a stream that calls the activity function whenever data
+// is read or written.
+type activityStream struct {
+	httpstream.Stream
+	activity func()
+}
+
+// Read will read from the underlying stream, and calls the activity function
+// if any data was read.
+func (s *activityStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	if n > 0 {
+		s.activity()
+	}
+	return n, err
+}
+
+// Write will call the activity function, and writes to the underlying
+// stream.
+func (s *activityStream) Write(p []byte) (int, error) {
+	s.activity()
+	return s.Stream.Write(p)
+}
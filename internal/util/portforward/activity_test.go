@@ -0,0 +1,56 @@
+package portforward
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+type fakeStream struct {
+	bytes.Buffer
+}
+
+func (s *fakeStream) Close() error         { return nil }
+func (s *fakeStream) Reset() error         { return nil }
+func (s *fakeStream) Headers() http.Header { return http.Header{} }
+func (s *fakeStream) Identifier() uint32   { return 0 }
+
+type fakeConnection struct {
+	httpstream.Connection
+}
+
+func (c *fakeConnection) CreateStream(headers http.Header) (httpstream.Stream, error) {
+	return &fakeStream{}, nil
+}
+
+func TestActivityStream(t *testing.T) {
+	count := 0
+	conn := &activityConnection{&fakeConnection{}, func() { count++ }}
+	stream, err := conn.CreateStream(http.Header{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	tests := []struct {
+		write string
+		read  int
+		count int
+	}{
+		{write: "tb303", count: 1},
+		{read: 5, count: 2},
+		{read: 5, count: 2},
+		{write: "f1spirit", read: 3, count: 4},
+	}
+	for i, tst := range tests {
+		if tst.write != "" {
+			stream.Write([]byte(tst.write))
+		}
+		if tst.read > 0 {
+			stream.Read(make([]byte, tst.read))
+		}
+		if count != tst.count {
+			t.Errorf("failed test %d - expected %d activities, but got %d", i, tst.count, count)
+		}
+	}
+}
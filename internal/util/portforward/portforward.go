@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/transport/spdy"
@@ -29,6 +30,15 @@ type Request struct {
 	StopCh <-chan struct{}
 	// ReadyCh communicates when the tunnel is ready to receive traffic
 	ReadyCh chan struct{}
+	// Activity is an optional function that is called whenever data is
+	// forwarded by the port-forward
+	Activity func()
+	// Resolve is an optional function that returns the current pod, which
+	// is used by Supervise to find the pod when (re)connecting
+	Resolve func() (*v1.Pod, error)
+	// OnStatus is an optional function that is called by Supervise whenever
+	// the status of the port-forward changes
+	OnStatus func(Status)
 }
 
 // ToPod will portforward to given pod.
@@ -42,7 +52,10 @@ func ToPod(req Request) error {
 	klog.Infof("start port-forward %d->%d", req.LocalPort, req.PodPort)
 
 	url := getURLScheme(req)
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	var dialer httpstream.Dialer = spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	if req.Activity != nil {
+		dialer = &activityDialer{dialer, req.Activity}
+	}
 	fw, err := portforward.New(dialer, []string{fmt.Sprintf("%d:%d", req.LocalPort, req.PodPort)}, req.StopCh, req.ReadyCh, logr, logr)
 	if err != nil {
 		return err
@@ -0,0 +1,164 @@
+package portforward
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// StateConnecting is the state of a port-forward that is being set up.
+	StateConnecting = "connecting"
+	// StateReady is the state of a port-forward that accepts traffic.
+	StateReady = "ready"
+	// StateReconnecting is the state of a port-forward that failed, and
+	// is waiting to be set up again.
+	StateReconnecting = "reconnecting"
+	// StateStopped is the state of a port-forward that has been stopped.
+	StateStopped = "stopped"
+)
+
+var (
+	// HealthCheckInterval is the interval in which the pod of a supervised
+	// port-forward is checked for being recreated.
+	HealthCheckInterval = 10 * time.Second
+	// MinBackoff is the initial time to wait before reconnecting.
+	MinBackoff = time.Second
+	// MaxBackoff is the maximum time to wait before reconnecting.
+	MaxBackoff = 30 * time.Second
+)
+
+// Status describes the state of a supervised port-forward.
+type Status struct {
+	// LocalPort is the local port of the port-forward
+	LocalPort int
+	// PodPort is the target port in the pod
+	PodPort int
+	// Pod is the name of the pod the port-forward is connected to
+	Pod string
+	// State is the current state of the port-forward
+	State string
+	// Restarts is the number of times the port-forward was reconnected
+	Restarts int
+	// Error is the last error that occurred, which is cleared once the
+	// port-forward is ready again
+	Error string
+}
+
+// forward is the function that runs a single port-forward.
+var forward = ToPod
+
+// Supervise will run a port-forward until the StopCh is signalled. If the
+// port-forward fails, it will reconnect with an exponential backoff. The
+// pod is resolved again (with the optional Resolve function) on every
+// reconnect, and the port-forward is reconnected if the pod has been
+// recreated. The ReadyCh of the request is not used.
+func Supervise(req Request) {
+	st := Status{LocalPort: req.LocalPort, PodPort: req.PodPort}
+	update := func(state string, err error) {
+		st.State = state
+		if err != nil {
+			st.Error = err.Error()
+		}
+		if state == StateReady {
+			st.Error = ""
+		}
+		if req.OnStatus != nil {
+			req.OnStatus(st)
+		}
+	}
+
+	backoff := MinBackoff
+	for {
+		update(StateConnecting, nil)
+		err := superviseOnce(req, func(pod string) {
+			st.Pod = pod
+			update(StateReady, nil)
+			backoff = MinBackoff
+		})
+		if err == nil {
+			update(StateStopped, nil)
+			return
+		}
+
+		klog.Warningf("port-forward %d->%d failed: %s (reconnecting in %s)", req.LocalPort, req.PodPort, err, backoff)
+		st.Restarts++
+		update(StateReconnecting, err)
+		tmr := time.NewTimer(backoff)
+		select {
+		case <-req.StopCh:
+			tmr.Stop()
+			update(StateStopped, nil)
+			return
+		case <-tmr.C:
+		}
+		backoff *= 2
+		if backoff > MaxBackoff {
+			backoff = MaxBackoff
+		}
+	}
+}
+
+// superviseOnce will resolve the pod and run a single port-forward until
+// the StopCh is signalled, in which case it will return nil. It will return
+// an error if the port-forward failed, or if the pod has been recreated.
+// The ready function is called once the port-forward accepts traffic.
+func superviseOnce(req Request, ready func(string)) error {
+	pod, err := resolve(req)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	readyCh := make(chan struct{})
+	done := make(chan error, 1)
+	fwd := req
+	fwd.Pod = *pod
+	fwd.StopCh = stop
+	fwd.ReadyCh = readyCh
+	go func() {
+		done <- forward(fwd)
+	}()
+
+	tckr := time.NewTicker(HealthCheckInterval)
+	defer tckr.Stop()
+	for {
+		select {
+		case <-req.StopCh:
+			close(stop)
+			<-done
+			return nil
+		case <-readyCh:
+			readyCh = nil
+			ready(pod.Name)
+		case err := <-done:
+			if err == nil {
+				err = fmt.Errorf("port-forward closed")
+			}
+			return err
+		case <-tckr.C:
+			cur, err := resolve(req)
+			if err != nil {
+				klog.V(3).Infof("health check of port-forward %d->%d failed: %s", req.LocalPort, req.PodPort, err)
+				continue
+			}
+			if cur.UID != pod.UID {
+				close(stop)
+				<-done
+				return fmt.Errorf("pod %s has been recreated", pod.Name)
+			}
+		}
+	}
+}
+
+// resolve will return the pod that should be port-forwarded to, which is
+// the pod returned by the Resolve function, or the Pod in the request if no
+// Resolve function is set.
+func resolve(req Request) (*v1.Pod, error) {
+	if req.Resolve == nil {
+		return &req.Pod, nil
+	}
+	return req.Resolve()
+}
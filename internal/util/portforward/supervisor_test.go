@@ -0,0 +1,94 @@
+package portforward
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+func TestSupervise(t *testing.T) {
+	HealthCheckInterval = 5 * time.Millisecond
+	MinBackoff = time.Millisecond
+	MaxBackoff = 2 * time.Millisecond
+	defer func() { forward = ToPod }()
+
+	tests := []struct {
+		fails    int
+		recreate bool
+		restarts int
+	}{
+		{fails: 0, restarts: 0},
+		{fails: 2, restarts: 2},
+		{fails: 0, recreate: true, restarts: 1},
+	}
+
+	for i, tst := range tests {
+		var mu sync.Mutex
+		calls := 0
+		uid := "tb303"
+		forward = func(req Request) error {
+			mu.Lock()
+			calls++
+			n := calls
+			mu.Unlock()
+			if n <= tst.fails {
+				return fmt.Errorf("lost connection to pod")
+			}
+			close(req.ReadyCh)
+			<-req.StopCh
+			return nil
+		}
+
+		stop := make(chan struct{})
+		ready := make(chan Status, 10)
+		done := make(chan Status, 1)
+		go func() {
+			last := Status{}
+			Supervise(Request{
+				LocalPort: 8080,
+				PodPort:   80,
+				StopCh:    stop,
+				Resolve: func() (*v1.Pod, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "f1spirit", UID: apitypes.UID(uid)}}, nil
+				},
+				OnStatus: func(st Status) {
+					last = st
+					if st.State == StateReady {
+						ready <- st
+					}
+				},
+			})
+			done <- last
+		}()
+
+		rst := <-ready
+		if tst.recreate {
+			mu.Lock()
+			uid = "rc752"
+			mu.Unlock()
+			rst = <-ready
+		}
+		if rst.Error != "" {
+			t.Errorf("failed test %d - expected error to be cleared when ready, but got %s", i, rst.Error)
+		}
+		close(stop)
+		st := <-done
+
+		if st.State != StateStopped {
+			t.Errorf("failed test %d - expected state %s, but got %s", i, StateStopped, st.State)
+		}
+		if st.Restarts != tst.restarts {
+			t.Errorf("failed test %d - expected %d restarts, but got %d", i, tst.restarts, st.Restarts)
+		}
+		if st.Pod != "f1spirit" || st.LocalPort != 8080 || st.PodPort != 80 {
+			t.Errorf("failed test %d - unexpected status %v", i, st)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/klog"
+)
+
+// Dial will open a connection to given port of given pod, by using a
+// port-forward stream, rather than listening to a local port. The
+// port-forward connection is closed when the returned connection is closed.
+func Dial(cfg *rest.Config, pod v1.Pod, port int) (net.Conn, error) {
+	tun, err := NewTunnel(cfg, pod)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := tun.Dial(port)
+	if err != nil {
+		tun.Close()
+		return nil, err
+	}
+	conn.(*streamConn).tunnel = tun
+	return conn, nil
+}
+
+// Tunnel is a single port-forward connection to a pod, which multiplexes
+// the connections to one or more ports of that pod as separate streams.
+type Tunnel struct {
+	conn      httpstream.Connection
+	pod       string
+	requestID int
+	mu        sync.Mutex
+}
+
+// NewTunnel will open a port-forward connection to given pod.
+func NewTunnel(cfg *rest.Config, pod v1.Pod) (*Tunnel, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	url := getURLScheme(Request{RestConfig: cfg, Pod: pod})
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Tunnel{conn: conn, pod: pod.Name}, nil
+}
+
+// Dial will open a connection to given port of the pod, as a new stream
+// within the tunnel.
+func (t *Tunnel) Dial(port int) (net.Conn, error) {
+	t.mu.Lock()
+	id := t.requestID
+	t.requestID++
+	t.mu.Unlock()
+
+	headers := http.Header{}
+	headers.Set(v1.StreamType, v1.StreamTypeError)
+	headers.Set(v1.PortHeader, strconv.Itoa(port))
+	headers.Set(v1.PortForwardRequestIDHeader, strconv.Itoa(id))
+	errs, err := t.conn.CreateStream(headers)
+	if err != nil {
+		return nil, err
+	}
+	// we're not writing to the error stream
+	errs.Close()
+
+	headers.Set(v1.StreamType, v1.StreamTypeData)
+	data, err := t.conn.CreateStream(headers)
+	if err != nil {
+		t.conn.RemoveStreams(errs)
+		return nil, err
+	}
+
+	conn := &streamConn{
+		Stream: data,
+		errs:   errs,
+		conn:   t.conn,
+		addr:   &streamAddr{fmt.Sprintf("%s:%d", t.pod, port)},
+	}
+	go func() {
+		msg, err := io.ReadAll(errs)
+		if err == nil && len(msg) > 0 {
+			klog.Errorf("error forwarding to %s:%d: %s", t.pod, port, msg)
+			conn.Close()
+		}
+	}()
+	return conn, nil
+}
+
+// Done will return a channel that is closed when the tunnel is closed.
+func (t *Tunnel) Done() <-chan bool {
+	return t.conn.CloseChan()
+}
+
+// Close will close the tunnel, including all its connections.
+func (t *Tunnel) Close() error {
+	return t.conn.Close()
+}
+
+// streamConn is a net.Conn that is backed by a port-forward data stream.
+type streamConn struct {
+	httpstream.Stream
+	errs   httpstream.Stream
+	conn   httpstream.Connection
+	tunnel *Tunnel
+	addr   net.Addr
+}
+
+// Close will close the data stream, and the tunnel if the tunnel was
+// dedicated to this connection.
+func (c *streamConn) Close() error {
+	c.Stream.Reset()
+	c.conn.RemoveStreams(c.Stream, c.errs)
+	if c.tunnel != nil {
+		return c.tunnel.Close()
+	}
+	return nil
+}
+
+// CloseWrite will close the data stream for writing, which informs the pod
+// that no more data will be sent.
+func (c *streamConn) CloseWrite() error {
+	return c.Stream.Close()
+}
+
+// LocalAddr will return the address of the pod, as there is no local
+// address.
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// RemoteAddr will return the address of the pod.
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// SetDeadline is not supported by port-forward streams, and is ignored.
+func (c *streamConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is not supported by port-forward streams, and is ignored.
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is not supported by port-forward streams, and is ignored.
+func (c *streamConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// streamAddr is the net.Addr of a port-forward stream.
+type streamAddr struct {
+	addr string
+}
+
+// Network will return the network name of the address.
+func (a *streamAddr) Network() string {
+	return "portforward"
+}
+
+// String will return the address as pod:port.
+func (a *streamAddr) String() string {
+	return a.addr
+}
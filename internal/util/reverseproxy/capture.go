@@ -0,0 +1,332 @@
+package reverseproxy
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// CaptureFormatPcapng will record the connections in pcapng format.
+	CaptureFormatPcapng = "pcapng"
+	// CaptureFormatHexdump will record the connections as a hexdump.
+	CaptureFormatHexdump = "hexdump"
+)
+
+const (
+	toServer = iota
+	toClient
+)
+
+const (
+	pcapngSectionHeader  = 0x0A0D0D0A
+	pcapngInterfaceDescr = 0x00000001
+	pcapngEnhancedPacket = 0x00000006
+	pcapngByteOrderMagic = 0x1A2B3C4D
+	pcapngLinkTypeRaw    = 101
+	pcapngOptFlags       = 2
+	tcpFin               = 0x01
+	tcpSyn               = 0x02
+	tcpPsh               = 0x08
+	tcpAck               = 0x10
+	maxSegmentSize       = 65000
+)
+
+// captureSeq is used to make capture file names unique.
+var captureSeq uint64
+
+// Capture is the configuration used to record all proxied connections,
+// each connection is recorded in a separate file.
+type Capture struct {
+	// Dir is the directory in which the capture files are written
+	Dir string
+	// Format is the format of the capture files (pcapng or hexdump)
+	Format string
+	// MaxSize is the max size of a capture file in bytes, data exceeding
+	// this size is not recorded (0 is unlimited)
+	MaxSize int64
+	// Prefix is the prefix of the capture file names
+	Prefix string
+}
+
+// CaptureFile describes a capture file in the capture directory.
+type CaptureFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// ListCaptures will return the capture files in the given directory that
+// start with the given prefix, ordered by name.
+func ListCaptures(dir, prefix string) ([]CaptureFile, error) {
+	res := []CaptureFile{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return res, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !isCaptureFile(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		res = append(res, CaptureFile{Name: name, Size: info.Size(), Modified: info.ModTime()})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// GetCapturePath will return the path of the given capture file in the given
+// directory, or an error if the name is not a capture file.
+func GetCapturePath(dir, name string) (string, error) {
+	if name != filepath.Base(name) || !isCaptureFile(name) {
+		return "", fmt.Errorf("invalid capture file %s", name)
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// isCaptureFile will return true if the given file name has the extension
+// of a capture file.
+func isCaptureFile(name string) bool {
+	return strings.HasSuffix(name, ".pcapng") || strings.HasSuffix(name, ".hexdump")
+}
+
+// recorder will record the data of a single proxied connection.
+type recorder struct {
+	mu        sync.Mutex
+	out       io.WriteCloser
+	format    string
+	name      string
+	size      int64
+	max       int64
+	truncated bool
+	closed    bool
+	addr      [2]*net.TCPAddr // source address by direction (client, server)
+	seq       [2]uint32       // tcp sequence number by direction
+}
+
+// open will create a new capture file for a connection between given
+// client and server.
+func (c *Capture) open(client, server net.Addr) (*recorder, error) {
+	format := c.Format
+	if format == "" {
+		format = CaptureFormatPcapng
+	}
+	if format != CaptureFormatPcapng && format != CaptureFormatHexdump {
+		return nil, fmt.Errorf("unsupported capture format %s", format)
+	}
+	name := fmt.Sprintf("%s-%s-%d.%s", c.Prefix, time.Now().UTC().Format("20060102T150405.000000"), atomic.AddUint64(&captureSeq, 1), format)
+	out, err := os.Create(filepath.Join(c.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{
+		out:    out,
+		format: format,
+		name:   name,
+		max:    c.MaxSize,
+		addr:   [2]*net.TCPAddr{captureAddr(client, 1), captureAddr(server, 2)},
+	}
+	r.start()
+	return r, nil
+}
+
+// captureAddr will return the tcp address for given address. As only ipv4
+// is recorded, a fake ipv4 address is used for other addresses.
+func captureAddr(addr net.Addr, fake byte) *net.TCPAddr {
+	if a, ok := addr.(*net.TCPAddr); ok && a.IP.To4() != nil {
+		return &net.TCPAddr{IP: a.IP.To4(), Port: a.Port}
+	}
+	port := 0
+	if a, ok := addr.(*net.TCPAddr); ok {
+		port = a.Port
+	}
+	return &net.TCPAddr{IP: net.IPv4(10, 0, 0, fake).To4(), Port: port}
+}
+
+// start will write the header of the capture file.
+func (r *recorder) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.format == CaptureFormatHexdump {
+		r.write([]byte(fmt.Sprintf("%s connection %s -> %s\n\n", timestamp(), r.addr[0], r.addr[1])))
+		return
+	}
+	shb := make([]byte, 28)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngSectionHeader)
+	binary.LittleEndian.PutUint32(shb[4:], 28)
+	binary.LittleEndian.PutUint32(shb[8:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	binary.LittleEndian.PutUint16(shb[14:], 0)
+	binary.LittleEndian.PutUint64(shb[16:], 0xFFFFFFFFFFFFFFFF)
+	binary.LittleEndian.PutUint32(shb[24:], 28)
+	idb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(idb[0:], pcapngInterfaceDescr)
+	binary.LittleEndian.PutUint32(idb[4:], 20)
+	binary.LittleEndian.PutUint16(idb[8:], pcapngLinkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[16:], 20)
+	r.write(append(shb, idb...))
+	// synthesize the tcp handshake, so tools can follow the stream
+	r.packet(toServer, tcpSyn, nil)
+	r.seq[toServer]++
+	r.packet(toClient, tcpSyn|tcpAck, nil)
+	r.seq[toClient]++
+	r.packet(toServer, tcpAck, nil)
+}
+
+// record will record given data that is sent in given direction.
+func (r *recorder) record(dir int, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if r.format == CaptureFormatHexdump {
+		r.write([]byte(fmt.Sprintf("%s %s -> %s %d bytes\n%s\n", timestamp(), r.addr[dir], r.addr[1-dir], len(data), hex.Dump(data))))
+		return
+	}
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxSegmentSize {
+			n = maxSegmentSize
+		}
+		r.packet(dir, tcpPsh|tcpAck, data[:n])
+		r.seq[dir] += uint32(n)
+		data = data[n:]
+	}
+}
+
+// close will finish the capture file.
+func (r *recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if r.format == CaptureFormatHexdump {
+		r.write([]byte(fmt.Sprintf("%s connection closed\n", timestamp())))
+	} else {
+		r.packet(toServer, tcpFin|tcpAck, nil)
+		r.packet(toClient, tcpFin|tcpAck, nil)
+	}
+	r.closed = true
+	r.out.Close()
+}
+
+// packet will write an enhanced packet block with an ipv4/tcp packet that
+// contains given data, sent in given direction.
+func (r *recorder) packet(dir int, flags byte, data []byte) {
+	src, dst := r.addr[dir], r.addr[1-dir]
+	pkt := make([]byte, 40+len(data))
+	// ipv4 header
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:], uint16(len(pkt)))
+	pkt[8] = 64
+	pkt[9] = 6
+	copy(pkt[12:16], src.IP)
+	copy(pkt[16:20], dst.IP)
+	binary.BigEndian.PutUint16(pkt[10:], checksum(pkt[:20]))
+	// tcp header
+	binary.BigEndian.PutUint16(pkt[20:], uint16(src.Port))
+	binary.BigEndian.PutUint16(pkt[22:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(pkt[24:], r.seq[dir])
+	if flags&tcpAck != 0 {
+		binary.BigEndian.PutUint32(pkt[28:], r.seq[1-dir])
+	}
+	pkt[32] = 5 << 4
+	pkt[33] = flags
+	binary.BigEndian.PutUint16(pkt[34:], 0xFFFF)
+	copy(pkt[40:], data)
+
+	pad := (4 - len(pkt)%4) % 4
+	size := 28 + len(pkt) + pad + 12 + 4
+	blk := make([]byte, size)
+	ts := uint64(time.Now().UnixMicro())
+	binary.LittleEndian.PutUint32(blk[0:], pcapngEnhancedPacket)
+	binary.LittleEndian.PutUint32(blk[4:], uint32(size))
+	binary.LittleEndian.PutUint32(blk[12:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(blk[16:], uint32(ts))
+	binary.LittleEndian.PutUint32(blk[20:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(blk[24:], uint32(len(pkt)))
+	copy(blk[28:], pkt)
+	opt := blk[28+len(pkt)+pad:]
+	binary.LittleEndian.PutUint16(opt[0:], pcapngOptFlags)
+	binary.LittleEndian.PutUint16(opt[2:], 4)
+	// direction: inbound (towards the server) or outbound (towards the client)
+	binary.LittleEndian.PutUint32(opt[4:], uint32(dir+1))
+	binary.LittleEndian.PutUint32(blk[size-4:], uint32(size))
+	r.write(blk)
+}
+
+// write will write given data to the capture file, unless the max size of
+// the capture file is reached.
+func (r *recorder) write(data []byte) {
+	if r.truncated {
+		return
+	}
+	if r.max > 0 && r.size+int64(len(data)) > r.max {
+		klog.Warningf("capture %s reached max size of %d bytes, remaining data is not recorded", r.name, r.max)
+		r.truncated = true
+		return
+	}
+	n, err := r.out.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		klog.Errorf("error writing capture %s: %s", r.name, err)
+		r.truncated = true
+	}
+}
+
+// checksum will return the internet checksum of given header.
+func checksum(hdr []byte) uint16 {
+	sum := uint32(0)
+	for i := 0; i+1 < len(hdr); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(hdr[i:]))
+	}
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return ^uint16(sum)
+}
+
+// timestamp will return the current time as used in the hexdump format.
+func timestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000000Z")
+}
+
+// captureWriter is a writer that records all data that is written to the
+// underlying writer.
+type captureWriter struct {
+	io.Writer
+	rec *recorder
+	dir int
+}
+
+// Write will write given data to the underlying writer, and records the
+// data that has been written.
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.rec.record(w.dir, p[:n])
+	return n, err
+}
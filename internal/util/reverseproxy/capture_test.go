@@ -0,0 +1,177 @@
+package reverseproxy
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureHexdump(t *testing.T) {
+	dir := t.TempDir()
+	cpt := &Capture{Dir: dir, Format: CaptureFormatHexdump, Prefix: "abc-80"}
+	client := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40000}
+	server := &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 80}
+	rec, err := cpt.open(client, server)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rec.record(toServer, []byte("GET / HTTP/1.1\r\n"))
+	rec.record(toClient, []byte("HTTP/1.1 200 OK\r\n"))
+	rec.close()
+	rec.record(toClient, []byte("ignored"))
+
+	files, err := ListCaptures(dir, "abc-")
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected 1 capture, but got %v (%v)", files, err)
+	}
+	dat, err := os.ReadFile(filepath.Join(dir, files[0].Name))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, exp := range []string{
+		"127.0.0.1:40000 -> 10.1.2.3:80 16 bytes",
+		"10.1.2.3:80 -> 127.0.0.1:40000 17 bytes",
+		"|GET / HTTP/1.1..|",
+		"connection closed",
+	} {
+		if !strings.Contains(string(dat), exp) {
+			t.Errorf("expected %s in capture:\n%s", exp, dat)
+		}
+	}
+	if strings.Contains(string(dat), "ignored") {
+		t.Errorf("unexpected data recorded after close")
+	}
+}
+
+func TestCapturePcapng(t *testing.T) {
+	dir := t.TempDir()
+	cpt := &Capture{Dir: dir, Format: CaptureFormatPcapng, Prefix: "abc-80"}
+	rec, err := cpt.open(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 40000}, &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 80})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rec.record(toServer, []byte("hello"))
+	rec.record(toClient, make([]byte, maxSegmentSize+1))
+	rec.close()
+
+	dat, err := os.ReadFile(filepath.Join(dir, rec.name))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	types := []uint32{}
+	flags := []uint32{}
+	for len(dat) > 0 {
+		if len(dat) < 12 {
+			t.Fatalf("truncated block")
+		}
+		typ := binary.LittleEndian.Uint32(dat[0:])
+		size := binary.LittleEndian.Uint32(dat[4:])
+		if size%4 != 0 || int(size) > len(dat) || binary.LittleEndian.Uint32(dat[size-4:]) != size {
+			t.Fatalf("invalid block length %d", size)
+		}
+		if typ == pcapngEnhancedPacket {
+			caplen := binary.LittleEndian.Uint32(dat[20:])
+			pad := (4 - caplen%4) % 4
+			flags = append(flags, binary.LittleEndian.Uint32(dat[28+caplen+pad+4:]))
+			fake := net.IPv4(10, 0, 0, 1).To4()
+			if !net.IP(dat[40:44]).Equal(fake) && !net.IP(dat[44:48]).Equal(fake) {
+				t.Errorf("expected fake ipv4 address for ipv6 client")
+			}
+		}
+		types = append(types, typ)
+		dat = dat[size:]
+	}
+	// shb, idb, 3 handshake, 1 + 2 data and 2 fin packets
+	if len(types) != 10 || types[0] != pcapngSectionHeader || types[1] != pcapngInterfaceDescr {
+		t.Errorf("unexpected blocks %v", types)
+	}
+	if len(flags) != 8 || flags[3] != 1 || flags[4] != 2 || flags[5] != 2 {
+		t.Errorf("unexpected directions %v", flags)
+	}
+}
+
+func TestCaptureMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	cpt := &Capture{Dir: dir, Format: CaptureFormatHexdump, MaxSize: 200, Prefix: "abc-80"}
+	rec, err := cpt.open(nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rec.record(toServer, make([]byte, 1024))
+	rec.close()
+	info, err := os.Stat(filepath.Join(dir, rec.name))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if info.Size() > 200 {
+		t.Errorf("expected capture to be capped at 200 bytes, but got %d", info.Size())
+	}
+}
+
+func TestGetCapturePath(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "abc-80-1.pcapng"), []byte{}, 0644)
+	tests := []struct {
+		name string
+		err  bool
+	}{
+		{name: "abc-80-1.pcapng"},
+		{name: "abc-80-2.pcapng", err: true},
+		{name: "../abc-80-1.pcapng", err: true},
+		{name: "passwd", err: true},
+	}
+	for i, tst := range tests {
+		_, err := GetCapturePath(dir, tst.name)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+	}
+}
+
+func TestProxyCapture(t *testing.T) {
+	dir := t.TempDir()
+	stopP := make(chan struct{}, 1)
+	req := Request{
+		LocalPort:  30690,
+		RemoteIP:   "127.0.0.1",
+		RemotePort: 30691,
+		StopCh:     stopP,
+		MaxRetry:   2,
+		Capture:    &Capture{Dir: dir, Format: CaptureFormatHexdump, Prefix: "abc-30691"},
+	}
+
+	stopS := make(chan struct{}, 1)
+	go func() {
+		if err := helloServer("127.0.0.1", 30691, stopS); err != nil {
+			t.Errorf("unexpected error running helloServer: %s", err)
+		}
+	}()
+
+	if err := Proxy(req); err != nil {
+		t.Errorf("unexpected error starting proxy: %s", err)
+	}
+
+	if res, err := callServer("127.0.0.1", 30690); err != nil || res != "Hello!\n" {
+		t.Errorf("unexpected answer calling helloServer via proxy: %s (%v)", res, err)
+	}
+	<-time.After(100 * time.Millisecond)
+
+	files, err := ListCaptures(dir, "abc-30691-")
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected 1 capture, but got %v (%v)", files, err)
+	}
+	dat, _ := os.ReadFile(filepath.Join(dir, files[0].Name))
+	if !strings.Contains(string(dat), "|Hello!.|") {
+		t.Errorf("expected proxied data in capture:\n%s", dat)
+	}
+
+	stopP <- struct{}{}
+	stopS <- struct{}{}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"k8s.io/klog"
@@ -25,6 +26,18 @@ type Request struct {
 	// MaxRetry is the maximum number of retries (equals to seconds) upon error
 	// and initial connection.
 	MaxRetry int
+	// Activity is an optional function that is called when data is proxied.
+	Activity func()
+	// Toxics is an optional function that returns the faults that should be
+	// injected in the proxied connections.
+	Toxics func() Toxics
+	// ToxicsChanged is an optional function that returns a channel which is
+	// closed when the toxics are changed. The changed toxics are applied to
+	// the open connections as well.
+	ToxicsChanged func() <-chan struct{}
+	// Capture is the optional configuration to record all proxied
+	// connections.
+	Capture *Capture
 }
 
 // Proxy will open a reverse tcp proxy, listening to the provided
@@ -46,6 +59,12 @@ func Proxy(req Request) error {
 		return err
 	}
 
+	var tcs *toxicConns
+	if req.Toxics != nil {
+		tcs = newToxicConns(req.Toxics, req.ToxicsChanged)
+		go tcs.watch(req.StopCh)
+	}
+
 	done := false
 	go func() {
 		<-req.StopCh
@@ -72,7 +91,7 @@ func Proxy(req Request) error {
 				}
 				continue
 			}
-			go handleConnection(conn, local, remote, req.MaxRetry)
+			go handleConnection(conn, local, remote, req, tcs)
 		}
 		return
 	}()
@@ -82,16 +101,55 @@ func Proxy(req Request) error {
 
 // handleConnection will proxy a single connection towards the given endpoint. If the initial
 // connection fails, it will retry with a maximum of 30 tries (equal to 30 seconds). It will
-// close the given connection when returned.
-func handleConnection(conn net.Conn, local, remote string, maxRetry int) {
+// close the given connection when returned. The optional activity function is
+// called whenever data is proxied, the toxics of the optional toxicConns are
+// applied to the proxied data, and the connection is recorded if a capture
+// is configured.
+func handleConnection(conn net.Conn, local, remote string, req Request, tcs *toxicConns) {
 	var err error
 	var conn2 net.Conn
-	for try := 0; try < maxRetry*retryRate; try++ {
+	for try := 0; try < req.MaxRetry*retryRate; try++ {
 		conn2, err = net.DialTimeout("tcp", remote, time.Second/retryRate)
 		if err == nil {
 			klog.V(3).Infof("handling connection for %s", local)
-			go io.Copy(conn2, conn)
-			io.Copy(conn, conn2)
+			done := make(chan struct{})
+			var once sync.Once
+			stop := func() { once.Do(func() { close(done) }) }
+			defer stop()
+			var tc *toxicConn
+			if tcs != nil {
+				tc = newToxicConn(done, func() {
+					klog.V(3).Infof("resetting connection for %s", local)
+					stop()
+					resetConnection(conn)
+					conn2.Close()
+				}, func() {
+					klog.V(3).Infof("timeout closing connection for %s", local)
+					stop()
+					conn.Close()
+					conn2.Close()
+				})
+				tcs.add(tc)
+				defer tcs.remove(tc)
+			}
+			up, down := io.Writer(conn2), io.Writer(conn)
+			if req.Capture != nil {
+				if rec, err := req.Capture.open(conn.RemoteAddr(), conn2.RemoteAddr()); err != nil {
+					klog.Errorf("error creating capture for %s: %s", local, err)
+				} else {
+					klog.V(3).Infof("capturing connection for %s to %s", local, rec.name)
+					defer rec.close()
+					up, down = &captureWriter{conn2, rec, toServer}, &captureWriter{conn, rec, toClient}
+				}
+			}
+			if tc != nil {
+				up, down = &toxicWriter{up, tc}, &toxicWriter{down, tc}
+			}
+			go io.Copy(&activityWriter{up, req.Activity}, conn)
+			io.Copy(&activityWriter{down, req.Activity}, conn2)
+			if tx, _ := tc.get(); tx != nil && tx.SlowClose > 0 {
+				time.Sleep(tx.SlowClose)
+			}
 			conn2.Close()
 			conn.Close()
 			return
@@ -125,3 +183,19 @@ func remoteAcceptsConnection(remote string) bool {
 	conn.Close()
 	return true
 }
+
+// activityWriter is a writer that calls the activity function on every
+// write, before writing to the underlying writer.
+type activityWriter struct {
+	io.Writer
+	activity func()
+}
+
+// Write will call the activity function and writes given data to the
+// underlying writer.
+func (w *activityWriter) Write(p []byte) (int, error) {
+	if w.activity != nil {
+		w.activity()
+	}
+	return w.Writer.Write(p)
+}
@@ -2,15 +2,15 @@ package reverseproxy
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"testing"
 	"time"
 )
 
 func helloServer(host string, port int, stop chan struct{}) error {
-	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 	if err != nil {
 		return err
 	}
@@ -40,7 +40,7 @@ func helloServer(host string, port int, stop chan struct{}) error {
 }
 
 func callServer(host string, port int) (string, error) {
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 	if err != nil {
 		return "", err
 	}
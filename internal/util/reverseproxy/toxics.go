@@ -0,0 +1,418 @@
+package reverseproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errClosed is returned when writing to a connection that has been closed
+// by a toxic.
+var errClosed = errors.New("connection closed by toxic")
+
+// Toxics describes the faults that are injected in proxied connections. The
+// toxics are applied to the data in both directions.
+type Toxics struct {
+	// Latency is the delay added to each chunk of proxied data
+	Latency time.Duration
+	// Jitter is the random variation (+/-) of the added latency
+	Jitter time.Duration
+	// Bandwidth is the max throughput in KB/s, 0 is unlimited
+	Bandwidth int
+	// ResetPeer will reset connections (tcp rst) after being open for
+	// the given duration
+	ResetPeer time.Duration
+	// Timeout will hold back all data, and close the connection if the
+	// toxic is still active after the given duration; if the toxic is
+	// removed before, the held back data is released
+	Timeout time.Duration
+	// SlowClose is the delay before a closed connection is actually closed
+	SlowClose time.Duration
+}
+
+// ParseToxics will parse the given toxics specification, which is a comma
+// separated list of key=value pairs (e.g. latency=100ms,bandwidth=64). The
+// supported keys are latency, jitter, bandwidth, reset_peer, timeout and
+// slow_close.
+func ParseToxics(spec string) (Toxics, error) {
+	tx := Toxics{}
+	for _, kv := range strings.Split(spec, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(kv, "=")
+		if !ok {
+			return tx, fmt.Errorf("invalid toxic %s", kv)
+		}
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+		if key == "bandwidth" {
+			bw, err := strconv.Atoi(val)
+			if err != nil || bw < 0 {
+				return tx, fmt.Errorf("invalid bandwidth %s", val)
+			}
+			tx.Bandwidth = bw
+			continue
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return tx, fmt.Errorf("invalid %s %s", key, val)
+		}
+		switch key {
+		case "latency":
+			tx.Latency = d
+		case "jitter":
+			tx.Jitter = d
+		case "reset_peer":
+			tx.ResetPeer = d
+		case "timeout":
+			tx.Timeout = d
+		case "slow_close":
+			tx.SlowClose = d
+		default:
+			return tx, fmt.Errorf("unsupported toxic %s", key)
+		}
+	}
+	return tx, nil
+}
+
+// String will return the toxics as a specification that can be parsed
+// with ParseToxics.
+func (tx Toxics) String() string {
+	res := []string{}
+	for _, t := range []struct {
+		key string
+		val time.Duration
+	}{
+		{"latency", tx.Latency},
+		{"jitter", tx.Jitter},
+		{"reset_peer", tx.ResetPeer},
+		{"timeout", tx.Timeout},
+		{"slow_close", tx.SlowClose},
+	} {
+		if t.val > 0 {
+			res = append(res, t.key+"="+t.val.String())
+		}
+	}
+	if tx.Bandwidth > 0 {
+		res = append(res, "bandwidth="+strconv.Itoa(tx.Bandwidth))
+	}
+	return strings.Join(res, ",")
+}
+
+// IsZero will return true if no toxics are configured.
+func (tx Toxics) IsZero() bool {
+	return tx == Toxics{}
+}
+
+// toxicsJSON is the json representation of Toxics, with the durations
+// represented as strings (e.g. 100ms).
+type toxicsJSON struct {
+	Latency   string `json:"latency,omitempty"`
+	Jitter    string `json:"jitter,omitempty"`
+	Bandwidth int    `json:"bandwidth,omitempty"`
+	ResetPeer string `json:"reset_peer,omitempty"`
+	Timeout   string `json:"timeout,omitempty"`
+	SlowClose string `json:"slow_close,omitempty"`
+}
+
+// MarshalJSON will return the json representation of the toxics.
+func (tx Toxics) MarshalJSON() ([]byte, error) {
+	dur := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	return json.Marshal(toxicsJSON{
+		Latency:   dur(tx.Latency),
+		Jitter:    dur(tx.Jitter),
+		Bandwidth: tx.Bandwidth,
+		ResetPeer: dur(tx.ResetPeer),
+		Timeout:   dur(tx.Timeout),
+		SlowClose: dur(tx.SlowClose),
+	})
+}
+
+// UnmarshalJSON will parse the json representation of the toxics.
+func (tx *Toxics) UnmarshalJSON(data []byte) error {
+	in := toxicsJSON{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	spec := []string{}
+	for key, val := range map[string]string{
+		"latency":    in.Latency,
+		"jitter":     in.Jitter,
+		"reset_peer": in.ResetPeer,
+		"timeout":    in.Timeout,
+		"slow_close": in.SlowClose,
+	} {
+		if val != "" {
+			spec = append(spec, key+"="+val)
+		}
+	}
+	if in.Bandwidth != 0 {
+		spec = append(spec, "bandwidth="+strconv.Itoa(in.Bandwidth))
+	}
+	res, err := ParseToxics(strings.Join(spec, ","))
+	if err != nil {
+		return err
+	}
+	*tx = res
+	return nil
+}
+
+// delay will return the latency including a random jitter.
+func (tx Toxics) delay() time.Duration {
+	d := tx.Latency
+	if tx.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*tx.Jitter+1))) - tx.Jitter
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// toxicConns keeps track of the open connections of a proxy, and updates
+// the toxics of these connections whenever the toxics are changed.
+type toxicConns struct {
+	toxics  func() Toxics
+	changed func() <-chan struct{}
+	next    <-chan struct{}
+	conns   map[*toxicConn]bool
+	mu      sync.Mutex
+}
+
+// newToxicConns will return a new toxicConns instance for given toxics
+// function and changed function, which returns a channel that is closed
+// when the toxics are changed. Changes are tracked from the moment the
+// instance is created.
+func newToxicConns(toxics func() Toxics, changed func() <-chan struct{}) *toxicConns {
+	tcs := &toxicConns{toxics: toxics, changed: changed, conns: map[*toxicConn]bool{}}
+	if changed != nil {
+		tcs.next = changed()
+	}
+	return tcs
+}
+
+// add will register given connection, and applies the current toxics.
+func (tcs *toxicConns) add(tc *toxicConn) {
+	tcs.mu.Lock()
+	defer tcs.mu.Unlock()
+	tcs.conns[tc] = true
+	tc.set(tcs.toxics())
+}
+
+// remove will unregister given connection.
+func (tcs *toxicConns) remove(tc *toxicConn) {
+	tcs.mu.Lock()
+	defer tcs.mu.Unlock()
+	delete(tcs.conns, tc)
+}
+
+// watch will update the toxics of all open connections whenever the toxics
+// are changed, until stop is closed.
+func (tcs *toxicConns) watch(stop <-chan struct{}) {
+	if tcs.changed == nil {
+		return
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tcs.next:
+		}
+		tcs.next = tcs.changed()
+		tcs.mu.Lock()
+		tx := tcs.toxics()
+		for tc := range tcs.conns {
+			tc.set(tx)
+		}
+		tcs.mu.Unlock()
+	}
+}
+
+// toxicConn contains the toxics of a single open connection. The reset_peer
+// and timeout toxics are only watched while they are active, and the other
+// toxics are only applied to the proxied data while toxics are active.
+type toxicConn struct {
+	toxics    *Toxics
+	changed   chan struct{}
+	watching  bool
+	start     time.Time
+	done      <-chan struct{}
+	reset     func()
+	closeConn func()
+	mu        sync.Mutex
+}
+
+// newToxicConn will return a new toxicConn for a connection that is open
+// until done is closed. The reset function is called when the connection
+// has been open longer than the reset_peer toxic, and closeConn is called
+// when the timeout toxic has been active longer than its duration.
+func newToxicConn(done <-chan struct{}, reset, closeConn func()) *toxicConn {
+	return &toxicConn{
+		changed:   make(chan struct{}),
+		start:     time.Now(),
+		done:      done,
+		reset:     reset,
+		closeConn: closeConn,
+	}
+}
+
+// set will update the toxics of the connection, and will start watching
+// the connection if the reset_peer or timeout toxic became active.
+func (tc *toxicConn) set(tx Toxics) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tx.IsZero() {
+		tc.toxics = nil
+	} else {
+		tc.toxics = &tx
+	}
+	close(tc.changed)
+	tc.changed = make(chan struct{})
+	if !tc.watching && (tx.ResetPeer > 0 || tx.Timeout > 0) {
+		tc.watching = true
+		go tc.watch()
+	}
+}
+
+// get will return the active toxics, or nil if no toxics are active, and a
+// channel that is closed when the toxics are changed.
+func (tc *toxicConn) get() (*Toxics, <-chan struct{}) {
+	if tc == nil {
+		return nil, nil
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.toxics, tc.changed
+}
+
+// watch will call reset when the connection has been open longer than the
+// reset_peer toxic, and closeConn when the timeout toxic has been active
+// longer than its duration (also if the connection is idle). It returns
+// when the connection is done, or when neither of these toxics is active
+// anymore.
+func (tc *toxicConn) watch() {
+	var timeout time.Time
+	for {
+		tc.mu.Lock()
+		tx, changed := tc.toxics, tc.changed
+		if tx == nil || (tx.ResetPeer == 0 && tx.Timeout == 0) {
+			tc.watching = false
+			tc.mu.Unlock()
+			return
+		}
+		tc.mu.Unlock()
+		wait := time.Duration(-1)
+		if tx.ResetPeer > 0 {
+			wait = tx.ResetPeer - time.Since(tc.start)
+			if wait <= 0 {
+				tc.reset()
+				return
+			}
+		}
+		if tx.Timeout == 0 {
+			timeout = time.Time{}
+		} else {
+			if timeout.IsZero() {
+				timeout = time.Now()
+			}
+			d := tx.Timeout - time.Since(timeout)
+			if d <= 0 {
+				tc.closeConn()
+				return
+			}
+			if wait < 0 || d < wait {
+				wait = d
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-tc.done:
+			timer.Stop()
+			return
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// toxicWriter is a writer that applies the active toxics of a connection to
+// the data before writing it to the underlying writer. If no toxics are
+// active, the data is written as-is.
+type toxicWriter struct {
+	io.Writer
+	conn *toxicConn
+}
+
+// Write will apply the toxics and writes given data to the underlying
+// writer.
+func (w *toxicWriter) Write(p []byte) (int, error) {
+	tx, changed := w.conn.get()
+	for tx != nil && tx.Timeout > 0 {
+		// hold back the data until the toxic is removed, or until the
+		// connection is closed by the timeout toxic
+		select {
+		case <-w.conn.done:
+			return 0, errClosed
+		case <-changed:
+		}
+		tx, changed = w.conn.get()
+	}
+	if tx == nil {
+		return w.Writer.Write(p)
+	}
+	if d := tx.delay(); d > 0 {
+		time.Sleep(d)
+	}
+	if tx.Bandwidth > 0 {
+		return w.throttle(p, tx.Bandwidth)
+	}
+	return w.Writer.Write(p)
+}
+
+// throttle will write given data in chunks to the underlying writer, at
+// the given bandwidth in KB/s.
+func (w *toxicWriter) throttle(p []byte, bandwidth int) (int, error) {
+	rate := bandwidth * 1024
+	chunk := rate / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	n := 0
+	for n < len(p) {
+		end := n + chunk
+		if end > len(p) {
+			end = len(p)
+		}
+		m, err := w.Writer.Write(p[n:end])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		time.Sleep(time.Duration(m) * time.Second / time.Duration(rate))
+	}
+	return n, nil
+}
+
+// resetConnection will close the given connection with a tcp reset,
+// rather than a normal close.
+func resetConnection(conn net.Conn) {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,200 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseToxics(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Toxics
+		err bool
+	}{
+		{in: "", out: Toxics{}},
+		{in: "latency=100ms, jitter=10ms", out: Toxics{Latency: 100 * time.Millisecond, Jitter: 10 * time.Millisecond}},
+		{in: "bandwidth=64,reset_peer=5s", out: Toxics{Bandwidth: 64, ResetPeer: 5 * time.Second}},
+		{in: "timeout=2s,slow_close=1s", out: Toxics{Timeout: 2 * time.Second, SlowClose: time.Second}},
+		{in: "latency", err: true},
+		{in: "latency=-1s", err: true},
+		{in: "bandwidth=fast", err: true},
+		{in: "limit_data=10", err: true},
+	}
+	for i, tst := range tests {
+		res, err := ParseToxics(tst.in)
+		if err != nil && !tst.err {
+			t.Errorf("failed test %d - unexpected error: %s", i, err)
+		}
+		if err == nil && tst.err {
+			t.Errorf("failed test %d - expected error, but succeeded without error", i)
+		}
+		if !tst.err && res != tst.out {
+			t.Errorf("failed test %d - expected %v, but got %v", i, tst.out, res)
+		}
+		if !tst.err {
+			if rt, _ := ParseToxics(res.String()); rt != res {
+				t.Errorf("failed test %d - expected %v after parsing %s, but got %v", i, res, res.String(), rt)
+			}
+		}
+	}
+}
+
+func TestToxicsJSON(t *testing.T) {
+	tx := Toxics{Latency: 100 * time.Millisecond, Bandwidth: 64}
+	dat, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(dat) != `{"latency":"100ms","bandwidth":64}` {
+		t.Errorf("unexpected json %s", dat)
+	}
+	res := Toxics{}
+	if err := json.Unmarshal(dat, &res); err != nil || res != tx {
+		t.Errorf("expected %v, but got %v (%v)", tx, res, err)
+	}
+	if err := json.Unmarshal([]byte(`{"latency":"soon"}`), &res); err == nil {
+		t.Errorf("expected error for invalid latency")
+	}
+}
+
+func TestToxicWriter(t *testing.T) {
+	tests := []struct {
+		toxics Toxics
+		remove time.Duration
+		closed bool
+		data   int
+		min    time.Duration
+		out    int
+		err    error
+	}{
+		{toxics: Toxics{}, data: 10, out: 10},
+		{toxics: Toxics{Latency: 50 * time.Millisecond}, data: 10, min: 50 * time.Millisecond, out: 10},
+		{toxics: Toxics{Bandwidth: 1}, data: 512, min: 400 * time.Millisecond, out: 512},
+		{toxics: Toxics{Timeout: time.Minute}, remove: 150 * time.Millisecond, data: 10, min: 150 * time.Millisecond, out: 10},
+		{toxics: Toxics{Timeout: time.Minute}, closed: true, data: 10, err: errClosed},
+	}
+	for i, tst := range tests {
+		buf := &bytes.Buffer{}
+		done := make(chan struct{})
+		if tst.closed {
+			close(done)
+		}
+		tc := newToxicConn(done, func() {}, func() {})
+		tc.set(tst.toxics)
+		if tst.remove > 0 {
+			time.AfterFunc(tst.remove, func() { tc.set(Toxics{}) })
+		}
+		w := &toxicWriter{buf, tc}
+		start := time.Now()
+		n, err := w.Write(make([]byte, tst.data))
+		if err != tst.err {
+			t.Errorf("failed test %d - expected error %v, but got %v", i, tst.err, err)
+		}
+		if buf.Len() != tst.out || n != tst.out {
+			t.Errorf("failed test %d - expected %d bytes written, but got %d", i, tst.out, buf.Len())
+		}
+		if time.Since(start) < tst.min {
+			t.Errorf("failed test %d - expected a delay of at least %s", i, tst.min)
+		}
+	}
+}
+
+func TestToxicConnWatch(t *testing.T) {
+	tests := []struct {
+		toxics   Toxics
+		add      time.Duration
+		remove   time.Duration
+		reset    bool
+		closed   bool
+		watching bool
+	}{
+		{toxics: Toxics{}},
+		{toxics: Toxics{Latency: time.Millisecond}},
+		{toxics: Toxics{ResetPeer: 150 * time.Millisecond}, reset: true},
+		{toxics: Toxics{ResetPeer: 150 * time.Millisecond}, add: 300 * time.Millisecond, reset: true},
+		{toxics: Toxics{ResetPeer: 300 * time.Millisecond}, remove: 150 * time.Millisecond},
+		{toxics: Toxics{Timeout: 150 * time.Millisecond}, closed: true},
+		{toxics: Toxics{Timeout: 150 * time.Millisecond}, add: 100 * time.Millisecond, closed: true},
+		{toxics: Toxics{Timeout: 300 * time.Millisecond}, remove: 150 * time.Millisecond},
+		{toxics: Toxics{Timeout: time.Minute}, watching: true},
+	}
+	for i, tst := range tests {
+		done := make(chan struct{})
+		var reset, closed int32
+		tc := newToxicConn(done, func() {
+			atomic.StoreInt32(&reset, 1)
+		}, func() {
+			atomic.StoreInt32(&closed, 1)
+		})
+		if tst.add > 0 {
+			time.AfterFunc(tst.add, func() { tc.set(tst.toxics) })
+		} else {
+			tc.set(tst.toxics)
+		}
+		if tst.remove > 0 {
+			time.AfterFunc(tst.remove, func() { tc.set(Toxics{}) })
+		}
+		time.Sleep(600 * time.Millisecond)
+		tc.mu.Lock()
+		watching := tc.watching
+		tc.mu.Unlock()
+		close(done)
+		if (atomic.LoadInt32(&reset) == 1) != tst.reset {
+			t.Errorf("failed test %d - expected reset %t", i, tst.reset)
+		}
+		if (atomic.LoadInt32(&closed) == 1) != tst.closed {
+			t.Errorf("failed test %d - expected closed %t", i, tst.closed)
+		}
+		if watching != tst.watching && !tst.reset && !tst.closed {
+			t.Errorf("failed test %d - expected watching %t", i, tst.watching)
+		}
+	}
+}
+
+func TestToxicConnsWatch(t *testing.T) {
+	var mu sync.Mutex
+	toxics := Toxics{}
+	changed := make(chan struct{})
+	tcs := newToxicConns(func() Toxics {
+		mu.Lock()
+		defer mu.Unlock()
+		return toxics
+	}, func() <-chan struct{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return changed
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go tcs.watch(stop)
+
+	tc := newToxicConn(make(chan struct{}), func() {}, func() {})
+	tcs.add(tc)
+	if tx, _ := tc.get(); tx != nil {
+		t.Errorf("expected no active toxics, but got %v", tx)
+	}
+
+	_, upd := tc.get()
+	mu.Lock()
+	toxics = Toxics{Latency: time.Millisecond}
+	close(changed)
+	changed = make(chan struct{})
+	mu.Unlock()
+	select {
+	case <-upd:
+	case <-time.After(time.Second):
+		t.Fatalf("expected toxics of open connection to be updated")
+	}
+	if tx, _ := tc.get(); tx == nil || tx.Latency != time.Millisecond {
+		t.Errorf("expected latency toxic to be active, but got %v", tx)
+	}
+
+	tcs.remove(tc)
+	if len(tcs.conns) != 0 {
+		t.Errorf("expected connection to be removed")
+	}
+}